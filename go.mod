@@ -6,6 +6,8 @@ require (
 	github.com/aws/aws-sdk-go-v2 v1.42.1
 	github.com/aws/aws-sdk-go-v2/config v1.32.30
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.105.2
+	github.com/klauspost/compress v1.20.1
+	golang.org/x/crypto v0.46.0
 	golang.org/x/time v0.15.0
 )
 
@@ -25,4 +27,5 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.37.1 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.44.1 // indirect
 	github.com/aws/smithy-go v1.27.3 // indirect
+	golang.org/x/sys v0.39.0 // indirect
 )
@@ -2,18 +2,25 @@ package cli
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/catatsuy/kekkai/internal/glob"
+	"github.com/catatsuy/kekkai/internal/hash"
 	"github.com/catatsuy/kekkai/internal/manifest"
 	"github.com/catatsuy/kekkai/internal/output"
+	"github.com/catatsuy/kekkai/internal/policy"
 	"github.com/catatsuy/kekkai/internal/storage"
 )
 
@@ -28,6 +35,7 @@ var (
 
 // CLI holds the CLI application state
 type CLI struct {
+	inStream  io.Reader
 	outStream io.Writer
 	errStream io.Writer
 
@@ -37,6 +45,7 @@ type CLI struct {
 // NewCLI creates a new CLI instance
 func NewCLI(outStream, errStream io.Writer) *CLI {
 	return &CLI{
+		inStream:   os.Stdin,
 		outStream:  outStream,
 		errStream:  errStream,
 		appVersion: version(),
@@ -89,6 +98,110 @@ func validateIdentifier(value, fieldName string) (string, error) {
 	return value, nil
 }
 
+// parseXattrNamespaces splits a comma-separated namespace list such as "security,system"
+func parseXattrNamespaces(value string) ([]string, error) {
+	var namespaces []string
+	for ns := range strings.SplitSeq(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("xattr namespace %q must not contain '.'", ns)
+		}
+		namespaces = append(namespaces, ns)
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("-xattr-namespaces must list at least one namespace")
+	}
+	return namespaces, nil
+}
+
+// parseTargets splits -target values into a single directory or named roots.
+// Values are NAME=PATH roots only when named is set, so a single directory
+// such as "/srv/a=b" keeps the layout of a single-target manifest.
+func parseTargets(values []string, named bool) (string, []manifest.Root, error) {
+	if len(values) == 0 {
+		return ".", nil, nil
+	}
+	if !named {
+		if len(values) > 1 {
+			return "", nil, fmt.Errorf("-target must be a single directory")
+		}
+		return values[0], nil, nil
+	}
+
+	var roots []manifest.Root
+	for _, value := range values {
+		root, ok := manifest.ParseRoot(value)
+		if !ok {
+			return "", nil, fmt.Errorf("-target %q must be NAME=PATH", value)
+		}
+		roots = append(roots, root)
+	}
+	if err := manifest.ValidateRoots(roots); err != nil {
+		return "", nil, err
+	}
+	return "", roots, nil
+}
+
+// parseScanExtensions parses the comma-separated -scan-extensions value
+func parseScanExtensions(value string) ([]string, error) {
+	var extensions []string
+	for ext := range strings.SplitSeq(value, ",") {
+		ext = strings.TrimSpace(ext)
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") || strings.Count(ext, ".") > 1 || strings.Contains(ext, "/") {
+			return nil, fmt.Errorf("scan extension %q must be a single extension like .php", ext)
+		}
+		extensions = append(extensions, ext)
+	}
+	if len(extensions) == 0 {
+		return nil, fmt.Errorf("-scan-extensions must list at least one extension")
+	}
+	return extensions, nil
+}
+
+// loadExcludeRules reads gitignore-style exclude rules from a file
+func loadExcludeRules(path string) ([]hash.Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exclude file: %w", err)
+	}
+	defer f.Close()
+
+	rules, err := hash.ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// loadPolicy builds the exclude policy from a policy file and flags; the
+// flags add to the file and -max-excluded overrides its limit
+func loadPolicy(filename string, maxExcluded float64, forbidden, required []string) (*policy.Policy, error) {
+	p := &policy.Policy{}
+	if filename != "" {
+		var err error
+		if p, err = policy.LoadFromFile(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	if maxExcluded != 0 {
+		p.MaxExcludedFraction = maxExcluded
+	}
+	p.ForbiddenPatterns = append(p.ForbiddenPatterns, forbidden...)
+	p.RequiredPaths = append(p.RequiredPaths, required...)
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // Run executes the CLI
 func (c *CLI) Run(args []string) int {
 	if len(args) <= 1 {
@@ -108,6 +221,16 @@ func (c *CLI) Run(args []string) int {
 		return c.runGenerate(args)
 	case "verify":
 		return c.runVerify(args)
+	case "diff":
+		return c.runDiff(args)
+	case "inspect":
+		return c.runInspect(args)
+	case "explain":
+		return c.runExplain(args)
+	case "root":
+		return c.runRoot(args)
+	case "keygen":
+		return c.runKeygen(args)
 	default:
 		fmt.Fprintf(c.errStream, "Error: Unknown command '%s'\n", args[1])
 		c.printUsage()
@@ -118,38 +241,72 @@ func (c *CLI) Run(args []string) int {
 // runGenerate handles the generate command
 func (c *CLI) runGenerate(args []string) int {
 	var (
-		excludes arrayFlags
-
-		target    string
-		output    string
-		s3Bucket  string
-		s3Region  string
-		basePath  string
-		appName   string
-		format    string
-		workers   int
-		rateLimit int64
-		timeout   int
-		help      bool
+		includes       arrayFlags
+		excludes       arrayFlags
+		excludeFiles   arrayFlags
+		forbidden      arrayFlags
+		required       arrayFlags
+		appendOnly     arrayFlags
+		rotateSuffixes arrayFlags
+		levels         arrayFlags
+		targets        arrayFlags
+
+		output      string
+		outFormat   string
+		compress    string
+		hashName    string
+		s3Bucket    string
+		s3Region    string
+		basePath    string
+		appName     string
+		format      string
+		signKey     string
+		workers     int
+		rateLimit   int64
+		timeout     int
+		xattrs      bool
+		xattrNS     string
+		dryRun      bool
+		changeRules string
+		policyFile  string
+		maxExcluded float64
+		help        bool
 	)
 
 	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
 	flags.SetOutput(c.errStream)
 
-	flags.StringVar(&target, "target", ".", "Target directory to scan")
+	flags.Var(&targets, "target", "Target directory to scan (default \".\"), or NAME=PATH to record several roots in one manifest (can be specified multiple times)")
 	flags.StringVar(&output, "output", "-", "Output file (- for stdout)")
+	flags.StringVar(&outFormat, "manifest-format", "json", "Manifest encoding: json, or ndjson with one entry per line")
+	flags.StringVar(&compress, "compress", "none", "Manifest compression: none, gzip or zstd")
+	flags.StringVar(&hashName, "hash", string(hash.DefaultAlgorithm), "Hash algorithm for file contents: sha256, sha512, sha3-256 or blake2b")
 	flags.StringVar(&s3Bucket, "s3-bucket", "", "S3 bucket for manifest storage")
 	flags.StringVar(&s3Region, "s3-region", "", "AWS region (uses default if not specified)")
 	flags.StringVar(&basePath, "base-path", "development", "Base path for S3 (e.g., production, staging, development)")
 	flags.StringVar(&appName, "app-name", "", "Application name for S3 versioning")
 	flags.StringVar(&format, "format", "text", "Output format (text|json)")
+	flags.StringVar(&signKey, "sign-key", "", "Ed25519 private key file used to sign the manifest")
 	flags.IntVar(&workers, "workers", 0, "Number of worker threads (0 = auto detect, capped at CPU count)")
 	flags.Int64Var(&rateLimit, "rate-limit", 0, "Rate limit in bytes per second (0 = no limit)")
 	flags.IntVar(&timeout, "timeout", 300, "Timeout in seconds (default: 300)")
+	flags.BoolVar(&xattrs, "xattrs", false, "Record a digest of extended attributes (capabilities, SELinux labels, ACLs) per entry")
+	flags.StringVar(&xattrNS, "xattr-namespaces", strings.Join(hash.DefaultXattrNamespaces, ","), "Comma-separated xattr namespaces recorded with -xattrs")
+	flags.BoolVar(&dryRun, "dry-run", false, "Walk the tree without hashing and report what each exclude pattern removes")
+	flags.StringVar(&changeRules, "change-rules", "", "JSON file of per-path change rules, embedded in the manifest and applied by verify")
+	flags.StringVar(&policyFile, "policy", "", "JSON file with the exclude policy enforced before writing the manifest")
+	flags.Float64Var(&maxExcluded, "max-excluded", 0, "Fail if more than this fraction of files (0.0-1.0) is not recorded (0 = no limit)")
 	flags.BoolVar(&help, "help", false, "Show help for generate command")
 	flags.BoolVar(&help, "h", false, "Show help for generate command")
 
-	flags.Var(&excludes, "exclude", "Exclude pattern (can be specified multiple times)")
+	flags.Var(&includes, "include", "Include pattern; only matching entries are recorded (can be specified multiple times)")
+	flags.Var(&excludes, "exclude", "Exclude pattern, takes precedence over -include (can be specified multiple times)")
+	flags.Var(&excludeFiles, "exclude-from", "File of gitignore-style exclude rules, embedded in the manifest (can be specified multiple times)")
+	flags.Var(&forbidden, "forbid-exclude", "Fail if an exclude pattern or rule leaves out paths matching this pattern (can be specified multiple times)")
+	flags.Var(&required, "require", "Fail if this path is not recorded in the manifest (can be specified multiple times)")
+	flags.Var(&levels, "level", "Monitoring level GLOB=hash|metadata|exists; the first matching glob applies (can be specified multiple times)")
+	flags.Var(&appendOnly, "append-only", "Glob of files that may only grow, such as logs (can be specified multiple times)")
+	flags.Var(&rotateSuffixes, "rotate-suffix", "Suffix -append-only files are renamed with on rotation, e.g. .1 (can be specified multiple times)")
 
 	err := flags.Parse(args[2:])
 	if err != nil {
@@ -179,6 +336,104 @@ func (c *CLI) runGenerate(args []string) int {
 		fmt.Fprintf(c.errStream, "Warning: rate-limit %d is very low (< 1KB/s), this may be too restrictive\n", rateLimit)
 	}
 
+	// Several targets are named roots; a single one is a directory
+	target, roots, err := parseTargets(targets, len(targets) > 1)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+
+	manifestFormat, err := manifest.ParseFormat(outFormat)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+	compression, err := manifest.ParseCompression(compress)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+	encoding := manifest.Encoding{Format: manifestFormat, Compression: compression}
+	algorithm, err := hash.ParseAlgorithm(hashName)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+
+	// Reject malformed patterns instead of silently matching nothing
+	for _, pattern := range slices.Concat(includes, excludes) {
+		if err := glob.Validate(pattern); err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+	}
+
+	// Resolve exclude files now; verify uses the rules stored in the manifest
+	var rules []hash.Rule
+	for _, path := range excludeFiles {
+		fileRules, err := loadExcludeRules(path)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+		rules = append(rules, fileRules...)
+	}
+	filter := hash.Filter{Includes: includes, Excludes: excludes, Rules: rules}
+
+	var appendRules []hash.AppendRule
+	for _, pattern := range appendOnly {
+		rule := hash.AppendRule{Path: pattern, Rotate: rotateSuffixes}
+		if err := rule.Validate(); err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+		appendRules = append(appendRules, rule)
+	}
+	if len(rotateSuffixes) > 0 && len(appendRules) == 0 {
+		c.outputGenerateError(fmt.Errorf("-rotate-suffix requires -append-only"), format)
+		return ExitCodeFail
+	}
+
+	var levelRules []manifest.LevelRule
+	for _, arg := range levels {
+		rule, err := manifest.ParseLevelRule(arg)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+		levelRules = append(levelRules, rule)
+	}
+
+	var changes []manifest.ChangeRule
+	if changeRules != "" {
+		changes, err = manifest.LoadChangeRules(changeRules)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+	}
+
+	// Check the exclude policy before hashing anything
+	pol, err := loadPolicy(policyFile, maxExcluded, forbidden, required)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+	if err := pol.CheckFilter(filter); err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+
+	// Load the signing key before doing any work so a bad key fails fast
+	var privateKey ed25519.PrivateKey
+	if signKey != "" {
+		privateKey, err = manifest.LoadPrivateKey(signKey)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+	}
+
 	// Create context with signal handling
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -190,6 +445,28 @@ func (c *CLI) runGenerate(args []string) int {
 		defer cancel()
 	}
 
+	if dryRun {
+		if len(roots) > 0 {
+			c.outputGenerateError(fmt.Errorf("-dry-run is not supported with multiple roots"), format)
+			return ExitCodeFail
+		}
+		return c.runGenerateDryRun(ctx, target, filter, format)
+	}
+
+	// Counting what is left out needs a walk of the whole tree
+	var audit *hash.Audit
+	if pol.MaxExcludedFraction > 0 {
+		if len(roots) > 0 {
+			c.outputGenerateError(fmt.Errorf("-max-excluded is not supported with multiple roots"), format)
+			return ExitCodeFail
+		}
+		audit, err = hash.AuditDirectory(ctx, target, filter)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+	}
+
 	// Generate manifest
 	var generator *manifest.Generator
 	if rateLimit > 0 {
@@ -198,12 +475,45 @@ func (c *CLI) runGenerate(args []string) int {
 		generator = manifest.NewGenerator(workers)
 	}
 
-	m, err := generator.Generate(ctx, target, excludes)
+	generator.SetIncludes(includes)
+	generator.SetExcludeRules(rules)
+	generator.SetChangeRules(changes)
+	generator.SetAppendOnly(appendRules)
+	generator.SetLevels(levelRules)
+	generator.SetHashAlgorithm(algorithm)
+
+	if xattrs {
+		namespaces, err := parseXattrNamespaces(xattrNS)
+		if err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+		generator.SetXattrNamespaces(namespaces)
+	}
+
+	var m *manifest.Manifest
+	if len(roots) > 0 {
+		m, err = generator.GenerateRoots(ctx, roots, excludes)
+	} else {
+		m, err = generator.Generate(ctx, target, excludes)
+	}
 	if err != nil {
 		c.outputGenerateError(err, format)
 		return ExitCodeFail
 	}
 
+	if err := pol.CheckResult(m, audit); err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+
+	if privateKey != nil {
+		if err := m.Sign(privateKey); err != nil {
+			c.outputGenerateError(err, format)
+			return ExitCodeFail
+		}
+	}
+
 	// Handle output
 	var outputPath string
 	var s3KeyUsed string
@@ -218,7 +528,7 @@ func (c *CLI) runGenerate(args []string) int {
 
 		if appName != "" {
 			// Use versioning
-			key, err := s3Storage.UploadWithVersioning(ctx, basePath, appName, m)
+			key, err := s3Storage.UploadWithVersioning(ctx, basePath, appName, m, encoding)
 			if err == nil {
 				s3KeyUsed = key
 			}
@@ -233,14 +543,14 @@ func (c *CLI) runGenerate(args []string) int {
 		}
 	} else if output == "-" {
 		// Output to stdout
-		err = manifest.SaveToWriter(m, c.outStream)
+		err = manifest.SaveToWriterEncoded(m, c.outStream, encoding)
 		if err != nil {
 			fmt.Fprintf(c.errStream, "Error: Failed to write manifest: %v\n", err)
 			return ExitCodeFail
 		}
 	} else {
 		// Output to file
-		err = manifest.SaveToFile(m, output)
+		err = manifest.SaveToFileEncoded(m, output, encoding)
 		if err != nil {
 			fmt.Fprintf(c.errStream, "Error: Failed to save manifest: %v\n", err)
 			return ExitCodeFail
@@ -248,8 +558,38 @@ func (c *CLI) runGenerate(args []string) int {
 		outputPath = output
 	}
 
-	// Format success result
-	c.outputGenerateSuccess(m, outputPath, s3KeyUsed, format)
+	// Format success result; stdout is kept to the manifest when it is
+	// written there, so it can be piped to another command
+	w := c.outStream
+	if s3Bucket == "" && output == "-" {
+		w = c.errStream
+	}
+	c.outputGenerateSuccess(w, m, outputPath, s3KeyUsed, format)
+
+	return ExitCodeOK
+}
+
+// runGenerateDryRun reports what the patterns would exclude without writing a manifest
+func (c *CLI) runGenerateDryRun(ctx context.Context, target string, filter hash.Filter, format string) int {
+	audit, err := hash.AuditDirectory(ctx, target, filter)
+	if err != nil {
+		c.outputGenerateError(err, format)
+		return ExitCodeFail
+	}
+
+	result := &output.AuditResult{
+		Success:   true,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Target:    target,
+		Audit:     audit,
+		Warnings:  audit.Warnings(),
+	}
+
+	formatter := output.NewFormatter(c.outStream)
+	if err := formatter.FormatAudit(result, format); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
 
 	return ExitCodeOK
 }
@@ -262,7 +602,6 @@ func (c *CLI) runVerify(args []string) int {
 		s3Region          string
 		basePath          string
 		appName           string
-		target            string
 		format            string
 		workers           int
 		rateLimit         int64
@@ -271,7 +610,16 @@ func (c *CLI) runVerify(args []string) int {
 		cacheDir          string
 		verifyProbability float64
 		debug             bool
+		ownerAdvisory     bool
+		xattrs            bool
+		scanExcluded      bool
+		scanExtensions    string
+		appendState       string
+		stream            bool
 		help              bool
+
+		trustedKeys arrayFlags
+		targets     arrayFlags
 	)
 
 	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
@@ -282,7 +630,7 @@ func (c *CLI) runVerify(args []string) int {
 	flags.StringVar(&s3Region, "s3-region", "", "AWS region (uses default if not specified)")
 	flags.StringVar(&basePath, "base-path", "development", "Base path for S3 (e.g., production, staging, development)")
 	flags.StringVar(&appName, "app-name", "", "Application name for S3")
-	flags.StringVar(&target, "target", ".", "Target directory to verify")
+	flags.Var(&targets, "target", "Target directory to verify (default \".\"), or NAME=PATH to move a root of a multi-root manifest (can be specified multiple times)")
 	flags.StringVar(&format, "format", "text", "Output format (text|json)")
 	flags.IntVar(&workers, "workers", 0, "Number of worker threads (0 = auto detect, capped at CPU count)")
 	flags.Int64Var(&rateLimit, "rate-limit", 0, "Rate limit in bytes per second (0 = no limit)")
@@ -291,9 +639,17 @@ func (c *CLI) runVerify(args []string) int {
 	flags.StringVar(&cacheDir, "cache-dir", "", "Directory for cache file (default: system temp directory)")
 	flags.Float64Var(&verifyProbability, "verify-probability", 0.1, "Probability of hash verification even with cache hit (0.0-1.0, default: 0.1)")
 	flags.BoolVar(&debug, "debug", false, "Enable debug output for cache behavior")
+	flags.BoolVar(&ownerAdvisory, "owner-advisory", false, "Report uid/gid changes as warnings instead of failures")
+	flags.BoolVar(&xattrs, "xattrs", false, "Require the manifest to record extended attributes")
+	flags.BoolVar(&scanExcluded, "scan-excluded", false, "Also scan excluded paths for executable files, without hashing them")
+	flags.StringVar(&scanExtensions, "scan-extensions", strings.Join(hash.ScanExtensions, ","), "Comma-separated extensions flagged by -scan-excluded")
+	flags.StringVar(&appendState, "append-state", "", "File keeping the state of -append-only files between runs")
+	flags.BoolVar(&stream, "stream", false, "Compare the tree with the manifest while walking it, in constant memory")
 	flags.BoolVar(&help, "help", false, "Show help for verify command")
 	flags.BoolVar(&help, "h", false, "Show help for verify command")
 
+	flags.Var(&trustedKeys, "trusted-key", "Ed25519 public key file; the manifest must be signed by one of them (can be specified multiple times)")
+
 	err := flags.Parse(args[2:])
 	if err != nil {
 		return ExitCodeFail
@@ -313,6 +669,11 @@ func (c *CLI) runVerify(args []string) int {
 		return ExitCodeFail
 	}
 
+	if stream && useCache {
+		c.outputVerifyError(fmt.Errorf("-stream cannot be combined with -use-cache"), format)
+		return ExitCodeFail
+	}
+
 	// Validate rate limit
 	if rateLimit < 0 {
 		fmt.Fprintf(c.errStream, "Error: rate-limit cannot be negative\n")
@@ -322,6 +683,17 @@ func (c *CLI) runVerify(args []string) int {
 		fmt.Fprintf(c.errStream, "Warning: rate-limit %d is very low (< 1KB/s), this may be too restrictive\n", rateLimit)
 	}
 
+	// Load trusted keys
+	publicKeys := make([]ed25519.PublicKey, 0, len(trustedKeys))
+	for _, keyPath := range trustedKeys {
+		pub, err := manifest.LoadPublicKey(keyPath)
+		if err != nil {
+			c.outputVerifyError(err, format)
+			return ExitCodeFail
+		}
+		publicKeys = append(publicKeys, pub)
+	}
+
 	// Create context with signal handling
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -333,8 +705,11 @@ func (c *CLI) runVerify(args []string) int {
 		defer cancel()
 	}
 
-	// Load manifest
-	var m *manifest.Manifest
+	// Load manifest; with -stream only its header is held in memory
+	var (
+		m  *manifest.Manifest
+		mf *manifest.ManifestFile
+	)
 
 	if s3Bucket != "" {
 		// Load from S3
@@ -344,11 +719,14 @@ func (c *CLI) runVerify(args []string) int {
 			return ExitCodeFail
 		}
 
-		if appName != "" {
+		switch {
+		case appName == "":
+			err = fmt.Errorf("-app-name must be specified with -s3-bucket")
+		case stream:
+			mf, err = downloadManifestFile(ctx, s3Storage, basePath, appName)
+		default:
 			// Load manifest
 			m, err = s3Storage.DownloadManifest(ctx, basePath, appName)
-		} else {
-			err = fmt.Errorf("-app-name must be specified with -s3-bucket")
 		}
 
 		if err != nil {
@@ -357,7 +735,16 @@ func (c *CLI) runVerify(args []string) int {
 		}
 	} else if manifestPath != "" {
 		// Load from file
-		m, err = manifest.LoadFromFile(manifestPath)
+		switch {
+		case stream && len(publicKeys) > 0:
+			// The signature check and the walk read the entries separately;
+			// a private copy keeps them on the same bytes
+			mf, err = manifest.SnapshotManifestFile(manifestPath)
+		case stream:
+			mf, err = manifest.OpenManifestFile(manifestPath)
+		default:
+			m, err = manifest.LoadFromFile(manifestPath)
+		}
 		if err != nil {
 			c.outputVerifyError(err, format)
 			return ExitCodeFail
@@ -367,8 +754,65 @@ func (c *CLI) runVerify(args []string) int {
 		c.outputVerifyError(err, format)
 		return ExitCodeFail
 	}
+	if mf != nil {
+		defer mf.Close()
+		m = mf.Header()
+	}
+
+	// Refuse unsigned or tampered manifests before hashing anything
+	if len(publicKeys) > 0 {
+		verifySignature := m.VerifySignature
+		if mf != nil {
+			verifySignature = mf.VerifySignature
+		}
+		if err := verifySignature(publicKeys...); err != nil {
+			c.outputVerifyError(err, format)
+			return ExitCodeFail
+		}
+	}
+
+	// Extended attributes are always compared when recorded; the flag only
+	// guards against a manifest generated without them
+	if xattrs && len(m.XattrNamespaces) == 0 {
+		c.outputVerifyError(fmt.Errorf("manifest does not record extended attributes (generate it with -xattrs)"), format)
+		return ExitCodeFail
+	}
+
+	// A multi-root manifest knows its directories; -target only moves roots
+	target, roots, err := parseTargets(targets, len(m.Roots) > 0)
+	if err != nil {
+		if len(m.Roots) > 0 {
+			err = fmt.Errorf("manifest has roots %s; use -target NAME=PATH to change their directories: %w", strings.Join(m.RootNames(), ", "), err)
+		} else {
+			err = fmt.Errorf("manifest has a single target: %w", err)
+		}
+		c.outputVerifyError(err, format)
+		return ExitCodeFail
+	}
+	rootPaths := make(map[string]string, len(roots))
+	for _, root := range roots {
+		rootPaths[root.Name] = root.Path
+	}
+
+	m.SetVerifyOptions(manifest.VerifyOptions{OwnerAdvisory: ownerAdvisory, AppendState: appendState, RootPaths: rootPaths})
+
+	// Excluded paths are scanned before hashing so a scan error fails fast
+	var findings []hash.Finding
+	if scanExcluded {
+		extensions, err := parseScanExtensions(scanExtensions)
+		if err != nil {
+			c.outputVerifyError(err, format)
+			return ExitCodeFail
+		}
+		findings, err = m.ScanExcluded(ctx, target, extensions)
+		if err != nil {
+			c.outputVerifyError(err, format)
+			return ExitCodeFail
+		}
+	}
 
 	// Verify integrity
+	var report *manifest.VerificationReport
 	if useCache {
 		// Use cache directory (default to system temp directory if not specified)
 		cacheDirToUse := cacheDir
@@ -378,121 +822,653 @@ func (c *CLI) runVerify(args []string) int {
 
 		// Use cache with probabilistic verification
 		if rateLimit > 0 {
-			err = m.VerifyWithCacheAndRateLimit(ctx, target, cacheDirToUse, basePath, appName, workers, rateLimit, verifyProbability, debug)
+			report, err = m.VerifyWithCacheAndRateLimit(ctx, target, cacheDirToUse, basePath, appName, workers, rateLimit, verifyProbability, debug)
+		} else {
+			report, err = m.VerifyWithCache(ctx, target, cacheDirToUse, basePath, appName, workers, verifyProbability, debug)
+		}
+	} else if mf != nil {
+		// Streaming mode: compare while walking in path order
+		if rateLimit > 0 {
+			report, err = mf.VerifyWithRateLimit(ctx, target, workers, rateLimit)
 		} else {
-			err = m.VerifyWithCache(ctx, target, cacheDirToUse, basePath, appName, workers, verifyProbability, debug)
+			report, err = mf.Verify(ctx, target, workers)
+		}
+		if errors.Is(err, hash.ErrTooManyLinkGroups) {
+			err = fmt.Errorf("%w; verify without -stream", err)
 		}
 	} else {
 		// Normal verify mode: calculate all hashes
 		if rateLimit > 0 {
-			err = m.VerifyWithRateLimit(ctx, target, workers, rateLimit)
+			report, err = m.VerifyWithRateLimit(ctx, target, workers, rateLimit)
 		} else {
-			err = m.Verify(ctx, target, workers)
+			report, err = m.Verify(ctx, target, workers)
 		}
 	}
 
 	// Output result
-	c.outputVerifyResult(err, m, format)
+	c.outputVerifyResult(report, findings, err, format)
 
-	if err != nil {
+	if err != nil || len(findings) > 0 {
 		return ExitCodeFail
 	}
 
 	return ExitCodeOK
 }
 
-// Output helper functions
-func (c *CLI) outputGenerateSuccess(m *manifest.Manifest, outputPath, s3Key, format string) {
-	result := &output.GenerationResult{
-		Success:    true,
-		Timestamp:  time.Now().UTC().Format(time.RFC3339),
-		FileCount:  m.FileCount,
-		OutputPath: outputPath,
-		S3Key:      s3Key,
-	}
-
-	formatter := output.NewFormatter(c.outStream)
-	formatter.FormatGeneration(result, format)
-}
-
-func (c *CLI) outputGenerateError(err error, format string) {
-	result := &output.GenerationResult{
-		Success:   false,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Error:     err.Error(),
-	}
+// runDiff handles the diff command
+func (c *CLI) runDiff(args []string) int {
+	var (
+		s3Region string
+		format   string
+		timeout  int
+		help     bool
+	)
 
-	formatter := output.NewFormatter(c.errStream)
-	formatter.FormatGeneration(result, format)
-}
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
 
-func (c *CLI) outputVerifyResult(err error, m *manifest.Manifest, format string) {
-	result := &output.VerificationResult{
-		Success:   err == nil,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-	}
+	flags.StringVar(&s3Region, "s3-region", "", "AWS region for s3:// manifests (uses default if not specified)")
+	flags.StringVar(&format, "format", "text", "Output format (text|json)")
+	flags.IntVar(&timeout, "timeout", 300, "Timeout in seconds (default: 300)")
+	flags.BoolVar(&help, "help", false, "Show help for diff command")
+	flags.BoolVar(&help, "h", false, "Show help for diff command")
 
+	err := flags.Parse(args[2:])
 	if err != nil {
-		result.Error = err.Error()
-		result.Details = parseVerificationError(err)
-	} else {
-		result.Message = "All files verified successfully"
-		result.Details = &output.VerificationDetails{
-			TotalFiles:    m.FileCount,
-			VerifiedFiles: m.FileCount,
-		}
+		return ExitCodeFail
 	}
 
-	var stream = c.outStream
-	if !result.Success {
-		stream = c.errStream
+	if help {
+		c.printDiffHelp(flags)
+		return ExitCodeOK
 	}
 
-	formatter := output.NewFormatter(stream)
-	formatter.Format(result, format)
-}
-
-func (c *CLI) outputVerifyError(err error, format string) {
-	result := &output.VerificationResult{
-		Success:   false,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
-		Error:     err.Error(),
+	if flags.NArg() != 2 {
+		c.outputDiffError(fmt.Errorf("diff requires exactly two manifests: OLD NEW"), format)
+		return ExitCodeFail
+	}
+	oldSource, newSource := flags.Arg(0), flags.Arg(1)
+	if oldSource == "-" && newSource == "-" {
+		c.outputDiffError(fmt.Errorf("only one manifest can be read from stdin"), format)
+		return ExitCodeFail
 	}
 
-	formatter := output.NewFormatter(c.errStream)
-	formatter.Format(result, format)
-}
+	// Create context with signal handling
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-// parseVerificationError extracts details from verification errors
-func parseVerificationError(err error) *output.VerificationDetails {
-	if err == nil {
-		return nil
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
 	}
 
-	errStr := err.Error()
-	details := &output.VerificationDetails{
-		ModifiedFiles: []string{},
-		DeletedFiles:  []string{},
-		AddedFiles:    []string{},
-	}
+	// Entries are compared as they are read, so huge manifests need not fit in memory
+	oldManifest, err := c.openManifestFile(ctx, oldSource, s3Region)
+	if err != nil {
+		c.outputDiffError(err, format)
+		return ExitCodeFail
+	}
+	defer oldManifest.Close()
+	newManifest, err := c.openManifestFile(ctx, newSource, s3Region)
+	if err != nil {
+		c.outputDiffError(err, format)
+		return ExitCodeFail
+	}
+	defer newManifest.Close()
+
+	diff, err := manifest.DiffFiles(oldManifest, newManifest)
+	if err != nil {
+		c.outputDiffError(err, format)
+		return ExitCodeFail
+	}
+	result := &output.DiffResult{
+		Success:   true,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Old:       oldSource,
+		New:       newSource,
+		Identical: diff.Identical(),
+		Details:   diff,
+	}
+
+	formatter := output.NewFormatter(c.outStream)
+	if err := formatter.FormatDiff(result, format); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	return ExitCodeOK
+}
+
+// runInspect handles the inspect command
+func (c *CLI) runInspect(args []string) int {
+	var (
+		paths arrayFlags
+
+		s3Region string
+		prefix   string
+		format   string
+		timeout  int
+		summary  bool
+		patterns bool
+		totals   bool
+		help     bool
+	)
+
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+
+	flags.StringVar(&s3Region, "s3-region", "", "AWS region for s3:// manifests (uses default if not specified)")
+	flags.StringVar(&prefix, "prefix", "", "List the entries at or below this directory (\".\" for all)")
+	flags.StringVar(&format, "format", "text", "Output format (text|json)")
+	flags.IntVar(&timeout, "timeout", 300, "Timeout in seconds (default: 300)")
+	flags.BoolVar(&summary, "summary", false, "Show the manifest metadata")
+	flags.BoolVar(&patterns, "excludes", false, "Show the include and exclude patterns")
+	flags.BoolVar(&totals, "totals", false, "Show file count and size per top-level directory")
+	flags.BoolVar(&help, "help", false, "Show help for inspect command")
+	flags.BoolVar(&help, "h", false, "Show help for inspect command")
+
+	flags.Var(&paths, "path", "Look up a path relative to the target directory (can be specified multiple times)")
+
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return ExitCodeFail
+	}
+
+	if help {
+		c.printInspectHelp(flags)
+		return ExitCodeOK
+	}
+
+	if flags.NArg() != 1 {
+		c.outputInspectError(fmt.Errorf("inspect requires exactly one manifest"), format)
+		return ExitCodeFail
+	}
+	source := flags.Arg(0)
+
+	// Without a query, show what the manifest covers
+	if len(paths) == 0 && prefix == "" && !summary && !patterns && !totals {
+		summary, patterns = true, true
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	m, err := c.loadManifest(ctx, source, s3Region)
+	if err != nil {
+		c.outputInspectError(err, format)
+		return ExitCodeFail
+	}
+
+	result := &output.InspectResult{
+		Success:   true,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Source:    source,
+	}
+	if summary {
+		s := m.Summary()
+		result.Summary = &s
+	}
+	if patterns {
+		p := m.Patterns()
+		result.Patterns = &p
+	}
+	for _, p := range paths {
+		result.Lookups = append(result.Lookups, m.Lookup(p))
+	}
+	if prefix != "" {
+		result.Prefix = prefix
+		result.Entries = m.Entries(prefix)
+	}
+	if totals {
+		result.Totals = m.TopLevelTotals()
+	}
+
+	formatter := output.NewFormatter(c.outStream)
+	if err := formatter.FormatInspect(result, format); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	return ExitCodeOK
+}
+
+// runExplain handles the explain command
+func (c *CLI) runExplain(args []string) int {
+	var (
+		includes     arrayFlags
+		excludes     arrayFlags
+		excludeFiles arrayFlags
+
+		manifestPath string
+		s3Region     string
+		target       string
+		format       string
+		timeout      int
+		help         bool
+	)
+
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+
+	flags.StringVar(&manifestPath, "manifest", "", "Manifest whose patterns are used: a file, - for stdin, or s3://bucket/base-path/app-name")
+	flags.StringVar(&s3Region, "s3-region", "", "AWS region for s3:// manifests (uses default if not specified)")
+	flags.StringVar(&target, "target", "", "Target directory used to tell directories from files (optional)")
+	flags.StringVar(&format, "format", "text", "Output format (text|json)")
+	flags.IntVar(&timeout, "timeout", 300, "Timeout in seconds (default: 300)")
+	flags.BoolVar(&help, "help", false, "Show help for explain command")
+	flags.BoolVar(&help, "h", false, "Show help for explain command")
+
+	flags.Var(&includes, "include", "Include pattern to explain against instead of a manifest (can be specified multiple times)")
+	flags.Var(&excludes, "exclude", "Exclude pattern to explain against instead of a manifest (can be specified multiple times)")
+	flags.Var(&excludeFiles, "exclude-from", "Exclude file to explain against instead of a manifest (can be specified multiple times)")
+
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return ExitCodeFail
+	}
+
+	if help {
+		c.printExplainHelp(flags)
+		return ExitCodeOK
+	}
+
+	if flags.NArg() == 0 {
+		c.outputExplainError(fmt.Errorf("explain requires at least one path"), format)
+		return ExitCodeFail
+	}
+
+	patternsGiven := len(includes) > 0 || len(excludes) > 0 || len(excludeFiles) > 0
+	if manifestPath != "" && patternsGiven {
+		c.outputExplainError(fmt.Errorf("-manifest cannot be combined with -include, -exclude or -exclude-from"), format)
+		return ExitCodeFail
+	}
+
+	var m *manifest.Manifest
+	if manifestPath != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+		}
+
+		m, err = c.loadManifest(ctx, manifestPath, s3Region)
+		if err != nil {
+			c.outputExplainError(err, format)
+			return ExitCodeFail
+		}
+	} else {
+		for _, pattern := range slices.Concat(includes, excludes) {
+			if err := glob.Validate(pattern); err != nil {
+				c.outputExplainError(err, format)
+				return ExitCodeFail
+			}
+		}
+		m = &manifest.Manifest{Includes: includes, Excludes: excludes}
+		for _, path := range excludeFiles {
+			rules, err := loadExcludeRules(path)
+			if err != nil {
+				c.outputExplainError(err, format)
+				return ExitCodeFail
+			}
+			m.ExcludeRules = append(m.ExcludeRules, rules...)
+		}
+	}
+
+	result := &output.ExplainResult{
+		Success:   true,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, path := range flags.Args() {
+		// A trailing slash marks a directory, as in exclude files
+		isDir := strings.HasSuffix(path, "/")
+		if !isDir && target != "" {
+			if info, err := os.Lstat(filepath.Join(target, path)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		result.Explanations = append(result.Explanations, m.Explain(path, isDir))
+	}
+
+	formatter := output.NewFormatter(c.outStream)
+	if err := formatter.FormatExplain(result, format); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	return ExitCodeOK
+}
+
+// runRoot handles the root command
+func (c *CLI) runRoot(args []string) int {
+	var (
+		s3Region string
+		format   string
+		timeout  int
+		help     bool
+	)
+
+	flags := flag.NewFlagSet("root", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+
+	flags.StringVar(&s3Region, "s3-region", "", "AWS region for s3:// manifests (uses default if not specified)")
+	flags.StringVar(&format, "format", "text", "Output format (text|json)")
+	flags.IntVar(&timeout, "timeout", 300, "Timeout in seconds (default: 300)")
+	flags.BoolVar(&help, "help", false, "Show help for root command")
+	flags.BoolVar(&help, "h", false, "Show help for root command")
+
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return ExitCodeFail
+	}
+
+	if help {
+		c.printRootHelp(flags)
+		return ExitCodeOK
+	}
+
+	if flags.NArg() != 1 {
+		c.outputRootError(fmt.Errorf("root requires exactly one manifest"), format)
+		return ExitCodeFail
+	}
+	source := flags.Arg(0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	m, err := c.loadManifest(ctx, source, s3Region)
+	if err != nil {
+		c.outputRootError(err, format)
+		return ExitCodeFail
+	}
+
+	// Manifests from older versions have no tree; compute it from the entries
+	tree, err := m.ComputeMerkle()
+	if err != nil {
+		c.outputRootError(fmt.Errorf("failed to compute Merkle root: %w", err), format)
+		return ExitCodeFail
+	}
+	if m.Merkle != nil && m.Merkle.Root != tree.Root {
+		c.outputRootError(fmt.Errorf("recorded Merkle root %s does not match the entries (%s)", m.Merkle.Root, tree.Root), format)
+		return ExitCodeFail
+	}
+
+	result := &output.RootResult{
+		Success:       true,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Source:        source,
+		Root:          tree.Root,
+		HashAlgorithm: m.HashAlgorithm.OrDefault(),
+		Recorded:      m.Merkle != nil,
+	}
+
+	formatter := output.NewFormatter(c.outStream)
+	if err := formatter.FormatRoot(result, format); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	return ExitCodeOK
+}
+
+// loadManifest loads a manifest from a file, from stdin ("-") or from
+// S3 ("s3://bucket/base-path/app-name")
+func (c *CLI) loadManifest(ctx context.Context, source, s3Region string) (*manifest.Manifest, error) {
+	if source == "-" {
+		return manifest.LoadFromReader(c.inStream)
+	}
+
+	location, ok := strings.CutPrefix(source, "s3://")
+	if !ok {
+		return manifest.LoadFromFile(source)
+	}
+
+	s3Storage, basePath, appName, err := openS3Source(ctx, source, location, s3Region)
+	if err != nil {
+		return nil, err
+	}
+	return s3Storage.DownloadManifest(ctx, basePath, appName)
+}
+
+// openManifestFile opens a manifest named like for loadManifest for
+// streaming. Manifests from stdin or S3 are copied to a temporary file first.
+func (c *CLI) openManifestFile(ctx context.Context, source, s3Region string) (*manifest.ManifestFile, error) {
+	if source == "-" {
+		return spoolManifestFile(func(w io.Writer) error {
+			if _, err := io.Copy(w, c.inStream); err != nil {
+				return fmt.Errorf("failed to read manifest from stdin: %w", err)
+			}
+			return nil
+		})
+	}
+
+	location, ok := strings.CutPrefix(source, "s3://")
+	if !ok {
+		return manifest.OpenManifestFile(source)
+	}
+
+	s3Storage, basePath, appName, err := openS3Source(ctx, source, location, s3Region)
+	if err != nil {
+		return nil, err
+	}
+	return downloadManifestFile(ctx, s3Storage, basePath, appName)
+}
+
+// openS3Source parses an s3://bucket/base-path/app-name manifest location
+func openS3Source(ctx context.Context, source, location, s3Region string) (*storage.S3Storage, string, string, error) {
+	parts := strings.Split(location, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, "", "", fmt.Errorf("invalid S3 manifest %q: expected s3://bucket/base-path/app-name", source)
+	}
+	basePath, err := validateIdentifier(parts[1], "base-path")
+	if err != nil {
+		return nil, "", "", err
+	}
+	appName, err := validateIdentifier(parts[2], "app-name")
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	s3Storage, err := storage.NewS3Storage(ctx, parts[0], s3Region)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return s3Storage, basePath, appName, nil
+}
+
+// downloadManifestFile downloads a manifest from S3 into a temporary file and
+// opens it for streaming
+func downloadManifestFile(ctx context.Context, s3Storage *storage.S3Storage, basePath, appName string) (*manifest.ManifestFile, error) {
+	return spoolManifestFile(func(w io.Writer) error {
+		return s3Storage.DownloadManifestTo(ctx, basePath, appName, w)
+	})
+}
+
+// spoolManifestFile writes a manifest into a temporary file and opens it for
+// streaming. The file is removed right away; the open descriptor keeps it
+// readable.
+func spoolManifestFile(write func(io.Writer) error) (*manifest.ManifestFile, error) {
+	tmp, err := os.CreateTemp("", "kekkai-manifest-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary manifest file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write temporary manifest file: %w", closeErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest.OpenManifestFile(tmp.Name())
+}
+
+// runKeygen handles the keygen command
+func (c *CLI) runKeygen(args []string) int {
+	var (
+		privateKeyPath string
+		publicKeyPath  string
+		help           bool
+	)
+
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	flags.SetOutput(c.errStream)
+
+	flags.StringVar(&privateKeyPath, "private-key", "kekkai.key", "Output file for the private signing key (kept on the deploy server)")
+	flags.StringVar(&publicKeyPath, "public-key", "kekkai.pub", "Output file for the public key (distributed to verifying servers)")
+	flags.BoolVar(&help, "help", false, "Show help for keygen command")
+	flags.BoolVar(&help, "h", false, "Show help for keygen command")
+
+	err := flags.Parse(args[2:])
+	if err != nil {
+		return ExitCodeFail
+	}
+
+	if help {
+		c.printKeygenHelp(flags)
+		return ExitCodeOK
+	}
 
-	// Parse error message to extract file changes
-	lines := strings.SplitSeq(errStr, "\n")
-	for line := range lines {
-		line = strings.TrimSpace(line)
-		if after, ok := strings.CutPrefix(line, "modified:"); ok {
-			file := after
-			details.ModifiedFiles = append(details.ModifiedFiles, strings.TrimSpace(file))
-		} else if after, ok := strings.CutPrefix(line, "deleted:"); ok {
-			file := after
-			details.DeletedFiles = append(details.DeletedFiles, strings.TrimSpace(file))
-		} else if after, ok := strings.CutPrefix(line, "added:"); ok {
-			file := after
-			details.AddedFiles = append(details.AddedFiles, strings.TrimSpace(file))
+	pub, priv, err := manifest.GenerateKeyPair()
+	if err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	if err := manifest.SaveKeyPair(pub, priv, privateKeyPath, publicKeyPath); err != nil {
+		fmt.Fprintf(c.errStream, "Error: %v\n", err)
+		return ExitCodeFail
+	}
+
+	fmt.Fprintln(c.outStream, "✓ Key pair generated successfully")
+	fmt.Fprintf(c.outStream, "  Private Key: %s\n", privateKeyPath)
+	fmt.Fprintf(c.outStream, "  Public Key: %s\n", publicKeyPath)
+	fmt.Fprintf(c.outStream, "  Key ID: %s\n", manifest.KeyID(pub))
+
+	return ExitCodeOK
+}
+
+// Output helper functions
+func (c *CLI) outputGenerateSuccess(w io.Writer, m *manifest.Manifest, outputPath, s3Key, format string) {
+	result := &output.GenerationResult{
+		Success:    true,
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		FileCount:  m.FileCount,
+		OutputPath: outputPath,
+		S3Key:      s3Key,
+	}
+
+	formatter := output.NewFormatter(w)
+	formatter.FormatGeneration(result, format)
+}
+
+func (c *CLI) outputGenerateError(err error, format string) {
+	result := &output.GenerationResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	}
+
+	formatter := output.NewFormatter(c.errStream)
+	formatter.FormatGeneration(result, format)
+}
+
+func (c *CLI) outputVerifyResult(report *manifest.VerificationReport, findings []hash.Finding, err error, format string) {
+	result := &output.VerificationResult{
+		Success:   err == nil,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Details:   output.NewVerificationDetails(report),
+		Findings:  findings,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		if report != nil {
+			// The details already list every change
+			result.Error = manifest.ErrIntegrityCheckFailed.Error()
 		}
+	} else {
+		result.Message = "All files verified successfully"
+	}
+
+	var stream = c.outStream
+	if !result.Success || len(result.Findings) > 0 {
+		stream = c.errStream
+	}
+
+	formatter := output.NewFormatter(stream)
+	formatter.Format(result, format)
+}
+
+func (c *CLI) outputVerifyError(err error, format string) {
+	result := &output.VerificationResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	}
+
+	formatter := output.NewFormatter(c.errStream)
+	formatter.Format(result, format)
+}
+
+func (c *CLI) outputDiffError(err error, format string) {
+	result := &output.DiffResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	}
+
+	formatter := output.NewFormatter(c.errStream)
+	formatter.FormatDiff(result, format)
+}
+
+func (c *CLI) outputInspectError(err error, format string) {
+	result := &output.InspectResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	}
+
+	formatter := output.NewFormatter(c.errStream)
+	formatter.FormatInspect(result, format)
+}
+
+func (c *CLI) outputExplainError(err error, format string) {
+	result := &output.ExplainResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
+	}
+
+	formatter := output.NewFormatter(c.errStream)
+	formatter.FormatExplain(result, format)
+}
+
+func (c *CLI) outputRootError(err error, format string) {
+	result := &output.RootResult{
+		Success:   false,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Error:     err.Error(),
 	}
 
-	return details
+	formatter := output.NewFormatter(c.errStream)
+	formatter.FormatRoot(result, format)
 }
 
 // Help functions
@@ -504,6 +1480,11 @@ Usage: kekkai <command> [options]
 Commands:
   generate    Generate a manifest of file hashes
   verify      Verify files against a manifest
+  diff        Compare two manifests
+  inspect     Show what a manifest records
+  explain     Show why paths are included or excluded
+  root        Print the Merkle root of a manifest
+  keygen      Generate an Ed25519 key pair for manifest signing
   version     Show version information
   help        Show this help message
 
@@ -539,11 +1520,101 @@ Examples:
     --exclude "cache/**" \
     --output manifest.json
 
+  # Monitor only part of a large root
+  kekkai generate \
+    --target /var/www \
+    --include "app/**" \
+    --include "config/**" \
+    --include "public/*.php" \
+    --output manifest.json
+
+  # Exclude with a gitignore-style file (rules are embedded in the manifest)
+  kekkai generate \
+    --target /var/www/app \
+    --exclude-from .kekkaiignore \
+    --output manifest.json
+
+  # Check what the patterns exclude before generating
+  kekkai generate \
+    --target /var/www/app \
+    --exclude "storage/**" \
+    --exclude-from .kekkaiignore \
+    --dry-run
+
+  # Enforce an exclude policy in the deploy step
+  kekkai generate \
+    --target /var/www/app \
+    --exclude "storage/**" \
+    --forbid-exclude "**" \
+    --forbid-exclude "*.php" \
+    --require public/index.php \
+    --max-excluded 0.3 \
+    --output manifest.json
+
+  # Let uploads/ grow, but never accept PHP files in it
+  kekkai generate \
+    --target /var/www/app \
+    --change-rules change-rules.json \
+    --output manifest.json
+
+  # Cover several directories with one manifest
+  kekkai generate \
+    --target app=/var/www/app \
+    --target nginx=/etc/nginx/sites-enabled \
+    --exclude "app/storage/**" \
+    --output manifest.json
+
+  # Let config management rewrite .env, but not delete or chown it
+  kekkai generate \
+    --target /var/www/app \
+    --level .env=metadata \
+    --level "storage/framework/*.php=exists" \
+    --output manifest.json
+
+  # Let logs grow, but detect truncation and rewrites
+  kekkai generate \
+    --target /var/www/app \
+    --exclude "storage/**" \
+    --append-only "storage/logs/*.log" \
+    --rotate-suffix .1 \
+    --output manifest.json
+
   # Generate and upload to S3
   kekkai generate \
     --target /app \
     --s3-bucket my-manifests \
     --app-name myapp
+
+  # Generate a signed manifest
+  kekkai generate \
+    --target /app \
+    --sign-key /etc/kekkai/kekkai.key \
+    --output manifest.json
+
+  # Also track capabilities, SELinux labels and ACLs
+  kekkai generate \
+    --target /app \
+    --xattrs \
+    --output manifest.json
+
+  # Write one entry per line for trees with millions of files
+  kekkai generate \
+    --target /srv/data \
+    --manifest-format ndjson \
+    --output manifest.ndjson
+
+  # Hash with BLAKE2b; verify picks the algorithm from the manifest
+  kekkai generate \
+    --target /app \
+    --hash blake2b \
+    --output manifest.json
+
+  # Compress a large manifest before uploading it
+  kekkai generate \
+    --target /srv/monorepo \
+    --compress zstd \
+    --s3-bucket my-manifests \
+    --app-name monorepo
 `)
 }
 
@@ -573,5 +1644,157 @@ Examples:
     --manifest manifest.json \
     --target /app \
     --format json
+
+  # Require a valid signature
+  kekkai verify \
+    --manifest manifest.json \
+    --target /app \
+    --trusted-key /etc/kekkai/kekkai.pub
+
+  # Tolerate uid/gid differences between hosts
+  kekkai verify \
+    --manifest manifest.json \
+    --target /app \
+    --owner-advisory
+
+  # Also look for web shells in excluded upload directories
+  kekkai verify \
+    --manifest manifest.json \
+    --target /app \
+    --scan-excluded
+
+  # Keep checking appended log lines between runs
+  kekkai verify \
+    --manifest manifest.json \
+    --target /app \
+    --append-state /var/lib/kekkai/append-state.json
+
+  # Verify a tree with millions of files in constant memory
+  kekkai verify \
+    --manifest manifest.json \
+    --target /app \
+    --stream
+`)
+}
+
+func (c *CLI) printDiffHelp(flags *flag.FlagSet) {
+	fmt.Fprintf(c.errStream, `kekkai diff - Compare two manifests
+
+Usage: kekkai diff [options] OLD NEW
+
+OLD and NEW are each a manifest file, "-" for stdin, or
+s3://bucket/base-path/app-name for a manifest stored with -s3-bucket.
+
+Options:
+`)
+	flags.PrintDefaults()
+	fmt.Fprintf(c.errStream, `
+Examples:
+  # Preview what a new deploy changes compared with production
+  kekkai diff s3://my-manifests/production/myapp manifest.json
+
+  # Compare with a manifest piped from another command
+  kekkai generate --target /app | kekkai diff old.json -
+
+  # Machine-readable output
+  kekkai diff --format json old.json new.json
+`)
+}
+
+func (c *CLI) printInspectHelp(flags *flag.FlagSet) {
+	fmt.Fprintf(c.errStream, `kekkai inspect - Show what a manifest records
+
+Usage: kekkai inspect [options] MANIFEST
+
+MANIFEST is a manifest file, "-" for stdin, or s3://bucket/base-path/app-name.
+Without a query option, the summary and the patterns are shown.
+
+Options:
+`)
+	flags.PrintDefaults()
+	fmt.Fprintf(c.errStream, `
+Examples:
+  # Summary and exclude patterns
+  kekkai inspect manifest.json
+
+  # Is this path covered, and with which hash?
+  kekkai inspect --path config/app.php --path storage/logs/app.log manifest.json
+
+  # List everything recorded below a directory
+  kekkai inspect --prefix public s3://my-manifests/production/myapp
+
+  # Where do the files come from?
+  kekkai inspect --totals --format json manifest.json
+`)
+}
+
+func (c *CLI) printExplainHelp(flags *flag.FlagSet) {
+	fmt.Fprintf(c.errStream, `kekkai explain - Show why paths are included or excluded
+
+Usage: kekkai explain [options] PATH...
+
+Paths are relative to the target directory; a trailing slash marks a
+directory. The patterns come from -manifest, or from -include, -exclude and
+-exclude-from when checking patterns before generating a manifest.
+
+Options:
+`)
+	flags.PrintDefaults()
+	fmt.Fprintf(c.errStream, `
+Examples:
+  # Why was this file not checked?
+  kekkai explain --manifest manifest.json bootstrap/cache/packages.php
+
+  # Using the manifest stored in S3
+  kekkai explain --manifest s3://my-manifests/production/myapp storage/logs/
+
+  # Try patterns before generating
+  kekkai explain --exclude "storage/**" --exclude-from .kekkaiignore storage/app.php app/debug.log
+`)
+}
+
+func (c *CLI) printRootHelp(flags *flag.FlagSet) {
+	fmt.Fprintf(c.errStream, `kekkai root - Print the Merkle root of a manifest
+
+Usage: kekkai root [options] MANIFEST
+
+MANIFEST is a manifest file, "-" for stdin, or s3://bucket/base-path/app-name.
+The root covers the content, size, mode and type of every entry, but not
+owners or modification times, so the same build deployed to several hosts
+has the same root. The signature is not checked; use verify for that.
+
+Options:
+`)
+	flags.PrintDefaults()
+	fmt.Fprintf(c.errStream, `
+Examples:
+  # Record what was deployed
+  echo "deployed $(kekkai root manifest.json)" >> deploy.log
+
+  # Compare the manifests of two hosts
+  test "$(kekkai root web1.json)" = "$(kekkai root web2.json)"
+
+  # Root, algorithm and whether it was recorded at generate time
+  kekkai root --format json s3://my-manifests/production/myapp
+`)
+}
+
+func (c *CLI) printKeygenHelp(flags *flag.FlagSet) {
+	fmt.Fprintf(c.errStream, `kekkai keygen - Generate an Ed25519 key pair for manifest signing
+
+Usage: kekkai keygen [options]
+
+Options:
+`)
+	flags.PrintDefaults()
+	fmt.Fprintf(c.errStream, `
+Examples:
+  # Create kekkai.key and kekkai.pub in the current directory
+  kekkai keygen
+
+  # Choose output locations
+  kekkai keygen \
+    --private-key /etc/kekkai/kekkai.key \
+    --public-key /etc/kekkai/kekkai.pub
 `)
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -465,7 +466,7 @@ func TestCLIVerifyWithExcludes(t *testing.T) {
 				os.WriteFile(path, []byte("modified app"), 0644)
 			},
 			wantExit: ExitCodeFail,
-			checkMsg: "modified: app.txt",
+			checkMsg: "- app.txt (hash)",
 		},
 		{
 			name: "verify with added included file",
@@ -475,7 +476,7 @@ func TestCLIVerifyWithExcludes(t *testing.T) {
 				os.WriteFile(path, []byte("new file"), 0644)
 			},
 			wantExit: ExitCodeFail,
-			checkMsg: "added: new.txt",
+			checkMsg: "- new.txt (file)",
 		},
 	}
 
@@ -523,6 +524,1264 @@ func TestCLIVerifyWithExcludes(t *testing.T) {
 	}
 }
 
+func TestCLISignedManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keyDir := t.TempDir()
+	privPath := filepath.Join(keyDir, "kekkai.key")
+	pubPath := filepath.Join(keyDir, "kekkai.pub")
+	otherPrivPath := filepath.Join(keyDir, "other.key")
+	otherPubPath := filepath.Join(keyDir, "other.pub")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	for _, args := range [][]string{
+		{"kekkai", "keygen", "--private-key", privPath, "--public-key", pubPath},
+		{"kekkai", "keygen", "--private-key", otherPrivPath, "--public-key", otherPubPath},
+	} {
+		if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+			t.Fatalf("keygen failed: exit code %d, stderr: %s", exitCode, stderr.String())
+		}
+	}
+
+	// keygen must not overwrite existing keys
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "keygen", "--private-key", privPath, "--public-key", filepath.Join(keyDir, "new.pub")}); exitCode != ExitCodeFail {
+		t.Errorf("keygen should fail when the private key exists, got exit code %d", exitCode)
+	}
+	// An existing public key fails before a private key without a pair is written
+	newPrivPath := filepath.Join(keyDir, "new.key")
+	if exitCode := cli.Run([]string{"kekkai", "keygen", "--private-key", newPrivPath, "--public-key", pubPath}); exitCode != ExitCodeFail {
+		t.Errorf("keygen should fail when the public key exists, got exit code %d", exitCode)
+	}
+	if _, err := os.Stat(newPrivPath); !os.IsNotExist(err) {
+		t.Errorf("keygen left a private key without its public key: %v", err)
+	}
+
+	signedPath := filepath.Join(t.TempDir(), "signed.json")
+	unsignedPath := filepath.Join(t.TempDir(), "unsigned.json")
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", signedPath, "--sign-key", privPath}); exitCode != ExitCodeOK {
+		t.Fatalf("signed generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", unsignedPath}); exitCode != ExitCodeOK {
+		t.Fatalf("unsigned generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantExit int
+		wantErr  string
+	}{
+		{
+			name:     "signed manifest with trusted key",
+			args:     []string{"kekkai", "verify", "--manifest", signedPath, "--target", tempDir, "--trusted-key", pubPath},
+			wantExit: ExitCodeOK,
+		},
+		{
+			name:     "signed manifest with one of several trusted keys",
+			args:     []string{"kekkai", "verify", "--manifest", signedPath, "--target", tempDir, "--trusted-key", otherPubPath, "--trusted-key", pubPath},
+			wantExit: ExitCodeOK,
+		},
+		{
+			name:     "signed manifest with wrong key",
+			args:     []string{"kekkai", "verify", "--manifest", signedPath, "--target", tempDir, "--trusted-key", otherPubPath},
+			wantExit: ExitCodeFail,
+			wantErr:  "signature is invalid",
+		},
+		{
+			name:     "signed manifest streamed with trusted key",
+			args:     []string{"kekkai", "verify", "--manifest", signedPath, "--target", tempDir, "--trusted-key", pubPath, "--stream"},
+			wantExit: ExitCodeOK,
+		},
+		{
+			name:     "signed manifest streamed with wrong key",
+			args:     []string{"kekkai", "verify", "--manifest", signedPath, "--target", tempDir, "--trusted-key", otherPubPath, "--stream"},
+			wantExit: ExitCodeFail,
+			wantErr:  "signature is invalid",
+		},
+		{
+			name:     "unsigned manifest with trusted key",
+			args:     []string{"kekkai", "verify", "--manifest", unsignedPath, "--target", tempDir, "--trusted-key", pubPath},
+			wantExit: ExitCodeFail,
+			wantErr:  "not signed",
+		},
+		{
+			name:     "unsigned manifest without trusted key",
+			args:     []string{"kekkai", "verify", "--manifest", unsignedPath, "--target", tempDir},
+			wantExit: ExitCodeOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout.Reset()
+			stderr.Reset()
+
+			exitCode := cli.Run(tt.args)
+			if exitCode != tt.wantExit {
+				t.Errorf("Run() exit code = %v, want %v\nstderr: %s", exitCode, tt.wantExit, stderr.String())
+			}
+
+			if tt.wantErr != "" && !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("Error output should contain '%s', got: %s", tt.wantErr, stderr.String())
+			}
+		})
+	}
+
+	t.Run("tampered manifest", func(t *testing.T) {
+		data, err := os.ReadFile(signedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Attacker adds an exclude that would hide every file
+		tampered := strings.Replace(string(data), `"file_count": 1`, `"excludes": ["**"], "file_count": 1`, 1)
+		if tampered == string(data) {
+			t.Fatal("failed to tamper with manifest")
+		}
+		tamperedPath := filepath.Join(t.TempDir(), "tampered.json")
+		if err := os.WriteFile(tamperedPath, []byte(tampered), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		stdout.Reset()
+		stderr.Reset()
+		exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", tamperedPath, "--target", tempDir, "--trusted-key", pubPath})
+		if exitCode != ExitCodeFail {
+			t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+		}
+		if !strings.Contains(stderr.String(), "signature is invalid") {
+			t.Errorf("Error output should mention invalid signature, got: %s", stderr.String())
+		}
+	})
+}
+
+func TestCLIVerifyMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "index.php")
+	if err := os.WriteFile(path, []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	t.Run("mode change", func(t *testing.T) {
+		if err := os.Chmod(path, 0755|os.ModeSetuid); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(path, 0644)
+
+		stdout.Reset()
+		stderr.Reset()
+		exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir})
+		if exitCode != ExitCodeFail {
+			t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+		}
+		for _, want := range []string{"Metadata changed (1):", "- index.php (mode 0644→4755)"} {
+			if !strings.Contains(stderr.String(), want) {
+				t.Errorf("Error output should contain %q, got: %s", want, stderr.String())
+			}
+		}
+	})
+
+	t.Run("owner change", func(t *testing.T) {
+		if err := os.Chown(path, os.Getuid()+1, os.Getgid()); err != nil {
+			t.Skipf("cannot change owner: %v", err)
+		}
+		defer os.Chown(path, os.Getuid(), os.Getgid())
+
+		stdout.Reset()
+		stderr.Reset()
+		if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeFail {
+			t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+		}
+
+		stdout.Reset()
+		stderr.Reset()
+		exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--owner-advisory"})
+		if exitCode != ExitCodeOK {
+			t.Errorf("Run() exit code = %v, want ExitCodeOK\nstderr: %s", exitCode, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "Warnings (1):") {
+			t.Errorf("Output should list the owner change as a warning, got: %s", stdout.String())
+		}
+	})
+}
+
+func TestCLIVerifyScanExcluded(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "uploads/**", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "uploads/cat.gif"), []byte("GIF89a<?php system($_GET['c']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "uploads/photo.jpg"), []byte("\xff\xd8\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the flag the excluded directory is not looked at
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeOK {
+		t.Fatalf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "uploads/x.phtml"), []byte("<?php eval($_POST['x']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--scan-excluded"})
+	if exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+	}
+	for _, want := range []string{
+		"✓ Integrity check passed",
+		"✗ Suspicious files in excluded paths (1):",
+		`- uploads/x.phtml (extension .phtml, PHP open tag; excluded by "uploads/**")`,
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Error output should contain %q, got: %s", want, stderr.String())
+		}
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--scan-excluded", "--format", "json"})
+	var result struct {
+		Success  bool `json:"success"`
+		Findings []struct {
+			Path string `json:"path"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal(stderr.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stderr.String())
+	}
+	if !result.Success || len(result.Findings) != 1 || result.Findings[0].Path != "uploads/x.phtml" {
+		t.Errorf("JSON result = %+v, want success with one finding", result)
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--scan-excluded", "--scan-extensions", "php"}); exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail for a malformed extension", exitCode)
+	}
+}
+
+func TestCLIAppendOnly(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "logs/app.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte("boot\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "logs/**", "--append-only", "logs/*.log", "--rotate-suffix", ".1", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if err := os.WriteFile(logPath, []byte("boot\nmore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--append-state", statePath}); exitCode != ExitCodeOK {
+		t.Fatalf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if err := os.WriteFile(logPath, []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--append-state", statePath}); exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+	}
+	for _, want := range []string{"Append-only files violated (1):", "- logs/app.log (truncated, size 10→1)"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Error output should contain %q, got: %s", want, stderr.String())
+		}
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--rotate-suffix", ".1"}); exitCode != ExitCodeFail {
+		t.Errorf("-rotate-suffix without -append-only: exit code = %v, want ExitCodeFail", exitCode)
+	}
+}
+
+func TestCLIGenerateLevels(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, ".env"), []byte("APP_KEY=old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--level", ".env=metadata", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ".env"), []byte("APP_KEY=new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeOK {
+		t.Errorf("verify should accept the new .env content: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--level", ".env=content"}); exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+	}
+	if !strings.Contains(stderr.String(), `unknown level "content"`) {
+		t.Errorf("Error output should name the unknown level, got: %s", stderr.String())
+	}
+}
+
+func TestCLIMultipleTargets(t *testing.T) {
+	base := t.TempDir()
+	for name, content := range map[string]string{
+		"www/index.php":       "<?php // front",
+		"www/storage/app.log": "log",
+		"nginx/app.conf":      "server {}",
+	} {
+		path := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	exitCode := cli.Run([]string{"kekkai", "generate",
+		"--target", "app=" + filepath.Join(base, "www"),
+		"--target", "nginx=" + filepath.Join(base, "nginx"),
+		"--exclude", "app/storage/**",
+		"--output", manifestPath})
+	if exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(base, "nginx/app.conf"), []byte("server { listen 8080; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath}); exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "- nginx/app.conf (hash)") {
+		t.Errorf("Error output should name the root-prefixed path, got: %s", stderr.String())
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", base}); exitCode != ExitCodeFail {
+		t.Errorf("plain -target with a multi-root manifest: exit code = %v, want ExitCodeFail", exitCode)
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", "app=" + base, "--target", base}); exitCode != ExitCodeFail {
+		t.Errorf("unnamed target among several: exit code = %v, want ExitCodeFail", exitCode)
+	}
+
+	// A single NAME=PATH moves one root of a multi-root manifest
+	if err := os.WriteFile(filepath.Join(base, "nginx/app.conf"), []byte("server {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(base, "nginx"), filepath.Join(base, "nginx-moved")); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", "nginx=" + filepath.Join(base, "nginx-moved")}); exitCode != ExitCodeOK {
+		t.Errorf("verify of a moved root failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestCLISingleTargetWithEquals(t *testing.T) {
+	// A single -target is a directory even if it reads like NAME=PATH
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "conf=v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "conf=v2/site.conf"), []byte("server {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(base)
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", "conf=v2", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		Roots []json.RawMessage `json:"roots"`
+		Files []struct {
+			Path string `json:"path"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Roots) != 0 || len(m.Files) != 1 || m.Files[0].Path != "site.conf" {
+		t.Errorf("manifest roots = %s, files = %+v, want a single target with site.conf", m.Roots, m.Files)
+	}
+
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", "conf=v2"}); exitCode != ExitCodeOK {
+		t.Errorf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestCLIVerifyStream(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{
+		"index.php":      "<?php echo 'hello';",
+		"lib/util.php":   "<?php",
+		"lib.php":        "<?php // sorts before lib/",
+		"public/app.css": "body {}",
+	} {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--stream"}); exitCode != ExitCodeOK {
+		t.Fatalf("verify --stream failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "lib/util.php"), []byte("<?php system($_GET['c']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "public/app.css")); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--stream"}); exitCode != ExitCodeFail {
+		t.Errorf("Run() exit code = %v, want ExitCodeFail", exitCode)
+	}
+	for _, want := range []string{"- lib/util.php (hash)", "- public/app.css"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Error output should contain %q, got: %s", want, stderr.String())
+		}
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--stream", "--use-cache"}); exitCode != ExitCodeFail {
+		t.Errorf("-stream with -use-cache: exit code = %v, want ExitCodeFail", exitCode)
+	}
+}
+
+func TestCLIManifestFormatNDJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	jsonPath := filepath.Join(workDir, "manifest.json")
+	ndjsonPath := filepath.Join(workDir, "manifest.ndjson")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", jsonPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--manifest-format", "ndjson", "--output", ndjsonPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate --manifest-format ndjson failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	data, err := os.ReadFile(ndjsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("NDJSON manifest has %d lines, want a header, the root directory and index.php:\n%s", lines, data)
+	}
+
+	for _, args := range [][]string{
+		{"kekkai", "verify", "--manifest", ndjsonPath, "--target", tempDir},
+		{"kekkai", "verify", "--manifest", ndjsonPath, "--target", tempDir, "--stream"},
+	} {
+		if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+			t.Errorf("%v: exit code %d, stderr: %s", args, exitCode, stderr.String())
+		}
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "diff", jsonPath, ndjsonPath}); exitCode != ExitCodeOK {
+		t.Fatalf("diff failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Manifests are identical") {
+		t.Errorf("diff of the same tree in both formats should be identical, got: %s", stdout.String())
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--manifest-format", "yaml"}); exitCode != ExitCodeFail {
+		t.Errorf("--manifest-format yaml: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+}
+
+func TestCLICompressedManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	plainPath := filepath.Join(workDir, "manifest.json")
+	zstdPath := filepath.Join(workDir, "manifest.json.zst")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", plainPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--compress", "zstd", "--output", zstdPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate --compress zstd failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	for _, args := range [][]string{
+		{"kekkai", "verify", "--manifest", zstdPath, "--target", tempDir},
+		{"kekkai", "verify", "--manifest", zstdPath, "--target", tempDir, "--stream"},
+	} {
+		if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+			t.Errorf("%v: exit code %d, stderr: %s", args, exitCode, stderr.String())
+		}
+	}
+
+	// A gzip manifest piped to diff; the summary goes to stderr
+	stdout.Reset()
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--compress", "gzip"}); exitCode != ExitCodeOK {
+		t.Fatalf("generate --compress gzip failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "Manifest generated successfully") {
+		t.Errorf("summary of a compressed manifest on stdout should go to stderr, got: %s", stderr.String())
+	}
+	cli.inStream = bytes.NewReader(bytes.Clone(stdout.Bytes()))
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "diff", plainPath, "-"}); exitCode != ExitCodeOK {
+		t.Fatalf("diff failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Manifests are identical") {
+		t.Errorf("diff of a plain and a gzip manifest of the same tree should be identical, got: %s", stdout.String())
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--compress", "bzip2"}); exitCode != ExitCodeFail {
+		t.Errorf("--compress bzip2: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+}
+
+func TestCLIGenerateStdout(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(t.TempDir(), "old.json")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cli := NewCLI(stdout, stderr)
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", oldPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	for _, format := range []string{"json", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			// The manifest alone goes to stdout, as with kekkai generate > manifest.json
+			stdout.Reset()
+			stderr.Reset()
+			if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--manifest-format", format}); exitCode != ExitCodeOK {
+				t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), "Manifest generated successfully") {
+				t.Errorf("summary should go to stderr, got: %s", stderr.String())
+			}
+			generated := bytes.Clone(stdout.Bytes())
+			manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+			if err := os.WriteFile(manifestPath, generated, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, args := range [][]string{
+				{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir},
+				{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--stream"},
+			} {
+				stderr.Reset()
+				if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+					t.Errorf("%v: exit code %d, stderr: %s", args, exitCode, stderr.String())
+				}
+			}
+
+			// kekkai generate --target /app | kekkai diff old.json -
+			stdout.Reset()
+			stderr.Reset()
+			cli.inStream = bytes.NewReader(generated)
+			if exitCode := cli.Run([]string{"kekkai", "diff", oldPath, "-"}); exitCode != ExitCodeOK {
+				t.Fatalf("diff failed: exit code %d, stderr: %s", exitCode, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), "Manifests are identical") {
+				t.Errorf("diff with the piped manifest should be identical, got: %s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestCLIHashAlgorithm(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--hash", "sha3-256", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate --hash sha3-256 failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	for _, args := range [][]string{
+		{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir},
+		{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir, "--stream"},
+	} {
+		if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+			t.Errorf("%v: exit code %d, stderr: %s", args, exitCode, stderr.String())
+		}
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "inspect", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("inspect failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Hash Algorithm: sha3-256") {
+		t.Errorf("inspect output should show the algorithm, got: %s", stdout.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'HELLO';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeFail {
+		t.Errorf("verify after tampering: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--hash", "md5"}); exitCode != ExitCodeFail {
+		t.Errorf("--hash md5: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+}
+
+func TestCLIRoot(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "app", "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.php", "app/lib/util.php"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("<?php // "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "root", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("root failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	root := strings.TrimSpace(stdout.String())
+	if len(root) != 64 {
+		t.Fatalf("root output = %q, want a bare SHA-256 digest", stdout.String())
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "root", "--format", "json", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("root --format json failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	var result struct {
+		Success       bool   `json:"success"`
+		Root          string `json:"root"`
+		HashAlgorithm string `json:"hash_algorithm"`
+		Recorded      bool   `json:"recorded"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("failed to parse JSON output: %v", err)
+	}
+	if !result.Success || result.Root != root || !result.Recorded || result.HashAlgorithm != "sha256" {
+		t.Errorf("root --format json = %+v, want recorded sha256 root %s", result, root)
+	}
+
+	// A change below app/lib is located by verify
+	if err := os.WriteFile(filepath.Join(tempDir, "app/lib/util.php"), []byte("<?php system($_GET['c']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeFail {
+		t.Fatalf("verify after tampering: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+	if !strings.Contains(stderr.String(), "Differences confined to: app/lib/") {
+		t.Errorf("verify output should name the differing subtree, got: %s", stderr.String())
+	}
+
+	// A tree that does not match the entries is rejected
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, []byte(strings.Replace(string(data), root, strings.Repeat("0", 64), 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "root", manifestPath}); exitCode != ExitCodeFail {
+		t.Errorf("root with a forged root: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+	if !strings.Contains(stderr.String(), "does not match the entries") {
+		t.Errorf("stderr should explain the mismatch, got: %s", stderr.String())
+	}
+}
+
+func TestCLIXattrs(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	xattrPath := filepath.Join(t.TempDir(), "xattrs.json")
+	plainPath := filepath.Join(t.TempDir(), "plain.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", xattrPath, "--xattrs", "--xattr-namespaces", "user"}); exitCode != ExitCodeOK {
+		t.Fatalf("generate --xattrs failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", plainPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	data, err := os.ReadFile(xattrPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"xattr_namespaces": [`) {
+		t.Errorf("manifest should record the xattr namespaces, got: %s", data)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantExit int
+		wantErr  string
+	}{
+		{
+			name:     "manifest with xattrs",
+			args:     []string{"kekkai", "verify", "--manifest", xattrPath, "--target", tempDir, "--xattrs"},
+			wantExit: ExitCodeOK,
+		},
+		{
+			name:     "manifest without xattrs",
+			args:     []string{"kekkai", "verify", "--manifest", plainPath, "--target", tempDir, "--xattrs"},
+			wantExit: ExitCodeFail,
+			wantErr:  "does not record extended attributes",
+		},
+		{
+			name:     "invalid namespace",
+			args:     []string{"kekkai", "generate", "--target", tempDir, "--xattrs", "--xattr-namespaces", "security.capability"},
+			wantExit: ExitCodeFail,
+			wantErr:  "must not contain '.'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout.Reset()
+			stderr.Reset()
+
+			exitCode := cli.Run(tt.args)
+			if exitCode != tt.wantExit {
+				t.Errorf("Run() exit code = %v, want %v\nstderr: %s", exitCode, tt.wantExit, stderr.String())
+			}
+			if tt.wantErr != "" && !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("Error output should contain '%s', got: %s", tt.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestCLIGenerateWithIncludes(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"app/main.php", "docs/guide.md"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--include", "app/**", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"includes": [`) || strings.Contains(string(data), "docs/guide.md") {
+		t.Errorf("manifest should record includes and skip docs, got: %s", data)
+	}
+
+	// A new file outside the includes does not fail verification
+	if err := os.WriteFile(filepath.Join(tempDir, "docs/new.md"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeOK {
+		t.Errorf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestCLIGenerateExcludeFrom(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"app/main.php", "app/debug.log"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	workDir := t.TempDir()
+	ignorePath := filepath.Join(workDir, ".kekkaiignore")
+	if err := os.WriteFile(ignorePath, []byte("# logs\n*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(workDir, "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude-from", ignorePath, "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"exclude_rules": [`) || strings.Contains(string(data), "app/debug.log") {
+		t.Errorf("manifest should embed the rules and skip logs, got: %s", data)
+	}
+
+	// Verify uses the embedded rules even when the file is gone
+	if err := os.Remove(ignorePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "app/new.log"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "verify", "--manifest", manifestPath, "--target", tempDir}); exitCode != ExitCodeOK {
+		t.Errorf("verify failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+
+	// A missing exclude file is an error
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude-from", ignorePath}); exitCode != ExitCodeFail {
+		t.Errorf("generate with missing exclude file: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+}
+
+func TestCLIDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'v1';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	oldPath := filepath.Join(workDir, "old.json")
+	newPath := filepath.Join(workDir, "new.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--output", oldPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: %s", stderr.String())
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "shell.php"), []byte("<?php eval($_POST['x']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "*.log", "--output", newPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: %s", stderr.String())
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "diff", oldPath, newPath}); exitCode != ExitCodeOK {
+		t.Fatalf("diff failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{"Δ Manifests differ", "- shell.php (file)", `+ excludes: "*.log"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("diff output should contain %q, got: %s", want, stdout.String())
+		}
+	}
+
+	// The new side read from stdin
+	data, err := os.ReadFile(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.inStream = bytes.NewReader(data)
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "diff", "--format", "json", oldPath, "-"}); exitCode != ExitCodeOK {
+		t.Fatalf("diff from stdin failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	var result struct {
+		Identical bool `json:"identical"`
+		Details   struct {
+			Changes []struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			} `json:"changes"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v: %s", err, stdout.String())
+	}
+	if result.Identical || len(result.Details.Changes) != 1 || result.Details.Changes[0].Kind != "added" {
+		t.Errorf("unexpected diff result: %+v", result)
+	}
+
+	for _, args := range [][]string{
+		{"kekkai", "diff", oldPath},
+		{"kekkai", "diff", "-", "-"},
+		{"kekkai", "diff", oldPath, "s3://bucket/production"},
+		{"kekkai", "diff", oldPath, "s3://bucket/../app"},
+	} {
+		stderr.Reset()
+		if exitCode := cli.Run(args); exitCode != ExitCodeFail {
+			t.Errorf("%v: exit code %d, want %d", args, exitCode, ExitCodeFail)
+		}
+	}
+}
+
+func TestCLIInspect(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"app/main.php", "app/debug.log", "index.php"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "app/*.log", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: %s", stderr.String())
+	}
+
+	// Default: summary and patterns
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "inspect", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("inspect failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{"File Count: 2", "Excludes (1):", `- "app/*.log"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("inspect output should contain %q, got: %s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "inspect", "--format", "json", "--path", "app/main.php", "--path", "app/debug.log", "--totals", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("inspect failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	var result struct {
+		Summary *struct{} `json:"summary"`
+		Lookups []struct {
+			Path       string `json:"path"`
+			Found      bool   `json:"found"`
+			ExcludedBy string `json:"excluded_by"`
+		} `json:"lookups"`
+		Totals []struct {
+			Name  string `json:"name"`
+			Files int    `json:"files"`
+		} `json:"totals"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v: %s", err, stdout.String())
+	}
+	if result.Summary != nil {
+		t.Error("summary should only be shown when requested or without a query")
+	}
+	if len(result.Lookups) != 2 || !result.Lookups[0].Found || result.Lookups[1].Found || result.Lookups[1].ExcludedBy != "app/*.log" {
+		t.Errorf("unexpected lookups: %+v", result.Lookups)
+	}
+	if len(result.Totals) != 2 || result.Totals[0].Name != "." || result.Totals[1].Files != 1 {
+		t.Errorf("unexpected totals: %+v", result.Totals)
+	}
+
+	stderr.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "inspect"}); exitCode != ExitCodeFail {
+		t.Errorf("inspect without a manifest: exit code %d, want %d", exitCode, ExitCodeFail)
+	}
+}
+
+func TestCLIExplain(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"app/main.php", "bootstrap/cache/packages.php"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "bootstrap/cache/**", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("generate failed: %s", stderr.String())
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "explain", "--manifest", manifestPath, "bootstrap/cache/packages.php", "app/main.php"}); exitCode != ExitCodeOK {
+		t.Fatalf("explain failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{
+		"✗ excluded: bootstrap/cache/packages.php",
+		`contents of bootstrap/cache are skipped: exclude pattern "bootstrap/cache/**" matches everything below it`,
+		"✓ included: app/main.php",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("explain output should contain %q, got: %s", want, stdout.String())
+		}
+	}
+
+	// Patterns instead of a manifest; -target tells that "app" is a directory
+	ignorePath := filepath.Join(t.TempDir(), ".kekkaiignore")
+	if err := os.WriteFile(ignorePath, []byte("app/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "explain", "--format", "json", "--target", tempDir, "--exclude-from", ignorePath, "app"}); exitCode != ExitCodeOK {
+		t.Fatalf("explain failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	var result struct {
+		Explanations []struct {
+			Path     string `json:"path"`
+			IsDir    bool   `json:"is_dir"`
+			Included bool   `json:"included"`
+			Pattern  string `json:"pattern"`
+			Kind     string `json:"kind"`
+		} `json:"explanations"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v: %s", err, stdout.String())
+	}
+	if len(result.Explanations) != 1 || !result.Explanations[0].IsDir || result.Explanations[0].Included || result.Explanations[0].Kind != "exclude_rule" {
+		t.Errorf("unexpected explanations: %+v", result.Explanations)
+	}
+
+	for _, args := range [][]string{
+		{"kekkai", "explain", "--manifest", manifestPath},
+		{"kekkai", "explain", "--manifest", manifestPath, "--exclude", "*.log", "app"},
+		{"kekkai", "explain", "--exclude", "[bad", "app"},
+	} {
+		stderr.Reset()
+		if exitCode := cli.Run(args); exitCode != ExitCodeFail {
+			t.Errorf("%v: exit code %d, want %d", args, exitCode, ExitCodeFail)
+		}
+	}
+}
+
+func TestCLIGenerateDryRun(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"index.php", "lib/helper.php", "debug.log"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "*", "--dry-run", "--output", manifestPath}); exitCode != ExitCodeOK {
+		t.Fatalf("dry run failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{
+		"✓ Dry run completed (no manifest written)",
+		"Recorded: 0 files",
+		`exclude pattern "*": 3 files`,
+		"no files would be recorded",
+		`exclude pattern "*" excludes 2 executable files`,
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("dry run output should contain %q, got: %s", want, stdout.String())
+		}
+	}
+	if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+		t.Errorf("dry run should not write a manifest, stat error = %v", err)
+	}
+
+	stdout.Reset()
+	if exitCode := cli.Run([]string{"kekkai", "generate", "--target", tempDir, "--exclude", "*.log", "--dry-run", "--format", "json"}); exitCode != ExitCodeOK {
+		t.Fatalf("dry run failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+	var result struct {
+		Audit struct {
+			IncludedFiles int `json:"included_files"`
+		} `json:"audit"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON output: %v: %s", err, stdout.String())
+	}
+	if result.Audit.IncludedFiles != 2 || len(result.Warnings) != 0 {
+		t.Errorf("unexpected dry run result: %+v", result)
+	}
+}
+
+func TestCLIGeneratePolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"public/index.php", "app/Kernel.php", "storage/a.log", "storage/b.log", "storage/c.log"} {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workDir := t.TempDir()
+	manifestPath := filepath.Join(workDir, "manifest.json")
+	policyPath := filepath.Join(workDir, "policy.json")
+	if err := os.WriteFile(policyPath, []byte(`{"forbidden_patterns": ["**", "*.php"], "required_paths": ["public/index.php"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		errMsg string
+	}{
+		{"forbidden pattern", []string{"--exclude", "*.php"}, `exclude pattern "*.php" is forbidden`},
+		{"required path excluded", []string{"--exclude", "public/**"}, `required path public/index.php is excluded by "public/**"`},
+		{"too much excluded", []string{"--exclude", "storage/**", "--max-excluded", "0.5"}, "3 of 5 files (60.0%) are not recorded, more than the allowed 50.0%"},
+		{"invalid fraction", []string{"--max-excluded", "2"}, "max excluded fraction must be between 0.0 and 1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cli := NewCLI(&stdout, &stderr)
+
+			args := append([]string{"kekkai", "generate", "--target", tempDir, "--policy", policyPath, "--output", manifestPath}, tt.args...)
+			if exitCode := cli.Run(args); exitCode != ExitCodeFail {
+				t.Fatalf("exit code %d, want %d", exitCode, ExitCodeFail)
+			}
+			if !strings.Contains(stderr.String(), tt.errMsg) {
+				t.Errorf("stderr should contain %q, got: %s", tt.errMsg, stderr.String())
+			}
+			if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+				t.Errorf("no manifest should be written on a violation, stat error = %v", err)
+			}
+		})
+	}
+
+	var stdout, stderr bytes.Buffer
+	cli := NewCLI(&stdout, &stderr)
+	args := []string{"kekkai", "generate", "--target", tempDir, "--policy", policyPath, "--exclude", "storage/*.log", "--max-excluded", "0.6", "--require", "app/Kernel.php", "--output", manifestPath}
+	if exitCode := cli.Run(args); exitCode != ExitCodeOK {
+		t.Fatalf("generate within the policy failed: exit code %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
 func TestCLIInvalidCommands(t *testing.T) {
 	var stdout, stderr bytes.Buffer
 	cli := NewCLI(&stdout, &stderr)
@@ -0,0 +1,110 @@
+package glob
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAlternatives bounds brace expansion so a hostile pattern cannot exhaust memory
+const maxAlternatives = 1024
+
+// Expand expands {a,b} alternations into the list of patterns they stand for.
+// A pattern without braces expands to itself.
+func Expand(pattern string) ([]string, error) {
+	expanded, err := expand(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadPattern, pattern, err)
+	}
+	return expanded, nil
+}
+
+func expand(pattern string) ([]string, error) {
+	open, close, err := findBraces(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if open < 0 {
+		return []string{pattern}, nil
+	}
+
+	prefix, body, suffix := pattern[:open], pattern[open+1:close], pattern[close+1:]
+
+	var results []string
+	for _, alt := range splitAlternatives(body) {
+		more, err := expand(prefix + alt + suffix)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, more...)
+		if len(results) > maxAlternatives {
+			return nil, fmt.Errorf("more than %d alternatives", maxAlternatives)
+		}
+	}
+	return results, nil
+}
+
+// findBraces returns the positions of the first unescaped '{' and its matching '}',
+// or -1 when there is none
+func findBraces(pattern string) (int, int, error) {
+	open, depth := -1, 0
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+			// A ']' right after '[' or '[!' is part of the class
+			if i+1 < len(pattern) && (pattern[i+1] == '!' || pattern[i+1] == '^') {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+			if depth == 0 {
+				return open, i, nil
+			}
+		}
+	}
+	if depth > 0 {
+		return 0, 0, fmt.Errorf("unclosed '{'")
+	}
+	return -1, -1, nil
+}
+
+// splitAlternatives splits the body of a brace group at top-level commas
+func splitAlternatives(body string) []string {
+	var alternatives []string
+	var current strings.Builder
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\' && i+1 < len(body):
+			current.WriteByte(c)
+			i++
+			c = body[i]
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			alternatives = append(alternatives, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	return append(alternatives, current.String())
+}
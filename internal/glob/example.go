@@ -0,0 +1,114 @@
+package glob
+
+import "strings"
+
+// maxExamples bounds the number of examples of a pattern
+const maxExamples = 256
+
+// Examples returns paths that the pattern matches, with the character filler
+// standing for whatever a wildcard or a negated class matches. A "**" segment
+// stands for zero, one and two segments, or one and two when it is trailing.
+// Malformed patterns have no examples.
+func Examples(pattern string, filler rune) []string {
+	p, err := Compile(pattern)
+	if err != nil {
+		return nil
+	}
+
+	var examples []string
+	for _, segments := range p.alternatives {
+		for _, names := range exampleSegments(segments, filler) {
+			examples = append(examples, strings.Join(names, "/"))
+			if len(examples) >= maxExamples {
+				return examples
+			}
+		}
+	}
+	return examples
+}
+
+// exampleSegments returns the path segments matched by pattern segments
+func exampleSegments(segments []string, filler rune) [][]string {
+	if len(segments) == 0 {
+		return [][]string{nil}
+	}
+
+	rest := exampleSegments(segments[1:], filler)
+	var heads [][]string
+	if segments[0] == "**" {
+		name := string(filler)
+		if len(segments) > 1 {
+			heads = append(heads, nil)
+		}
+		heads = append(heads, []string{name}, []string{name, name})
+	} else {
+		heads = [][]string{{exampleSegment(segments[0], filler)}}
+	}
+
+	var results [][]string
+	for _, head := range heads {
+		for _, tail := range rest {
+			results = append(results, append(append([]string(nil), head...), tail...))
+			if len(results) >= maxExamples {
+				return results
+			}
+		}
+	}
+	return results
+}
+
+// exampleSegment returns a name matched by a single segment
+func exampleSegment(segment string, filler rune) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); {
+		switch segment[i] {
+		case '*':
+			for i < len(segment) && segment[i] == '*' {
+				i++
+			}
+			b.WriteRune(filler)
+		case '?':
+			b.WriteRune(filler)
+			i++
+		case '[':
+			r, width := classExample(segment[i:], filler)
+			b.WriteRune(r)
+			i += width
+		case '\\':
+			r, size := decodeRune(segment[i+1:])
+			b.WriteRune(r)
+			i += 1 + size
+		default:
+			r, size := decodeRune(segment[i:])
+			b.WriteRune(r)
+			i += size
+		}
+	}
+	return b.String()
+}
+
+// classExample returns a character matched by the class at the start of
+// pattern, preferring filler, and the width of the class
+func classExample(pattern string, filler rune) (rune, int) {
+	candidates := []rune{filler}
+	i := 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	for first := true; i < len(pattern) && (pattern[i] != ']' || first); first = false {
+		r, w := classChar(pattern[i:])
+		candidates = append(candidates, r)
+		i += w
+	}
+
+	var width int
+	for _, r := range candidates {
+		var matched bool
+		matched, width, _ = matchClass(pattern, string(r))
+		if matched {
+			return r, width
+		}
+	}
+	// Only a negated class listing the filler gets here
+	return filler, width
+}
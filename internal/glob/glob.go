@@ -0,0 +1,290 @@
+// Package glob implements the path patterns used for include and exclude rules.
+//
+// Patterns are matched against slash-separated relative paths:
+//
+//	Syntax  Meaning
+//	*       any sequence of characters except '/'
+//	?       any single character except '/'
+//	[abc]   a character class; ranges ([a-z]) and negation ([!a] or [^a]) are supported
+//	{a,b}   alternation; alternatives may contain '/' and nest
+//	**      as a whole path segment, zero or more segments; a trailing "/**"
+//	        matches one or more segments, so "dir/**" matches everything below dir
+//	\x      the literal character x
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrBadPattern indicates a malformed pattern
+var ErrBadPattern = errors.New("syntax error in pattern")
+
+// Pattern is a compiled glob pattern
+type Pattern struct {
+	source       string
+	alternatives [][]string // Brace-expanded alternatives split into segments
+}
+
+// cache holds compiled patterns; the same few patterns are matched against every path
+var cache sync.Map // map[string]*Pattern
+
+// Compile parses a pattern
+func Compile(pattern string) (*Pattern, error) {
+	if p, ok := cache.Load(pattern); ok {
+		return p.(*Pattern), nil
+	}
+
+	expanded, err := Expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pattern{source: pattern}
+	for _, alt := range expanded {
+		segments := strings.Split(alt, "/")
+		for _, segment := range segments {
+			if err := validateSegment(segment); err != nil {
+				return nil, fmt.Errorf("%w: %q: %v", ErrBadPattern, pattern, err)
+			}
+		}
+		p.alternatives = append(p.alternatives, segments)
+	}
+
+	cache.Store(pattern, p)
+	return p, nil
+}
+
+// Validate reports whether pattern is well formed
+func Validate(pattern string) error {
+	_, err := Compile(pattern)
+	return err
+}
+
+// Match reports whether path matches pattern. Malformed patterns match nothing.
+func Match(pattern, path string) bool {
+	p, err := Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return p.Match(path)
+}
+
+// MatchAny reports whether path matches any of the patterns
+func MatchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the source of the pattern
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Match reports whether path matches the pattern
+func (p *Pattern) Match(path string) bool {
+	names := strings.Split(path, "/")
+	for _, segments := range p.alternatives {
+		if len(segments) == 1 && segments[0] == "**" {
+			return true // A bare ** matches everything
+		}
+		if matchSegments(segments, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesAllBelow reports whether every path below dir matches the pattern,
+// which is the case when the pattern ends in "/*" or "/**" and the rest of it
+// matches dir. A walker can then skip dir without looking inside.
+func (p *Pattern) MatchesAllBelow(dir string) bool {
+	names := strings.Split(dir, "/")
+	for _, segments := range p.alternatives {
+		n := len(segments)
+		if n == 1 && segments[0] == "**" {
+			return true
+		}
+		if n < 2 || (segments[n-1] != "*" && segments[n-1] != "**") {
+			continue
+		}
+		if matchSegments(segments[:n-1], names) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches pattern segments against path segments. It works like
+// wildcard matching with "**" as the star: on a mismatch only the last "**"
+// takes one more name, so several "**" segments do not backtrack exponentially.
+func matchSegments(segments, names []string) bool {
+	i, j := 0, 0
+	star, next := -1, 0 // Last "**" and the first name it has not taken
+	for i < len(segments) || j < len(names) {
+		if i < len(segments) {
+			segment := segments[i]
+			if segment == "**" {
+				if i == len(segments)-1 {
+					// A trailing ** needs at least one segment: "dir/**" is what is inside dir
+					return j < len(names)
+				}
+				star, next = i, j
+				i++
+				continue
+			}
+			if j < len(names) && matchSegment(segment, names[j]) {
+				i++
+				j++
+				continue
+			}
+		}
+		if star < 0 || next == len(names) {
+			return false
+		}
+		next++
+		i, j = star+1, next
+	}
+	return true
+}
+
+// matchSegment matches a single segment without '/' against a name
+func matchSegment(pattern, name string) bool {
+	// Backtracking over the last '*' is enough since '*' cannot cross segments
+	var starP, starN = -1, 0
+	p, n := 0, 0
+	for n < len(name) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// "**" inside a segment behaves like "*"
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				starP, starN = p, n
+				continue
+			case '?':
+				_, size := decodeRune(name[n:])
+				p++
+				n += size
+				continue
+			case '[':
+				matched, width, size := matchClass(pattern[p:], name[n:])
+				if matched {
+					p += width
+					n += size
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == name[n] {
+					p += 2
+					n++
+					continue
+				}
+			default:
+				if pattern[p] == name[n] {
+					p++
+					n++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// Let the last '*' absorb one more character
+		_, size := decodeRune(name[starN:])
+		starN += size
+		p, n = starP, starN
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches a character class at the start of pattern against the
+// first character of name. It returns whether it matched, the width of the
+// class in pattern and the size of the matched character in name.
+func matchClass(pattern, name string) (bool, int, int) {
+	r, size := decodeRune(name)
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	matched := false
+	first := true
+	for i < len(pattern) && (pattern[i] != ']' || first) {
+		first = false
+		lo, w := classChar(pattern[i:])
+		i += w
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, w = classChar(pattern[i+1:])
+			i += 1 + w
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	// i points at the closing ']' (validated at compile time)
+	return matched != negate, i + 1, size
+}
+
+// classChar reads one possibly escaped character inside a class
+func classChar(s string) (rune, int) {
+	if s[0] == '\\' && len(s) > 1 {
+		r, size := decodeRune(s[1:])
+		return r, size + 1
+	}
+	return decodeRune(s)
+}
+
+// validateSegment checks escapes and character classes of a segment
+func validateSegment(segment string) error {
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			if i+1 >= len(segment) {
+				return errors.New("trailing backslash")
+			}
+			i++
+		case '[':
+			j := i + 1
+			if j < len(segment) && (segment[j] == '!' || segment[j] == '^') {
+				j++
+			}
+			first := true
+			for ; j < len(segment) && (segment[j] != ']' || first); j++ {
+				first = false
+				if segment[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(segment) {
+				return errors.New("unclosed character class")
+			}
+			i = j
+		}
+	}
+	return nil
+}
+
+// decodeRune decodes the first character of s, treating invalid UTF-8 as single bytes
+func decodeRune(s string) (rune, int) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return utf8.RuneError, 1
+	}
+	return r, size
+}
@@ -0,0 +1,240 @@
+package glob
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// Literals
+		{"index.php", "index.php", true},
+		{"index.php", "index.phps", false},
+		{"config/app.php", "config/app.php", true},
+		{"config/app.php", "other/config/app.php", false},
+
+		// * and ? stay within a segment
+		{"*.log", "app.log", true},
+		{"*.log", "logs/app.log", false},
+		{"*", "anything", true},
+		{"*", "a/b", false},
+		{"logs/*", "logs/app.log", true},
+		{"logs/*", "logs/2024/app.log", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"*.tar.gz", "backup.tar.gz", true},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?", "é", true},
+		{"a?c", "a/c", false},
+
+		// ** as a whole segment
+		{"**", "a", true},
+		{"**", "a/b/c", true},
+		{"**/*.php", "index.php", true},
+		{"**/*.php", "app/Http/Kernel.php", true},
+		{"**/logs/*", "logs/app.log", true},
+		{"**/logs/*", "app/logs/error.log", true},
+		{"**/logs/*", "app/logs/2024/error.log", false},
+		{"src/**", "src/main.go", true},
+		{"src/**", "src/lib/helper.go", true},
+		{"src/**", "src", false},
+		{"src/**", "srcx/main.go", false},
+		{"app/**/cache/*.tmp", "app/cache/a.tmp", true},
+		{"app/**/cache/*.tmp", "app/x/y/cache/a.tmp", true},
+		{"app/**/cache/*.tmp", "app/x/y/cache/sub/a.tmp", false},
+		{"app/**/cache/*.tmp", "lib/cache/a.tmp", false},
+		{"**/node_modules/**/test/**", "node_modules/lodash/test/a.js", true},
+		{"**/node_modules/**/test/**", "web/node_modules/a/b/test/c/d.js", true},
+		{"**/node_modules/**/test/**", "node_modules/test/a.js", true},
+		{"**/node_modules/**/test/**", "node_modules/lodash/test", false},
+		{"**/node_modules/**/test/**", "node_modules/lodash/lib/a.js", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+
+		// ** inside a segment behaves like *
+		{"a**b", "aXYb", true},
+		{"a**b", "aX/Yb", false},
+
+		// Alternation
+		{"*.{php,phtml}", "index.php", true},
+		{"*.{php,phtml}", "view.phtml", true},
+		{"*.{php,phtml}", "style.css", false},
+		{"{app,config}/**", "config/app.php", true},
+		{"{app,config}/**", "public/app.php", false},
+		{"{a,b/c}/x", "b/c/x", true},
+		{"{a,{b,c}d}.txt", "cd.txt", true},
+		{"{a,{b,c}d}.txt", "ad.txt", false},
+		{"x{,y}", "x", true},
+		{"x{,y}", "xy", true},
+
+		// Character classes
+		{"[abc].txt", "b.txt", true},
+		{"[abc].txt", "d.txt", false},
+		{"[a-c]1", "c1", true},
+		{"[a-c]1", "d1", false},
+		{"[!a-c]1", "d1", true},
+		{"[^a-c]1", "a1", false},
+		{"[]]x", "]x", true},
+		{"[!]]x", "ax", true},
+		{"[-a]", "-", true},
+		{"[a-]", "-", true},
+		{"file[0-9][0-9].log", "file42.log", true},
+		{"file[0-9][0-9].log", "file4.log", false},
+		{"[é]", "é", true},
+
+		// Escaping
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+		{`a\?`, "a?", true},
+		{`a\?`, "ab", false},
+		{`\[x]`, "[x]", true},
+		{`\{a,b}`, "{a,b}", true},
+		{`[\]]`, "]", true},
+		{`[a\-z]`, "-", true},
+		{`[a\-z]`, "b", false},
+	}
+
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchDeepPath(t *testing.T) {
+	// Several ** against a deep path used to backtrack exponentially
+	deep := strings.Repeat("a/", 40) + "b"
+	pattern := strings.Repeat("**/a/", 8) + "**/c"
+
+	done := make(chan bool, 1)
+	go func() { done <- Match(pattern, deep) }()
+	select {
+	case got := <-done:
+		if got {
+			t.Errorf("Match(%q, %q) = true, want false", pattern, deep)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Match(%q, %q) did not finish", pattern, deep)
+	}
+
+	if !Match(strings.Repeat("**/a/", 8)+"**/b", deep) {
+		t.Errorf("Match() of a deep path with several ** should match")
+	}
+}
+
+func TestMatchesAllBelow(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		{"logs/**", "logs", true},
+		{"logs/*", "logs", true},
+		{"**/logs/**", "logs", true},
+		{"**/logs/**", "app/logs", true},
+		{"**/logs/**", "app/logs/x", false},
+		{"**", "anything", true},
+		{"**/*", "anything", true},
+		{"{cache,tmp}/**", "tmp", true},
+		{"storage/*/cache/**", "storage/app/cache", true},
+		{"logs/**", "src", false},
+		{"*.log", "logs", false},
+		{"logs/*.log", "logs", false},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", tt.pattern, err)
+		}
+		if got := p.MatchesAllBelow(tt.dir); got != tt.want {
+			t.Errorf("MatchesAllBelow(%q, %q) = %v, want %v", tt.pattern, tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []string{"*.log", "a/**/b", "{a,b}", "[a-z]", `\*`, "[]]", "x}"}
+	for _, pattern := range valid {
+		if err := Validate(pattern); err != nil {
+			t.Errorf("Validate(%q) error = %v", pattern, err)
+		}
+	}
+
+	invalid := []string{"[abc", `abc\`, "{a,b", "a/[", "{a,[b}"}
+	for _, pattern := range invalid {
+		err := Validate(pattern)
+		if !errors.Is(err, ErrBadPattern) {
+			t.Errorf("Validate(%q) = %v, want ErrBadPattern", pattern, err)
+		}
+		if Match(pattern, pattern) {
+			t.Errorf("malformed pattern %q should match nothing", pattern)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"plain", []string{"plain"}},
+		{"*.{js,ts}", []string{"*.js", "*.ts"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"{a,{b,c}}x", []string{"ax", "bx", "cx"}},
+		{`\{a,b}`, []string{`\{a,b}`}},
+		{"[{]a", []string{"[{]a"}},
+	}
+
+	for _, tt := range tests {
+		got, err := Expand(tt.pattern)
+		if err != nil {
+			t.Errorf("Expand(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expand(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+
+	// Alternatives are bounded
+	if _, err := Expand("{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}{a,b}"); !errors.Is(err, ErrBadPattern) {
+		t.Errorf("Expand() of 2048 alternatives error = %v, want ErrBadPattern", err)
+	}
+}
+
+func TestExamples(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"index.php", []string{"index.php"}},
+		{"*.php", []string{"_.php"}},
+		{"a?c/[x-z]/[!a]", []string{"a_c/x/_"}},
+		{`\*.{php,inc}`, []string{"*.php", "*.inc"}},
+		{"**", []string{"_", "_/_"}},
+		{"**/*.php", []string{"_.php", "_/_.php", "_/_/_.php"}},
+		{"[", nil},
+	}
+
+	for _, tt := range tests {
+		got := Examples(tt.pattern, '_')
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Examples(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+		for _, example := range got {
+			if !Match(tt.pattern, example) {
+				t.Errorf("Examples(%q) returned %q, which it does not match", tt.pattern, example)
+			}
+		}
+	}
+}
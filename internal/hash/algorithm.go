@@ -0,0 +1,67 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"crypto/sha3"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algorithm is the digest used for file contents
+type Algorithm string
+
+const (
+	SHA256   Algorithm = "sha256"
+	SHA512   Algorithm = "sha512"
+	SHA3_256 Algorithm = "sha3-256"
+	BLAKE2b  Algorithm = "blake2b" // BLAKE2b-512, as printed by b2sum
+)
+
+// DefaultAlgorithm is used when none is set, and by manifests that do not
+// record an algorithm
+const DefaultAlgorithm = SHA256
+
+// Algorithms lists the supported algorithms
+var Algorithms = []Algorithm{SHA256, SHA512, SHA3_256, BLAKE2b}
+
+// ParseAlgorithm validates an algorithm name. An empty name is the default.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	if s == "" {
+		return DefaultAlgorithm, nil
+	}
+	a := Algorithm(strings.ToLower(s))
+	for _, known := range Algorithms {
+		if a == known {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported hash algorithm %q (want sha256, sha512, sha3-256 or blake2b)", s)
+}
+
+// New returns a hasher for the algorithm. An empty or unknown algorithm
+// returns SHA-256.
+func (a Algorithm) New() hash.Hash {
+	switch a {
+	case SHA512:
+		return sha512.New()
+	case SHA3_256:
+		return sha3.New256()
+	case BLAKE2b:
+		h, _ := blake2b.New512(nil) // Fails only for a key longer than 64 bytes
+		return h
+	default:
+		return sha256.New()
+	}
+}
+
+// OrDefault returns the algorithm, or DefaultAlgorithm when it is empty
+func (a Algorithm) OrDefault() Algorithm {
+	if a == "" {
+		return DefaultAlgorithm
+	}
+	return a
+}
@@ -0,0 +1,61 @@
+package hash
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFile(t, filepath.Join(tempDir, "abc.txt"), "abc")
+
+	// Digests of "abc" from the published test vectors
+	tests := map[Algorithm]string{
+		"":       "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		SHA256:   "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		SHA512:   "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f",
+		SHA3_256: "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532",
+		BLAKE2b:  "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+	}
+
+	for algorithm, want := range tests {
+		t.Run(string(algorithm.OrDefault()), func(t *testing.T) {
+			calc := NewCalculator(1)
+			calc.SetAlgorithm(algorithm)
+
+			result, err := calc.CalculateDirectory(context.Background(), tempDir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Files[0].Hash; got != want {
+				t.Errorf("CalculateDirectory() hash = %s, want %s", got, want)
+			}
+
+			var streamed string
+			err = calc.Stream(context.Background(), []StreamRoot{{Dir: tempDir}}, Filter{}, func(f FileInfo) error {
+				if !f.IsDir {
+					streamed = f.Hash
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if streamed != want {
+				t.Errorf("Stream() hash = %s, want %s", streamed, want)
+			}
+		})
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	for in, want := range map[string]Algorithm{"": SHA256, "SHA512": SHA512, "sha3-256": SHA3_256, "blake2b": BLAKE2b} {
+		if got, err := ParseAlgorithm(in); err != nil || got != want {
+			t.Errorf("ParseAlgorithm(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseAlgorithm("md5"); err == nil {
+		t.Error("ParseAlgorithm(\"md5\") should fail")
+	}
+}
@@ -0,0 +1,270 @@
+package hash
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+)
+
+// AppendRule marks files that may only grow, such as logs
+type AppendRule struct {
+	// Path is a glob of the monitored files, e.g. "storage/logs/*.log"
+	Path string `json:"path"`
+
+	// Rotate lists the suffixes a file is renamed with when it is rotated,
+	// e.g. ".1" for app.log → app.log.1
+	Rotate []string `json:"rotate,omitempty"`
+}
+
+// Validate checks the glob and the rotation suffixes of the rule
+func (r AppendRule) Validate() error {
+	if err := glob.Validate(r.Path); err != nil {
+		return err
+	}
+	for _, suffix := range r.Rotate {
+		if suffix == "" || strings.ContainsAny(suffix, "/\\") {
+			return fmt.Errorf("invalid rotation suffix %q", suffix)
+		}
+	}
+	return nil
+}
+
+// AppendEntry records how much of an append-only file has been seen
+type AppendEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"` // Digest of the first Size bytes, with the algorithm of the manifest
+}
+
+// AppendStatus is the outcome of checking an append-only file
+type AppendStatus string
+
+const (
+	AppendGrown     AppendStatus = "grown" // Also used when the file is unchanged
+	AppendRotated   AppendStatus = "rotated"
+	AppendNew       AppendStatus = "new"
+	AppendTruncated AppendStatus = "truncated"
+	AppendRewritten AppendStatus = "rewritten"
+	AppendDeleted   AppendStatus = "deleted"
+)
+
+// Violated reports whether the status means the file was not only appended to
+func (s AppendStatus) Violated() bool {
+	return s == AppendTruncated || s == AppendRewritten || s == AppendDeleted
+}
+
+// AppendCheck is the result of checking one append-only file against its
+// previously seen state
+type AppendCheck struct {
+	Path      string
+	Status    AppendStatus
+	RotatedTo string       // Rotated copy holding the previous content
+	Previous  *AppendEntry // nil for new files
+	Current   *AppendEntry // nil when the file no longer exists
+}
+
+// MatchAppendRule returns the first rule whose glob matches relPath
+func MatchAppendRule(rules []AppendRule, relPath string) (AppendRule, bool) {
+	for _, rule := range rules {
+		if glob.Match(rule.Path, relPath) {
+			return rule, true
+		}
+	}
+	return AppendRule{}, false
+}
+
+// CollectAppendEntries records the size and digest of every regular file
+// below rootDir matching one of the rules. Symlinks are not followed.
+func CollectAppendEntries(ctx context.Context, rootDir string, rules []AppendRule, algorithm Algorithm) ([]AppendEntry, error) {
+	resolvedDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	patterns := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		patterns = append(patterns, rule.Path)
+	}
+	walkFilter := Filter{Includes: patterns}
+
+	var entries []AppendEntry
+	err = filepath.WalkDir(resolvedDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(resolvedDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if d.IsDir() {
+			// Only descend into directories that can contain a match
+			if _, descend := walkFilter.includeDirectory(relPath); !descend {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := MatchAppendRule(rules, relPath); !ok {
+			return nil
+		}
+
+		size, _, digest, err := hashWithPrefix(p, 0, algorithm)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while walking
+			}
+			return fmt.Errorf("failed to hash %s: %w", relPath, err)
+		}
+		entries = append(entries, AppendEntry{Path: relPath, Size: size, Hash: digest})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+// CheckAppendOnly compares the append-only files below rootDir with their
+// previously seen state. A file passes when it grew or is unchanged and its
+// old content is still its prefix, or when a copy renamed with one of its
+// rule's rotation suffixes holds the old content. Files not seen before are
+// reported as new. The digests are computed with algorithm, which must be the
+// one previous was recorded with.
+func CheckAppendOnly(ctx context.Context, rootDir string, rules []AppendRule, previous []AppendEntry, algorithm Algorithm) ([]AppendCheck, error) {
+	resolvedDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	current, err := CollectAppendEntries(ctx, resolvedDir, rules, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	currentMap := make(map[string]AppendEntry, len(current))
+	for _, entry := range current {
+		currentMap[entry.Path] = entry
+	}
+
+	var checks []AppendCheck
+	seen := make(map[string]bool, len(previous))
+	for _, prev := range previous {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		seen[prev.Path] = true
+
+		check := AppendCheck{Path: prev.Path, Previous: &prev}
+		if cur, ok := currentMap[prev.Path]; ok {
+			check.Current = &cur
+		}
+
+		if check.Current != nil && check.Current.Size >= prev.Size {
+			matches, err := prefixMatches(filepath.Join(resolvedDir, filepath.FromSlash(prev.Path)), prev, algorithm)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				check.Status = AppendGrown
+				checks = append(checks, check)
+				continue
+			}
+		}
+
+		rule, _ := MatchAppendRule(rules, prev.Path)
+		for _, suffix := range rule.Rotate {
+			matches, err := prefixMatches(filepath.Join(resolvedDir, filepath.FromSlash(prev.Path+suffix)), prev, algorithm)
+			if err != nil {
+				return nil, err
+			}
+			if matches {
+				check.Status = AppendRotated
+				check.RotatedTo = prev.Path + suffix
+				break
+			}
+		}
+
+		if check.Status == "" {
+			switch {
+			case check.Current == nil:
+				check.Status = AppendDeleted
+			case check.Current.Size < prev.Size:
+				check.Status = AppendTruncated
+			default:
+				check.Status = AppendRewritten
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	for _, cur := range current {
+		if !seen[cur.Path] {
+			checks = append(checks, AppendCheck{Path: cur.Path, Status: AppendNew, Current: &cur})
+		}
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Path < checks[j].Path })
+	return checks, nil
+}
+
+// prefixMatches reports whether the regular file at p starts with the
+// content recorded in entry. A missing or shorter file does not match.
+func prefixMatches(p string, entry AppendEntry, algorithm Algorithm) (bool, error) {
+	size, prefix, _, err := hashWithPrefix(p, entry.Size, algorithm)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to hash %s: %w", p, err)
+	}
+	return size >= entry.Size && prefix == entry.Hash, nil
+}
+
+// hashWithPrefix returns the size of the regular file at p, the digest of its
+// first prefixSize bytes (empty if the file is shorter) and the digest of its
+// whole content, in a single read. Bytes appended while reading are ignored.
+func hashWithPrefix(p string, prefixSize int64, algorithm Algorithm) (size int64, prefix, full string, err error) {
+	file, err := openRegularFile(p)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, "", "", err
+	}
+	size = info.Size()
+
+	hasher := algorithm.New()
+	rest := size
+	if prefixSize <= size {
+		if _, err := io.CopyN(hasher, file, prefixSize); err != nil {
+			return 0, "", "", err
+		}
+		prefix = hex.EncodeToString(hasher.Sum(nil))
+		rest -= prefixSize
+	}
+	if _, err := io.CopyN(hasher, file, rest); err != nil {
+		return 0, "", "", err
+	}
+
+	return size, prefix, hex.EncodeToString(hasher.Sum(nil)), nil
+}
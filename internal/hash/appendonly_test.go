@@ -0,0 +1,139 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckAppendOnly(t *testing.T) {
+	rules := []AppendRule{{Path: "logs/*.log", Rotate: []string{".1"}}}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   AppendStatus
+	}{
+		{"unchanged", func(t *testing.T, dir string) {}, AppendGrown},
+		{"appended", func(t *testing.T, dir string) {
+			appendFile(t, filepath.Join(dir, "logs/app.log"), "line 3\n")
+		}, AppendGrown},
+		{"rotated", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, "logs/app.log")
+			appendFile(t, path, "line 3\n")
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, path, "fresh\n")
+		}, AppendRotated},
+		{"truncated", func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "logs/app.log"), "line 1\n")
+		}, AppendTruncated},
+		{"rewritten", func(t *testing.T, dir string) {
+			writeFile(t, filepath.Join(dir, "logs/app.log"), "line 1\nline X\nline 3\n")
+		}, AppendRewritten},
+		{"deleted", func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "logs/app.log")); err != nil {
+				t.Fatal(err)
+			}
+		}, AppendDeleted},
+		{"rotated copy rewritten", func(t *testing.T, dir string) {
+			path := filepath.Join(dir, "logs/app.log")
+			if err := os.Rename(path, path+".1"); err != nil {
+				t.Fatal(err)
+			}
+			writeFile(t, path+".1", "line 1\nline X\n")
+		}, AppendDeleted},
+	}
+
+	for _, algorithm := range []Algorithm{SHA256, BLAKE2b} {
+		for _, tt := range tests {
+			t.Run(string(algorithm)+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				if err := os.MkdirAll(filepath.Join(dir, "logs"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, filepath.Join(dir, "logs/app.log"), "line 1\nline 2\n")
+				writeFile(t, filepath.Join(dir, "logs/notes.txt"), "not monitored")
+
+				previous, err := CollectAppendEntries(context.Background(), dir, rules, algorithm)
+				if err != nil {
+					t.Fatalf("CollectAppendEntries() error = %v", err)
+				}
+				if len(previous) != 1 || previous[0].Path != "logs/app.log" || previous[0].Size != 14 {
+					t.Fatalf("CollectAppendEntries() = %+v", previous)
+				}
+				if len(previous[0].Hash) != 2*algorithm.New().Size() {
+					t.Fatalf("CollectAppendEntries() hash = %s, want a %s digest", previous[0].Hash, algorithm)
+				}
+
+				tt.change(t, dir)
+
+				checks, err := CheckAppendOnly(context.Background(), dir, rules, previous, algorithm)
+				if err != nil {
+					t.Fatalf("CheckAppendOnly() error = %v", err)
+				}
+				if len(checks) != 1 || checks[0].Status != tt.want {
+					t.Fatalf("CheckAppendOnly() = %+v, want status %s", checks, tt.want)
+				}
+				if tt.want == AppendRotated && checks[0].RotatedTo != "logs/app.log.1" {
+					t.Errorf("RotatedTo = %q, want logs/app.log.1", checks[0].RotatedTo)
+				}
+			})
+		}
+	}
+}
+
+func TestCheckAppendOnlyNewFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "worker.log"), "started\n")
+
+	checks, err := CheckAppendOnly(context.Background(), dir, []AppendRule{{Path: "*.log"}}, nil, SHA256)
+	if err != nil {
+		t.Fatalf("CheckAppendOnly() error = %v", err)
+	}
+	if len(checks) != 1 || checks[0].Status != AppendNew || checks[0].Current.Size != 8 {
+		t.Errorf("CheckAppendOnly() = %+v, want one new file", checks)
+	}
+}
+
+func TestAppendRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule    AppendRule
+		wantErr bool
+	}{
+		{AppendRule{Path: "logs/*.log", Rotate: []string{".1", "-old"}}, false},
+		{AppendRule{Path: "logs/[.log"}, true},
+		{AppendRule{Path: "logs/*.log", Rotate: []string{""}}, true},
+		{AppendRule{Path: "logs/*.log", Rotate: []string{"/../../etc/passwd"}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
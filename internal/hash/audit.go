@@ -0,0 +1,151 @@
+package hash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// ExecutableExtensions are file types that run on the server; excluding them
+// leaves code unmonitored
+var ExecutableExtensions = []string{".php", ".py", ".rb", ".js"}
+
+// LargeExclusionShare is the share of files above which the audit warns that
+// the patterns exclude most of the tree
+const LargeExclusionShare = 0.5
+
+// maxAuditExamples bounds the example paths kept per pattern
+const maxAuditExamples = 3
+
+// Audit summarizes what a filter removes from a tree
+type Audit struct {
+	TotalFiles       int            `json:"total_files"`
+	TotalBytes       int64          `json:"total_bytes"`
+	IncludedFiles    int            `json:"included_files"`
+	IncludedBytes    int64          `json:"included_bytes"`
+	NotIncludedFiles int            `json:"not_included_files"` // Outside every include pattern
+	NotIncludedBytes int64          `json:"not_included_bytes"`
+	Patterns         []PatternAudit `json:"patterns"`
+}
+
+// PatternAudit counts the files removed by one exclude pattern or rule.
+// A file is attributed to the pattern that Explain reports for it.
+type PatternAudit struct {
+	Pattern     string   `json:"pattern"`
+	Kind        RuleKind `json:"kind"`
+	Files       int      `json:"files"`
+	Bytes       int64    `json:"bytes"`
+	Executables int      `json:"executables"`
+	Examples    []string `json:"examples,omitempty"` // Some of the removed executables
+}
+
+// AuditDirectory walks the whole tree without hashing and counts the files
+// and bytes removed by each pattern of the filter. Every file below rootDir is
+// visited, including those in directories the manifest walk would skip.
+func AuditDirectory(ctx context.Context, rootDir string, filter Filter) (*Audit, error) {
+	resolvedDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	// One row per distinct pattern, since Explain reports patterns by text
+	audit := &Audit{}
+	index := make(map[string]int)
+	addPattern := func(pattern string, kind RuleKind) {
+		key := string(kind) + pattern
+		if _, ok := index[key]; ok {
+			return
+		}
+		index[key] = len(audit.Patterns)
+		audit.Patterns = append(audit.Patterns, PatternAudit{Pattern: pattern, Kind: kind})
+	}
+	for _, pattern := range filter.Excludes {
+		addPattern(pattern, RuleExclude)
+	}
+	for _, rule := range filter.Rules {
+		addPattern(rule.String(), RuleExcludeFile)
+	}
+
+	err = filepath.Walk(resolvedDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(resolvedDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		var size int64
+		if info.Mode().IsRegular() {
+			size = info.Size()
+		}
+		audit.TotalFiles++
+		audit.TotalBytes += size
+
+		e := filter.Explain(relPath, false)
+		switch {
+		case e.Included:
+			audit.IncludedFiles++
+			audit.IncludedBytes += size
+		case e.Kind == RuleExclude || e.Kind == RuleExcludeFile:
+			pa := &audit.Patterns[index[string(e.Kind)+e.Pattern]]
+			pa.Files++
+			pa.Bytes += size
+			if IsExecutable(relPath) {
+				pa.Executables++
+				if len(pa.Examples) < maxAuditExamples {
+					pa.Examples = append(pa.Examples, relPath)
+				}
+			}
+		default:
+			audit.NotIncludedFiles++
+			audit.NotIncludedBytes += size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to audit directory: %w", err)
+	}
+
+	return audit, nil
+}
+
+// IsExecutable reports whether the path has one of the ExecutableExtensions
+func IsExecutable(relPath string) bool {
+	return slices.Contains(ExecutableExtensions, path.Ext(relPath))
+}
+
+// Warnings returns problems worth a look before deploying the patterns: a
+// manifest without files, patterns removing most of the tree and patterns
+// removing executable files
+func (a *Audit) Warnings() []string {
+	var warnings []string
+
+	if a.IncludedFiles == 0 && a.TotalFiles > 0 {
+		warnings = append(warnings, fmt.Sprintf("no files would be recorded; the patterns exclude all %d files", a.TotalFiles))
+	} else if excluded := a.TotalFiles - a.IncludedFiles; a.TotalFiles > 0 && float64(excluded)/float64(a.TotalFiles) > LargeExclusionShare {
+		warnings = append(warnings, fmt.Sprintf("the patterns exclude %d of %d files (%.0f%%)", excluded, a.TotalFiles, 100*float64(excluded)/float64(a.TotalFiles)))
+	}
+
+	for _, pa := range a.Patterns {
+		if a.TotalFiles > 0 && float64(pa.Files)/float64(a.TotalFiles) > LargeExclusionShare {
+			warnings = append(warnings, fmt.Sprintf("%s %q alone excludes %d of %d files", pa.Kind, pa.Pattern, pa.Files, a.TotalFiles))
+		}
+		if pa.Executables > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s %q excludes %d executable files, e.g. %q", pa.Kind, pa.Pattern, pa.Executables, pa.Examples[0]))
+		}
+	}
+
+	return warnings
+}
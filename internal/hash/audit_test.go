@@ -0,0 +1,91 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"index.php":            "<?php // front",
+		"app/Kernel.php":       "<?php // kernel",
+		"app/debug.log":        "0123456789",
+		"storage/logs/app.log": "01234",
+		"storage/cache/x.php":  "<?php // compiled",
+		"docs/guide.md":        "# guide",
+	}
+	for f, content := range files {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := Filter{
+		Includes: []string{"app/**", "storage/**", "index.php"},
+		Excludes: []string{"storage/**", "unused/**"},
+		Rules:    []Rule{{Pattern: "**/*.log"}},
+	}
+	audit, err := AuditDirectory(context.Background(), tempDir, filter)
+	if err != nil {
+		t.Fatalf("AuditDirectory() error = %v", err)
+	}
+
+	if audit.TotalFiles != 6 || audit.IncludedFiles != 2 || audit.NotIncludedFiles != 1 {
+		t.Errorf("TotalFiles, IncludedFiles, NotIncludedFiles = %d, %d, %d, want 6, 2, 1", audit.TotalFiles, audit.IncludedFiles, audit.NotIncludedFiles)
+	}
+	if audit.NotIncludedBytes != int64(len(files["docs/guide.md"])) {
+		t.Errorf("NotIncludedBytes = %d", audit.NotIncludedBytes)
+	}
+
+	want := []PatternAudit{
+		{Pattern: "storage/**", Kind: RuleExclude, Files: 2, Bytes: 22, Executables: 1, Examples: []string{"storage/cache/x.php"}},
+		{Pattern: "unused/**", Kind: RuleExclude},
+		{Pattern: "**/*.log", Kind: RuleExcludeFile, Files: 1, Bytes: 10},
+	}
+	if !reflect.DeepEqual(audit.Patterns, want) {
+		t.Errorf("Patterns = %+v, want %+v", audit.Patterns, want)
+	}
+
+	warnings := strings.Join(audit.Warnings(), "\n")
+	for _, want := range []string{
+		"the patterns exclude 4 of 6 files (67%)",
+		`exclude pattern "storage/**" excludes 1 executable files, e.g. "storage/cache/x.php"`,
+	} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("Warnings() should contain %q, got:\n%s", want, warnings)
+		}
+	}
+
+	// A pattern given twice is one row holding every file it excludes
+	filter.Excludes = []string{"storage/**", "unused/**", "storage/**"}
+	filter.Rules = []Rule{{Pattern: "**/*.log"}, {Pattern: "**/*.log"}}
+	audit, err = AuditDirectory(context.Background(), tempDir, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(audit.Patterns, want) {
+		t.Errorf("Patterns with duplicates = %+v, want %+v", audit.Patterns, want)
+	}
+
+	// Excluding everything
+	audit, err = AuditDirectory(context.Background(), tempDir, Filter{Excludes: []string{"**"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings = strings.Join(audit.Warnings(), "\n")
+	for _, want := range []string{"no files would be recorded", `exclude pattern "**" alone excludes 6 of 6 files`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("Warnings() should contain %q, got:\n%s", want, warnings)
+		}
+	}
+}
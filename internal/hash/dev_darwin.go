@@ -0,0 +1,11 @@
+//go:build darwin
+
+package hash
+
+import "syscall"
+
+// deviceNumbers extracts major and minor numbers from a device node on Darwin
+func deviceNumbers(stat *syscall.Stat_t) (uint32, uint32) {
+	dev := uint32(stat.Rdev)
+	return (dev >> 24) & 0xff, dev & 0xffffff
+}
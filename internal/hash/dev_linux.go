@@ -0,0 +1,13 @@
+//go:build linux
+
+package hash
+
+import "syscall"
+
+// deviceNumbers extracts major and minor numbers from a device node on Linux
+func deviceNumbers(stat *syscall.Stat_t) (uint32, uint32) {
+	dev := stat.Rdev
+	major := uint32((dev>>8)&0xfff) | uint32((dev>>32)&^0xfff)
+	minor := uint32(dev&0xff) | uint32((dev>>12)&^0xff)
+	return major, minor
+}
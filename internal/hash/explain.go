@@ -0,0 +1,100 @@
+package hash
+
+import "fmt"
+
+// RuleKind names where the pattern deciding about a path comes from
+type RuleKind string
+
+const (
+	RuleExclude     RuleKind = "exclude"      // An -exclude pattern
+	RuleExcludeFile RuleKind = "exclude_rule" // A rule from an -exclude-from file
+	RuleInclude     RuleKind = "include"      // An -include pattern
+)
+
+// String returns a label for messages, e.g. "exclude pattern"
+func (k RuleKind) String() string {
+	switch k {
+	case RuleExcludeFile:
+		return "exclude file rule"
+	default:
+		return string(k) + " pattern"
+	}
+}
+
+// Explanation describes why a path is or is not recorded in a manifest
+type Explanation struct {
+	Path     string   `json:"path"`
+	IsDir    bool     `json:"is_dir,omitempty"`
+	Included bool     `json:"included"`
+	Pattern  string   `json:"pattern,omitempty"`   // The pattern or rule that decided
+	Kind     RuleKind `json:"kind,omitempty"`      // Where Pattern comes from
+	PrunedBy string   `json:"pruned_by,omitempty"` // Parent directory the walk does not descend into
+	Reason   string   `json:"reason"`
+}
+
+// Explain reports whether relPath would be recorded, following the same
+// steps as the directory walk: every parent directory is checked first,
+// since the walk never looks inside a skipped directory.
+func (f Filter) Explain(relPath string, isDir bool) Explanation {
+	e := Explanation{Path: relPath, IsDir: isDir}
+
+	var parents []string
+	if relPath != "." {
+		parents = append([]string{"."}, parentDirs(relPath)...)
+	}
+	for _, dir := range parents {
+		if pattern, kind := f.excludedBy(dir, true); pattern != "" {
+			e.Pattern, e.Kind, e.PrunedBy = pattern, kind, dir
+			e.Reason = fmt.Sprintf("parent directory %s is excluded by %s %q", dir, kind, pattern)
+			return e
+		}
+		record, descend := f.includeDirectory(dir)
+		if !record && !descend {
+			e.PrunedBy = dir
+			e.Reason = fmt.Sprintf("parent directory %s cannot contain a path matching an include pattern", dir)
+			return e
+		}
+		if !record {
+			continue
+		}
+		if pattern, kind := f.prunedBy(dir); pattern != "" {
+			e.Pattern, e.Kind, e.PrunedBy = pattern, kind, dir
+			e.Reason = fmt.Sprintf("contents of %s are skipped: %s %q matches everything below it", dir, kind, pattern)
+			return e
+		}
+	}
+
+	if pattern, kind := f.excludedBy(relPath, isDir); pattern != "" {
+		e.Pattern, e.Kind = pattern, kind
+		e.Reason = fmt.Sprintf("excluded by %s %q", kind, pattern)
+		return e
+	}
+
+	if isDir {
+		if record, _ := f.includeDirectory(relPath); !record {
+			e.Reason = "not matched by any include pattern"
+			return e
+		}
+	} else if !f.Included(relPath) {
+		e.Reason = "not matched by any include pattern"
+		return e
+	}
+
+	e.Included = true
+	switch {
+	case matchingPattern(relPath, f.Includes) != "":
+		e.Pattern, e.Kind = matchingPattern(relPath, f.Includes), RuleInclude
+		e.Reason = fmt.Sprintf("matches %s %q", RuleInclude, e.Pattern)
+	case len(f.Includes) > 0:
+		e.Reason = "directory leads to an include pattern"
+	default:
+		e.Reason = "not excluded"
+	}
+
+	// A negated rule re-including the path is the rule responsible
+	if _, rule := matchRules(f.Rules, relPath, isDir); rule != nil && rule.Negate {
+		e.Pattern, e.Kind = rule.String(), RuleExcludeFile
+		e.Reason = fmt.Sprintf("re-included by %s %q", RuleExcludeFile, e.Pattern)
+	}
+	return e
+}
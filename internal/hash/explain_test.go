@@ -0,0 +1,50 @@
+package hash
+
+import "testing"
+
+func TestFilterExplain(t *testing.T) {
+	filter := Filter{
+		Includes: []string{"app/**", "config", "public/*.php"},
+		Excludes: []string{"app/cache/**", "app/tmp"},
+		Rules: []Rule{
+			{Pattern: "**/*.log"},
+			{Pattern: "**/audit.log", Negate: true},
+			{Pattern: "**/sessions", DirOnly: true},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		isDir    bool
+		included bool
+		pattern  string
+		kind     RuleKind
+		prunedBy string
+		reason   string
+	}{
+		{"app/Kernel.php", false, true, "app/**", RuleInclude, "", `matches include pattern "app/**"`},
+		{"config/app.php", false, true, "config", RuleInclude, "", `matches include pattern "config"`},
+		{"public", true, true, "", "", "", "directory leads to an include pattern"},
+		{"public/index.php", false, true, "public/*.php", RuleInclude, "", `matches include pattern "public/*.php"`},
+		{"public/css/app.css", false, false, "", "", "", "not matched by any include pattern"},
+		{"vendor/autoload.php", false, false, "", "", "vendor", "parent directory vendor cannot contain a path matching an include pattern"},
+		{"app/cache/view.php", false, false, "app/cache/**", RuleExclude, "app/cache", `contents of app/cache are skipped: exclude pattern "app/cache/**" matches everything below it`},
+		{"app/tmp/x/y.php", false, false, "app/tmp", RuleExclude, "app/tmp", `parent directory app/tmp is excluded by exclude pattern "app/tmp"`},
+		{"app/tmp", true, false, "app/tmp", RuleExclude, "", `excluded by exclude pattern "app/tmp"`},
+		{"app/debug.log", false, false, "**/*.log", RuleExcludeFile, "", `excluded by exclude file rule "**/*.log"`},
+		{"app/audit.log", false, true, "!**/audit.log", RuleExcludeFile, "", `re-included by exclude file rule "!**/audit.log"`},
+		{"app/sessions/abc", false, false, "**/sessions/", RuleExcludeFile, "app/sessions", `parent directory app/sessions is excluded by exclude file rule "**/sessions/"`},
+		{"app/sessions", false, true, "app/**", RuleInclude, "", `matches include pattern "app/**"`},
+	}
+
+	for _, tt := range tests {
+		got := filter.Explain(tt.path, tt.isDir)
+		if got.Included != tt.included || got.Pattern != tt.pattern || got.Kind != tt.kind || got.PrunedBy != tt.prunedBy || got.Reason != tt.reason {
+			t.Errorf("Explain(%q, %v) = %+v", tt.path, tt.isDir, got)
+		}
+	}
+
+	if got := (Filter{}).Explain("anything", false); !got.Included || got.Reason != "not excluded" {
+		t.Errorf("Explain() without patterns = %+v", got)
+	}
+}
@@ -0,0 +1,172 @@
+package hash
+
+import (
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+)
+
+// Filter selects the entries recorded in a manifest.
+// Excludes and Rules take precedence over includes. Without includes every
+// entry is included; with includes an entry is included when it or one of its
+// parent directories matches an include pattern.
+type Filter struct {
+	Includes []string
+	Excludes []string
+	Rules    []Rule // gitignore-style rules where the last match wins
+
+	// Root is prepended to the walked paths before matching, so the patterns
+	// of a manifest with several roots are written as "root/path"
+	Root string
+}
+
+// scoped returns the path the patterns are matched against for a path
+// relative to the walked directory
+func (f Filter) scoped(relPath string) string {
+	if f.Root == "" {
+		return relPath
+	}
+	if relPath == "." {
+		return f.Root
+	}
+	return f.Root + "/" + relPath
+}
+
+// excluded reports whether an entry is excluded by the exclude patterns or rules
+func (f Filter) excluded(relPath string, isDir bool) bool {
+	return matchExcludePatterns(relPath, f.Excludes) || excludedByRules(f.Rules, relPath, isDir)
+}
+
+// excludesAllBelow reports whether nothing inside dir can be recorded
+func (f Filter) excludesAllBelow(dir string) bool {
+	return shouldSkipDirectory(dir, f.Excludes) || rulesExcludeAllBelow(f.Rules, dir)
+}
+
+// Included reports whether relPath is selected by the include patterns
+func (f Filter) Included(relPath string) bool {
+	if len(f.Includes) == 0 {
+		return true
+	}
+	return matchExcludePatterns(relPath, f.Includes)
+}
+
+// visitDirectory decides whether a directory is recorded and whether the walk
+// descends into it, applying the exclude patterns and rules before includes
+func (f Filter) visitDirectory(dir string) (record, descend bool) {
+	if f.excluded(dir, true) {
+		return false, false
+	}
+
+	record, descend = f.includeDirectory(dir)
+	if !record {
+		return false, descend
+	}
+
+	// The directory itself is recorded even if its contents are excluded,
+	// so "logs/**" still detects a deleted or world-writable "logs"
+	return true, !f.excludesAllBelow(dir)
+}
+
+// includeFile reports whether a file, symlink or special file is recorded
+func (f Filter) includeFile(relPath string) bool {
+	return !f.excluded(relPath, false) && f.Included(relPath)
+}
+
+// includeDirectory decides whether a directory that is not excluded is
+// recorded and whether the walk descends into it. Directories leading to an
+// include pattern are recorded; directories that cannot contain an included
+// path are neither recorded nor walked.
+func (f Filter) includeDirectory(dir string) (record, descend bool) {
+	if len(f.Includes) == 0 || dir == "." || f.Included(dir) {
+		return true, true
+	}
+
+	for _, prefix := range f.includePrefixes() {
+		switch {
+		case prefix == "":
+			// The pattern can match at any depth
+			return true, true
+		case prefix == dir || strings.HasPrefix(prefix, dir+"/"):
+			// The directory leads to the pattern
+			return true, true
+		case strings.HasPrefix(dir, prefix+"/"):
+			// The pattern may match something below this directory
+			descend = true
+		}
+	}
+	return false, descend
+}
+
+// includePrefixes returns the literal prefix of every alternative of the include patterns
+func (f Filter) includePrefixes() []string {
+	var prefixes []string
+	for _, pattern := range f.Includes {
+		alternatives, err := glob.Expand(pattern)
+		if err != nil {
+			continue // Malformed patterns match nothing
+		}
+		for _, alt := range alternatives {
+			prefixes = append(prefixes, literalPrefix(alt))
+		}
+	}
+	return prefixes
+}
+
+// literalPrefix returns the leading path segments of a pattern that contain no
+// glob metacharacters, e.g. "public" for "public/*.php"
+func literalPrefix(pattern string) string {
+	var segments []string
+	for segment := range strings.SplitSeq(pattern, "/") {
+		if strings.ContainsAny(segment, `*?[{\`) {
+			break
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// parentPath returns the parent of a slash-separated relative path, or "." at the top
+func parentPath(p string) string {
+	i := strings.LastIndex(p, "/")
+	if i < 0 {
+		return "."
+	}
+	return p[:i]
+}
+
+// ExcludedBy returns the exclude pattern or rule that excludes relPath, or an
+// empty string when it is not excluded. isDir tells whether relPath itself is
+// a directory, which matters for directory-only rules.
+func (f Filter) ExcludedBy(relPath string, isDir bool) string {
+	rule, _ := f.excludedBy(relPath, isDir)
+	return rule
+}
+
+// excludedBy returns the exclude pattern or rule that excludes relPath and
+// whether it is an exclude pattern or a rule from an exclude file
+func (f Filter) excludedBy(relPath string, isDir bool) (string, RuleKind) {
+	if pattern := matchingPattern(relPath, f.Excludes); pattern != "" {
+		return pattern, RuleExclude
+	}
+	for _, dir := range parentDirs(relPath) {
+		if excluded, rule := matchRules(f.Rules, dir, true); excluded {
+			return rule.String(), RuleExcludeFile
+		}
+	}
+	if excluded, rule := matchRules(f.Rules, relPath, isDir); excluded {
+		return rule.String(), RuleExcludeFile
+	}
+	return "", ""
+}
+
+// prunedBy returns the exclude pattern or rule that makes the walk skip the
+// contents of dir, or an empty string
+func (f Filter) prunedBy(dir string) (string, RuleKind) {
+	if pattern := skipPattern(dir, f.Excludes); pattern != "" {
+		return pattern, RuleExclude
+	}
+	if rule := ruleExcludingAllBelow(f.Rules, dir); rule != nil {
+		return rule.String(), RuleExcludeFile
+	}
+	return "", ""
+}
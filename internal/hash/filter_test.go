@@ -0,0 +1,200 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilterIncluded(t *testing.T) {
+	filter := Filter{Includes: []string{"app/**", "config", "public/*.php"}}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"app/Http/Kernel.php", true},
+		{"config", true},
+		{"config/app.php", true},
+		{"config/nested/db.php", true},
+		{"public/index.php", true},
+		{"public/css/app.css", false},
+		{"public/robots.txt", false},
+		{"vendor/autoload.php", false},
+		{"README.md", false},
+	}
+
+	for _, tt := range tests {
+		if got := filter.Included(tt.path); got != tt.want {
+			t.Errorf("included(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if !(Filter{}).Included("anything/at/all") {
+		t.Error("a filter without includes should include everything")
+	}
+}
+
+func TestFilterIncludeDirectory(t *testing.T) {
+	filter := Filter{Includes: []string{"app/**", "public/*.php", "resources/views/**"}}
+
+	tests := []struct {
+		dir     string
+		record  bool
+		descend bool
+	}{
+		{".", true, true},
+		{"app", true, true},
+		{"app/Models", true, true},
+		{"public", true, true},
+		{"public/css", false, true},
+		{"resources", true, true},
+		{"resources/views", true, true},
+		{"resources/lang", false, false},
+		{"vendor", false, false},
+	}
+
+	for _, tt := range tests {
+		record, descend := filter.includeDirectory(tt.dir)
+		if record != tt.record || descend != tt.descend {
+			t.Errorf("includeDirectory(%q) = %v, %v; want %v, %v", tt.dir, record, descend, tt.record, tt.descend)
+		}
+	}
+
+	// Patterns without a literal prefix can match anywhere
+	record, descend := Filter{Includes: []string{"**/*.php"}}.includeDirectory("vendor/lib")
+	if !record || !descend {
+		t.Errorf("includeDirectory with **/*.php = %v, %v; want true, true", record, descend)
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	tests := map[string]string{
+		"app/**":             "app",
+		"public/*.php":       "public",
+		"a/b/c":              "a/b/c",
+		"**/*.js":            "",
+		"src/{a,b}/x":        "src",
+		"lib/[abc]/file.txt": "lib",
+	}
+	for pattern, want := range tests {
+		if got := literalPrefix(pattern); got != want {
+			t.Errorf("literalPrefix(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestCalculateDirectoryWithIncludes(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := []string{
+		"app/Http/Kernel.php",
+		"app/cache/compiled.php",
+		"config/app.php",
+		"public/index.php",
+		"public/css/app.css",
+		"vendor/autoload.php",
+		"README.md",
+	}
+	for _, f := range files {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calc := NewCalculator(1)
+	result, err := calc.CalculateDirectoryWithFilter(context.Background(), tempDir, Filter{
+		Includes: []string{"app/**", "config/**", "public/*.php"},
+		Excludes: []string{"app/cache/**"},
+	})
+	if err != nil {
+		t.Fatalf("CalculateDirectoryWithFilter() error = %v", err)
+	}
+
+	var gotFiles, gotDirs []string
+	for _, f := range result.Files {
+		gotFiles = append(gotFiles, f.Path)
+	}
+	for _, d := range result.Directories {
+		gotDirs = append(gotDirs, d.Path)
+	}
+
+	wantFiles := []string{"app/Http/Kernel.php", "config/app.php", "public/index.php"}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf("Files = %v, want %v", gotFiles, wantFiles)
+	}
+	wantDirs := []string{".", "app", "app/Http", "app/cache", "config", "public"}
+	if !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf("Directories = %v, want %v", gotDirs, wantDirs)
+	}
+}
+
+func TestWalkMatchesDirectMatching(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := []string{
+		"index.php",
+		"app.log",
+		"app/cache/view.tmp",
+		"app/x/y/cache/data.tmp",
+		"app/x/y/cache/keep.php",
+		"logs/2024/app.log",
+		"web/node_modules/lodash/test/a.js",
+		"web/node_modules/lodash/lib/a.js",
+		"node_modules/test/spec.js",
+		"src/{weird}/file.go",
+		"src/[x]/file.go",
+		"vendor/pkg/README.md",
+		"vendor/pkg/main.go",
+	}
+	for _, f := range files {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patternSets := [][]string{
+		{"app/**/cache/*.tmp"},
+		{"**/node_modules/**/test/**"},
+		{"logs"},
+		{"logs/*"},
+		{"*.log"},
+		{"**/*.{log,tmp}"},
+		{`src/\{weird}/**`, `src/\[x]`},
+		{"vendor/*/[A-Z]*.md"},
+		{"**/cache/**", "web/**"},
+	}
+
+	calc := NewCalculator(1)
+	for _, excludes := range patternSets {
+		result, err := calc.CalculateDirectory(context.Background(), tempDir, excludes)
+		if err != nil {
+			t.Fatalf("CalculateDirectory(%v) error = %v", excludes, err)
+		}
+
+		walked := make(map[string]bool)
+		for _, f := range result.Files {
+			walked[f.Path] = true
+		}
+
+		for _, f := range files {
+			direct := !matchExcludePatterns(f, excludes)
+			if walked[f] != direct {
+				t.Errorf("excludes %v: %s walked=%v direct=%v", excludes, f, walked[f], direct)
+			}
+			if explained := (Filter{Excludes: excludes}).Explain(f, false); explained.Included != walked[f] {
+				t.Errorf("excludes %v: %s walked=%v explained=%+v", excludes, f, walked[f], explained)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardLinks(t *testing.T) {
+	tempDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(tempDir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "bin/php"), []byte("interpreter"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(tempDir, "bin/php"), filepath.Join(tempDir, "bin/php8")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(tempDir, "bin/php"), filepath.Join(tempDir, "app-php")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	calc := NewCalculator(2)
+
+	// Each inode is collected once
+	col, err := calc.collectFiles(tempDir, Filter{})
+	if err != nil {
+		t.Fatalf("collectFiles() error = %v", err)
+	}
+	if len(col.files) != 2 {
+		t.Errorf("collected %d files to hash, want 2: %v", len(col.files), col.files)
+	}
+
+	result, err := calc.CalculateDirectory(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("CalculateDirectory() error = %v", err)
+	}
+	if result.FileCount != 4 {
+		t.Fatalf("FileCount = %d, want 4", result.FileCount)
+	}
+
+	entries := make(map[string]FileInfo)
+	for _, f := range result.Files {
+		entries[f.Path] = f
+	}
+
+	for _, path := range []string{"app-php", "bin/php", "bin/php8"} {
+		f := entries[path]
+		if f.Nlink != 3 || f.LinkGroup != "app-php" {
+			t.Errorf("%s: nlink=%d group=%q, want 3 and app-php", path, f.Nlink, f.LinkGroup)
+		}
+		if f.Hash != entries["app-php"].Hash || f.Hash == "" {
+			t.Errorf("%s: hash %q should match the group", path, f.Hash)
+		}
+	}
+	if f := entries["index.php"]; f.Nlink != 1 || f.LinkGroup != "" {
+		t.Errorf("index.php: nlink=%d group=%q, want 1 and no group", f.Nlink, f.LinkGroup)
+	}
+
+	// Files are sorted including the expanded links
+	for i := 1; i < len(result.Files); i++ {
+		if result.Files[i-1].Path > result.Files[i].Path {
+			t.Errorf("files are not sorted: %s before %s", result.Files[i-1].Path, result.Files[i].Path)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package hash
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -15,26 +14,40 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/catatsuy/kekkai/internal/cache"
+	"github.com/catatsuy/kekkai/internal/glob"
 	"golang.org/x/time/rate"
 )
 
-// FileInfo represents information about a single file or symlink
+// FileInfo represents information about a single file, symlink, directory or
+// special file. Directories and special files have no hash and a size of zero.
 type FileInfo struct {
-	Path       string    `json:"path"`
-	Hash       string    `json:"hash"`
-	Size       int64     `json:"size"`
-	ModTime    time.Time `json:"mod_time"`
-	IsSymlink  bool      `json:"is_symlink,omitempty"`
-	LinkTarget string    `json:"link_target,omitempty"`
+	Path        string    `json:"path"`
+	Hash        string    `json:"hash"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	IsSymlink   bool      `json:"is_symlink,omitempty"`
+	IsDir       bool      `json:"is_dir,omitempty"`
+	Type        string    `json:"type,omitempty"`      // Set for special files: fifo, socket, char or block
+	DevMajor    uint32    `json:"dev_major,omitempty"` // Device numbers for char and block devices
+	DevMinor    uint32    `json:"dev_minor,omitempty"`
+	LinkTarget  string    `json:"link_target,omitempty"`
+	Mode        string    `json:"mode,omitempty"` // Permission and special bits in octal (e.g. "4755")
+	UID         *uint32   `json:"uid,omitempty"`
+	GID         *uint32   `json:"gid,omitempty"`
+	Nlink       uint64    `json:"nlink,omitempty"`        // Hard link count of regular files, including links outside the tree
+	LinkGroup   string    `json:"link_group,omitempty"`   // First path of the hard-link group within the tree
+	XattrDigest string    `json:"xattr_digest,omitempty"` // Digest of the selected xattr namespaces (empty when none are set)
 }
 
 // Result represents the result of hash calculation
 type Result struct {
-	Files     []FileInfo `json:"files"`
-	FileCount int        `json:"file_count"`
+	Files       []FileInfo `json:"files"`
+	FileCount   int        `json:"file_count"`
+	Directories []FileInfo `json:"directories,omitempty"` // Includes the root directory as "."
 }
 
 // Calculator handles hash calculation for files and directories
@@ -47,6 +60,9 @@ type Calculator struct {
 	verifyProbability float64                 // Probability of hash verification (0.0-1.0)
 	manifestHashes    map[string]string       // Optional manifest hashes for cache-based verification
 	debugMode         bool                    // Enable debug output for cache behavior
+	xattrNamespaces   []string                // Extended attribute namespaces to record (nil = disabled)
+	algorithm         Algorithm               // Digest of file contents ("" = DefaultAlgorithm)
+	maxLinkGroups     int                     // Open hard-link groups kept by Stream (0 = defaultMaxLinkGroups)
 }
 
 // throttledCopy performs io.CopyBuffer with rate limiting
@@ -187,6 +203,17 @@ func (c *Calculator) SetDebugMode(debug bool) {
 	c.debugMode = debug
 }
 
+// SetAlgorithm sets the digest used for file contents
+func (c *Calculator) SetAlgorithm(algorithm Algorithm) {
+	c.algorithm = algorithm
+}
+
+// SetXattrNamespaces enables recording a digest of the extended attributes in
+// the given namespaces (e.g. "security", "system") for every entry
+func (c *Calculator) SetXattrNamespaces(namespaces []string) {
+	c.xattrNamespaces = namespaces
+}
+
 // UpdateCacheForFiles updates cache entries for all provided files
 func (c *Calculator) UpdateCacheForFiles(rootDir string, files []FileInfo) error {
 	if c.metadataCache == nil {
@@ -194,8 +221,8 @@ func (c *Calculator) UpdateCacheForFiles(rootDir string, files []FileInfo) error
 	}
 
 	for _, file := range files {
-		// Only update cache for regular files (not symlinks)
-		if !file.IsSymlink {
+		// Only update cache for regular files (not symlinks or special files)
+		if !file.IsSymlink && file.Type == "" {
 			// Convert relative path back to absolute path
 			absPath := filepath.Join(rootDir, file.Path)
 			if err := c.metadataCache.UpdateMetadata(absPath); err != nil {
@@ -218,6 +245,11 @@ func (c *Calculator) SaveMetadataCache() error {
 
 // CalculateDirectory calculates hash for all files in a directory with context
 func (c *Calculator) CalculateDirectory(ctx context.Context, rootDir string, excludes []string) (*Result, error) {
+	return c.CalculateDirectoryWithFilter(ctx, rootDir, Filter{Excludes: excludes})
+}
+
+// CalculateDirectoryWithFilter calculates hash for the files in a directory selected by filter
+func (c *Calculator) CalculateDirectoryWithFilter(ctx context.Context, rootDir string, filter Filter) (*Result, error) {
 	// Resolve symlink if the target directory itself is a symlink
 	resolvedDir, err := filepath.EvalSymlinks(rootDir)
 	if err != nil {
@@ -225,31 +257,56 @@ func (c *Calculator) CalculateDirectory(ctx context.Context, rootDir string, exc
 	}
 
 	// Collect files
-	files, err := c.collectFiles(resolvedDir, excludes)
+	col, err := c.collectFiles(resolvedDir, filter)
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect files: %w", err)
 	}
+	dirs := col.dirs
 
 	// Calculate hashes in parallel
-	fileInfos, err := c.calculateFileHashes(ctx, resolvedDir, files)
+	fileInfos, err := c.calculateFileHashes(ctx, resolvedDir, col.files)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate file hashes: %w", err)
 	}
+	fileInfos = expandHardLinks(fileInfos, col.links)
 
 	// Sort for deterministic order
 	sort.Slice(fileInfos, func(i, j int) bool {
 		return fileInfos[i].Path < fileInfos[j].Path
 	})
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Path < dirs[j].Path
+	})
 
 	return &Result{
-		Files:     fileInfos,
-		FileCount: len(fileInfos),
+		Files:       fileInfos,
+		FileCount:   len(fileInfos),
+		Directories: dirs,
 	}, nil
 }
 
-// collectFiles walks the directory and collects files based on patterns
-func (c *Calculator) collectFiles(rootDir string, excludes []string) ([]string, error) {
-	files := make([]string, 0, 50) // Start with capacity for 50 files
+// collection is the result of walking a directory
+type collection struct {
+	files []string            // Paths to hash, one per inode
+	dirs  []FileInfo          // Directory entries, which need no hashing
+	links map[string][]string // Relative paths of further hard links to a collected file, keyed by its relative path
+}
+
+// inodeKey identifies a file across hard links
+type inodeKey struct {
+	dev uint64
+	ino uint64
+}
+
+// collectFiles walks the directory and collects files based on patterns.
+// Hard links to an already collected inode are recorded in links instead of
+// files so that each inode is hashed once.
+func (c *Calculator) collectFiles(rootDir string, filter Filter) (*collection, error) {
+	col := &collection{
+		files: make([]string, 0, 50), // Start with capacity for 50 files
+		links: make(map[string][]string),
+	}
+	seen := make(map[inodeKey]string)
 
 	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -265,30 +322,72 @@ func (c *Calculator) collectFiles(rootDir string, excludes []string) ([]string,
 		// Normalize path (use forward slash even on Windows)
 		relPath = filepath.ToSlash(relPath)
 
-		// For directories, check if they should be skipped entirely
+		// Patterns see the path below the root of a multi-root manifest
+		matchPath := filter.scoped(relPath)
+
 		if info.IsDir() {
-			// Check if this directory matches exclude patterns
-			if matchExcludePatterns(relPath, excludes) {
-				return filepath.SkipDir // Skip entire directory tree
+			record, descend := filter.visitDirectory(matchPath)
+			if record {
+				dir, err := c.directoryInfo(path, relPath, info)
+				if err != nil {
+					return err
+				}
+				col.dirs = append(col.dirs, dir)
 			}
-			// Also check if this directory could contain excluded subdirectories
-			// For patterns like "logs/**", we want to skip the "logs" directory entirely
-			if shouldSkipDirectory(relPath, excludes) {
+			if !descend {
 				return filepath.SkipDir
 			}
-			return nil // Continue into this directory
+			return nil
 		}
 
-		// For files, check exclude patterns
-		if matchExcludePatterns(relPath, excludes) {
+		if !filter.includeFile(matchPath) {
 			return nil
 		}
 
-		files = append(files, path)
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && stat.Nlink > 1 {
+			key := inodeKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+			if first, ok := seen[key]; ok {
+				col.links[first] = append(col.links[first], relPath)
+				return nil
+			}
+			seen[key] = relPath
+		}
+
+		col.files = append(col.files, path)
 		return nil
 	})
 
-	return files, err
+	return col, err
+}
+
+// expandHardLinks adds an entry for every further hard link of a hashed file
+// and assigns the group name, the smallest path of the group, to all members
+func expandHardLinks(fileInfos []FileInfo, links map[string][]string) []FileInfo {
+	if len(links) == 0 {
+		return fileInfos
+	}
+
+	n := len(fileInfos)
+	for i := range n {
+		others, ok := links[fileInfos[i].Path]
+		if !ok {
+			continue
+		}
+
+		group := fileInfos[i].Path
+		for _, other := range others {
+			group = min(group, other)
+		}
+
+		fileInfos[i].LinkGroup = group
+		for _, other := range others {
+			link := fileInfos[i]
+			link.Path = other
+			fileInfos = append(fileInfos, link)
+		}
+	}
+
+	return fileInfos
 }
 
 // calculateFileHashes calculates hashes for multiple files in parallel
@@ -305,7 +404,7 @@ func (c *Calculator) calculateFileHashes(ctx context.Context, rootDir string, fi
 	for i := 0; i < c.numWorkers; i++ {
 		wg.Go(func() {
 			// Create reusable hasher and buffer for this worker
-			hasher := sha256.New()
+			hasher := c.algorithm.New()
 			buf := make([]byte, c.bufferSize)
 
 			for {
@@ -317,95 +416,12 @@ func (c *Calculator) calculateFileHashes(ctx context.Context, rootDir string, fi
 						return
 					}
 
-					info, err := os.Lstat(path) // Use Lstat to get symlink info
+					fileInfo, err := c.fileInfo(ctx, rootDir, path, hasher, buf)
 					if err != nil {
-						errors <- fmt.Errorf("failed to stat %s: %w", path, err)
+						errors <- err
 						continue
 					}
-
-					relPath, _ := filepath.Rel(rootDir, path)
-					relPath = filepath.ToSlash(relPath)
-
-					var fileHash string
-					needHashCalculation := true
-
-					// Check cache if available (not for symlinks)
-					if c.metadataCache != nil && info.Mode()&os.ModeSymlink == 0 {
-						if c.metadataCache.CheckMetadata(path) {
-							// Metadata matches - decide whether to verify based on probability
-							if c.verifyProbability == 0 || rand.Float64() > c.verifyProbability {
-								// Skip hash calculation, use manifest hash if available
-								if c.manifestHashes != nil {
-									if manifestHash, ok := c.manifestHashes[relPath]; ok {
-										fileHash = manifestHash
-										needHashCalculation = false
-										if c.debugMode {
-											fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT (using cached hash)\n", relPath)
-										}
-									}
-								} else {
-									// No manifest hashes, skip calculation anyway
-									needHashCalculation = false
-									if c.debugMode {
-										fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT (no manifest hash available)\n", relPath)
-									}
-								}
-							} else {
-								if c.debugMode {
-									fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT but verifying due to probability (%.1f)\n", relPath, c.verifyProbability)
-								}
-							}
-							// else: probabilistically verify even with cache hit
-						} else {
-							if c.debugMode {
-								fmt.Fprintf(os.Stderr, "[CACHE] %s: MISS (metadata mismatch)\n", relPath)
-							}
-						}
-					} else if c.debugMode && info.Mode()&os.ModeSymlink != 0 {
-						fmt.Fprintf(os.Stderr, "[CACHE] %s: SKIP (symlink)\n", relPath)
-					} else if c.debugMode && c.metadataCache == nil {
-						fmt.Fprintf(os.Stderr, "[CACHE] %s: SKIP (cache disabled)\n", relPath)
-					}
-
-					// Handle symlinks or calculate hash if needed
-					if needHashCalculation && info.Mode()&os.ModeSymlink != 0 {
-						target, err := os.Readlink(path)
-						if err != nil {
-							errors <- fmt.Errorf("failed to read symlink %s: %w", path, err)
-							continue
-						}
-
-						// Create a hash based on the symlink target path
-						// This ensures changes to symlink targets are detected
-						hasher.Reset()
-						hasher.Write([]byte("symlink:" + target))
-						fileHash = hex.EncodeToString(hasher.Sum(nil))
-					} else if needHashCalculation {
-						// Regular file - calculate hash
-						var err error
-						fileHash, err = c.hashFileWithHasher(ctx, path, hasher, buf)
-						if err != nil {
-							errors <- fmt.Errorf("failed to hash %s: %w", path, err)
-							continue
-						}
-
-					}
-
-					// Create result
-					results <- FileInfo{
-						Path:      relPath,
-						Hash:      fileHash,
-						Size:      info.Size(),
-						ModTime:   info.ModTime(),
-						IsSymlink: info.Mode()&os.ModeSymlink != 0,
-						LinkTarget: func() string {
-							if info.Mode()&os.ModeSymlink != 0 {
-								target, _ := os.Readlink(path)
-								return target
-							}
-							return ""
-						}(),
-					}
+					results <- fileInfo
 				}
 			}
 		})
@@ -455,9 +471,218 @@ func (c *Calculator) calculateFileHashes(ctx context.Context, rootDir string, fi
 	return fileInfos, nil
 }
 
+// directoryInfo returns the entry of a directory
+func (c *Calculator) directoryInfo(path, relPath string, info os.FileInfo) (FileInfo, error) {
+	dir := FileInfo{
+		Path:    relPath,
+		ModTime: info.ModTime(),
+		IsDir:   true,
+	}
+	setMetadata(&dir, info)
+	if err := c.setXattrDigest(&dir, path); err != nil {
+		return FileInfo{}, err
+	}
+	return dir, nil
+}
+
+// fileInfo returns the entry of a file, symlink or special file, hashing
+// regular files unless the metadata cache allows skipping them
+func (c *Calculator) fileInfo(ctx context.Context, rootDir, path string, hasher hash.Hash, buf []byte) (FileInfo, error) {
+	info, err := os.Lstat(path) // Use Lstat to get symlink info
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	relPath, _ := filepath.Rel(rootDir, path)
+	relPath = filepath.ToSlash(relPath)
+
+	// Special files are recorded by type and never opened;
+	// opening a FIFO would block forever
+	if fileType := specialFileType(info.Mode()); fileType != "" {
+		fileInfo := FileInfo{
+			Path:    relPath,
+			ModTime: info.ModTime(),
+			Type:    fileType,
+		}
+		setMetadata(&fileInfo, info)
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && (fileType == "char" || fileType == "block") {
+			fileInfo.DevMajor, fileInfo.DevMinor = deviceNumbers(stat)
+		}
+		if err := c.setXattrDigest(&fileInfo, path); err != nil {
+			return FileInfo{}, err
+		}
+		return fileInfo, nil
+	}
+
+	var fileHash string
+	needHashCalculation := true
+
+	// Check cache if available (not for symlinks)
+	if c.metadataCache != nil && info.Mode()&os.ModeSymlink == 0 {
+		if c.metadataCache.CheckMetadata(path) {
+			// Metadata matches - decide whether to verify based on probability
+			if c.verifyProbability == 0 || rand.Float64() > c.verifyProbability {
+				// Skip hash calculation, use manifest hash if available
+				if c.manifestHashes != nil {
+					if manifestHash, ok := c.manifestHashes[relPath]; ok {
+						fileHash = manifestHash
+						needHashCalculation = false
+						if c.debugMode {
+							fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT (using cached hash)\n", relPath)
+						}
+					}
+				} else {
+					// No manifest hashes, skip calculation anyway
+					needHashCalculation = false
+					if c.debugMode {
+						fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT (no manifest hash available)\n", relPath)
+					}
+				}
+			} else {
+				if c.debugMode {
+					fmt.Fprintf(os.Stderr, "[CACHE] %s: HIT but verifying due to probability (%.1f)\n", relPath, c.verifyProbability)
+				}
+			}
+			// else: probabilistically verify even with cache hit
+		} else {
+			if c.debugMode {
+				fmt.Fprintf(os.Stderr, "[CACHE] %s: MISS (metadata mismatch)\n", relPath)
+			}
+		}
+	} else if c.debugMode && info.Mode()&os.ModeSymlink != 0 {
+		fmt.Fprintf(os.Stderr, "[CACHE] %s: SKIP (symlink)\n", relPath)
+	} else if c.debugMode && c.metadataCache == nil {
+		fmt.Fprintf(os.Stderr, "[CACHE] %s: SKIP (cache disabled)\n", relPath)
+	}
+
+	// Handle symlinks or calculate hash if needed
+	if needHashCalculation && info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("failed to read symlink %s: %w", path, err)
+		}
+
+		// Create a hash based on the symlink target path
+		// This ensures changes to symlink targets are detected
+		hasher.Reset()
+		hasher.Write([]byte("symlink:" + target))
+		fileHash = hex.EncodeToString(hasher.Sum(nil))
+	} else if needHashCalculation {
+		// Regular file - calculate hash
+		var err error
+		fileHash, err = c.hashFileWithHasher(ctx, path, hasher, buf)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("failed to hash %s: %w", path, err)
+		}
+	}
+
+	// Create result
+	fileInfo := FileInfo{
+		Path:      relPath,
+		Hash:      fileHash,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		IsSymlink: info.Mode()&os.ModeSymlink != 0,
+		LinkTarget: func() string {
+			if info.Mode()&os.ModeSymlink != 0 {
+				target, _ := os.Readlink(path)
+				return target
+			}
+			return ""
+		}(),
+	}
+	setMetadata(&fileInfo, info)
+	if err := c.setXattrDigest(&fileInfo, path); err != nil {
+		return FileInfo{}, err
+	}
+	return fileInfo, nil
+}
+
+// setMetadata records the mode bits and ownership of an entry
+func setMetadata(fi *FileInfo, info os.FileInfo) {
+	fi.Mode = FormatMode(info.Mode())
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		uid, gid := stat.Uid, stat.Gid
+		fi.UID = &uid
+		fi.GID = &gid
+		// Directory link counts change with every subdirectory, so only files are tracked
+		if info.Mode().IsRegular() {
+			fi.Nlink = uint64(stat.Nlink)
+		}
+	}
+}
+
+// setXattrDigest records the extended attribute digest of an entry when enabled
+func (c *Calculator) setXattrDigest(fi *FileInfo, path string) error {
+	if len(c.xattrNamespaces) == 0 || fi.IsSymlink {
+		return nil
+	}
+	digest, err := xattrDigest(path, c.xattrNamespaces, c.algorithm)
+	if err != nil {
+		return err
+	}
+	fi.XattrDigest = digest
+	return nil
+}
+
+// FormatMode converts permission and special bits (setuid, setgid, sticky)
+// to the octal notation used by chmod
+func FormatMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// specialFileType returns the type name of a FIFO, socket or device node,
+// or an empty string for regular files, symlinks and directories
+func specialFileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeCharDevice != 0:
+		return "char"
+	case mode&os.ModeDevice != 0:
+		return "block"
+	default:
+		return ""
+	}
+}
+
+// openRegularFile opens path for reading without blocking or following symlinks,
+// and fails if it is not a regular file. This guards against a file being
+// replaced by a FIFO or device after it was classified by Lstat.
+func openRegularFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	return file, nil
+}
+
 // hashFileWithHasher calculates hash of a file using provided hasher and buffer (for reuse)
 func (c *Calculator) hashFileWithHasher(ctx context.Context, path string, hasher hash.Hash, buf []byte) (string, error) {
-	file, err := os.Open(path)
+	file, err := openRegularFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -480,81 +705,51 @@ func (c *Calculator) hashFileWithHasher(ctx context.Context, path string, hasher
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// matchExcludePatterns checks if a path matches exclude patterns
+// matchExcludePatterns checks if a path or one of its parent directories matches
+// the patterns. Checking parents gives the same answer for a path as walking the
+// tree does, where a matching directory is skipped with everything below it.
 func matchExcludePatterns(path string, excludes []string) bool {
-	for _, pattern := range excludes {
-		if matched := matchGlob(pattern, path); matched {
-			return true
-		}
-	}
-	return false
+	return matchingPattern(path, excludes) != ""
 }
 
-// shouldSkipDirectory checks if a directory should be skipped based on exclude patterns
-// This optimizes performance by skipping entire directory trees early
-func shouldSkipDirectory(dirPath string, excludes []string) bool {
-	for _, pattern := range excludes {
-		// Check for patterns that would match everything under this directory
-		// Examples:
-		// - "logs/**" should skip "logs" directory entirely
-		// - "cache/**" should skip "cache" directory entirely
-		// - "**/logs/**" should skip any "logs" directory at any level
-
-		// Pattern ends with /** - check if directory matches the prefix
-		if before, ok := strings.CutSuffix(pattern, "/**"); ok {
-			prefix := before
-
-			// Handle ** prefix patterns like "**/logs"
-			if after, ok := strings.CutPrefix(prefix, "**/"); ok {
-				dirName := after
-				if dirPath == dirName || strings.HasSuffix(dirPath, "/"+dirName) {
-					return true
-				}
-			} else if dirPath == prefix {
-				// Exact directory match
-				return true
+// matchingPattern returns the first pattern matching path or one of its
+// parent directories, or an empty string
+func matchingPattern(path string, patterns []string) string {
+	if len(patterns) == 0 {
+		return ""
+	}
+	for p := path; ; p = parentPath(p) {
+		for _, pattern := range patterns {
+			if glob.Match(pattern, p) {
+				return pattern
 			}
 		}
-
-		// Pattern is just ** - matches everything
-		if pattern == "**" || pattern == "**/*" {
-			return true
+		if p == "." {
+			return ""
 		}
 	}
-	return false
 }
 
-// matchGlob matches a glob pattern against a path
-func matchGlob(pattern, path string) bool {
-	// Handle ** for recursive matching
-	if strings.Contains(pattern, "**") {
-		// Special case: **/* matches everything
-		if pattern == "**/*" || pattern == "**" {
-			return true
-		}
+// shouldSkipDirectory checks if a directory should be skipped based on exclude patterns
+// This optimizes performance by skipping entire directory trees early
+func shouldSkipDirectory(dirPath string, excludes []string) bool {
+	return skipPattern(dirPath, excludes) != ""
+}
 
-		// Handle patterns like "src/**" which should match everything under src/
-		if before, ok := strings.CutSuffix(pattern, "/**"); ok {
-			prefix := before
-			return strings.HasPrefix(path, prefix+"/")
+// skipPattern returns the first pattern matching everything below dirPath, or an empty string
+func skipPattern(dirPath string, excludes []string) string {
+	for _, pattern := range excludes {
+		// Patterns such as "logs/**", "**/logs/**" or "cache/*" match everything
+		// below a matching directory, so there is nothing to collect inside it
+		p, err := glob.Compile(pattern)
+		if err != nil {
+			continue
 		}
-
-		// Handle patterns like "**/*.js" which should match any .js file at any depth
-		if after, ok := strings.CutPrefix(pattern, "**/"); ok {
-			suffix := after
-			matched, _ := filepath.Match(suffix, filepath.Base(path))
-			return matched
+		if p.MatchesAllBelow(dirPath) {
+			return pattern
 		}
-
-		// General case: replace ** with * for simple matching
-		simplifiedPattern := strings.ReplaceAll(pattern, "**", "*")
-		matched, _ := filepath.Match(simplifiedPattern, path)
-		return matched
 	}
-
-	// Simple glob matching
-	matched, _ := filepath.Match(pattern, path)
-	return matched
+	return ""
 }
 
 // VerifyIntegrity verifies the integrity of files against a manifest
@@ -916,3 +916,97 @@ func containsString(s, substr string) bool {
 			(s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
 				len(s) > len(substr) && containsString(s[1:len(s)-1], substr)))
 }
+
+func TestFileMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+
+	path := filepath.Join(tempDir, "suid")
+	if err := os.WriteFile(path, []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0755|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+
+	calc := NewCalculator(1)
+	result, err := calc.CalculateDirectory(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("CalculateDirectory() error = %v", err)
+	}
+	if len(result.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(result.Files))
+	}
+
+	fi := result.Files[0]
+	if fi.Mode != "4755" {
+		t.Errorf("Mode = %q, want %q", fi.Mode, "4755")
+	}
+	if fi.UID == nil || fi.GID == nil {
+		t.Fatal("UID and GID should be recorded")
+	}
+	if *fi.UID != uint32(os.Getuid()) || *fi.GID != uint32(os.Getgid()) {
+		t.Errorf("owner = %d:%d, want %d:%d", *fi.UID, *fi.GID, os.Getuid(), os.Getgid())
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		want string
+	}{
+		{0644, "0644"},
+		{0755 | os.ModeSetuid, "4755"},
+		{0755 | os.ModeSetgid, "2755"},
+		{0777 | os.ModeSticky | os.ModeDir, "1777"},
+		{0777 | os.ModeSymlink, "0777"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatMode(tt.mode); got != tt.want {
+			t.Errorf("FormatMode(%v) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateDirectoryRecordsDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"empty", "src/lib", "logs/2024", "cache"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "src/lib/app.go"), []byte("package lib"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tempDir, "empty"), 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+
+	calc := NewCalculator(1)
+	result, err := calc.CalculateDirectory(context.Background(), tempDir, []string{"logs/**", "cache"})
+	if err != nil {
+		t.Fatalf("CalculateDirectory() error = %v", err)
+	}
+
+	var paths []string
+	for _, d := range result.Directories {
+		if !d.IsDir || d.Hash != "" || d.Mode == "" {
+			t.Errorf("unexpected directory entry: %+v", d)
+		}
+		paths = append(paths, d.Path)
+	}
+
+	// "logs" is kept while its contents are excluded; "cache" itself is excluded
+	want := []string{".", "empty", "logs", "src", "src/lib"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Directories = %v, want %v", paths, want)
+	}
+
+	if result.Directories[1].Mode != "1777" {
+		t.Errorf("empty mode = %q, want %q", result.Directories[1].Mode, "1777")
+	}
+	if result.FileCount != 1 {
+		t.Errorf("FileCount = %d, want 1", result.FileCount)
+	}
+}
@@ -0,0 +1,169 @@
+package hash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+)
+
+// Rule is a resolved gitignore-style exclude rule. Pattern is already
+// anchored to the target directory, so unanchored gitignore patterns such as
+// "*.log" are stored as "**/*.log".
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Negate  bool   `json:"negate,omitempty"`   // "!pattern" re-includes what an earlier rule excluded
+	DirOnly bool   `json:"dir_only,omitempty"` // "pattern/" only matches directories
+}
+
+// String returns the rule in gitignore notation
+func (r Rule) String() string {
+	s := r.Pattern
+	if r.Negate {
+		s = "!" + s
+	}
+	if r.DirOnly {
+		s += "/"
+	}
+	return s
+}
+
+// ParseRules reads exclude rules in gitignore syntax: blank lines and "#"
+// comments are ignored, "!" negates, a trailing "/" restricts a rule to
+// directories, and a pattern containing "/" other than at the end is anchored
+// to the target directory while any other pattern matches at any depth.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		rule, ok := parseRule(scanner.Text())
+		if !ok {
+			continue
+		}
+		if err := glob.Validate(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// parseRule converts one gitignore line into a rule
+func parseRule(line string) (Rule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Rule{}, false
+	}
+
+	var rule Rule
+	switch {
+	case strings.HasPrefix(line, "!"):
+		rule.Negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if trimmed, ok := strings.CutSuffix(line, "/"); ok {
+		rule.DirOnly = true
+		line = trimmed
+	}
+	if line == "" {
+		return Rule{}, false
+	}
+
+	if anchored, ok := strings.CutPrefix(line, "/"); ok {
+		line = anchored
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+
+	rule.Pattern = line
+	return rule, line != ""
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped with a backslash
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+	return line
+}
+
+// matchRules returns whether the last rule matching path excludes it, and
+// that rule. The rule is nil when no rule matches.
+func matchRules(rules []Rule, path string, isDir bool) (bool, *Rule) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := &rules[i]
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		if glob.Match(rule.Pattern, path) {
+			return !rule.Negate, rule
+		}
+	}
+	return false, nil
+}
+
+// excludedByRules reports whether path is excluded by the rules. As in git, a
+// path below an excluded directory cannot be re-included by a negated rule.
+func excludedByRules(rules []Rule, path string, isDir bool) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	for _, dir := range parentDirs(path) {
+		if excluded, _ := matchRules(rules, dir, true); excluded {
+			return true
+		}
+	}
+	excluded, _ := matchRules(rules, path, isDir)
+	return excluded
+}
+
+// rulesExcludeAllBelow reports whether the rules exclude everything inside dir
+// so the walk can skip it
+func rulesExcludeAllBelow(rules []Rule, dir string) bool {
+	return ruleExcludingAllBelow(rules, dir) != nil
+}
+
+// ruleExcludingAllBelow returns the rule excluding everything inside dir, or
+// nil. With negated rules anything might be re-included, so no rule is returned.
+func ruleExcludingAllBelow(rules []Rule, dir string) *Rule {
+	for _, rule := range rules {
+		if rule.Negate {
+			return nil
+		}
+	}
+	for i, rule := range rules {
+		if rule.DirOnly {
+			continue
+		}
+		if p, err := glob.Compile(rule.Pattern); err == nil && p.MatchesAllBelow(dir) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// parentDirs returns the parent directories of a relative path from the top,
+// excluding "."; e.g. "a", "a/b" for "a/b/c"
+func parentDirs(path string) []string {
+	var dirs []string
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' {
+			dirs = append(dirs, path[:i])
+		}
+	}
+	return dirs
+}
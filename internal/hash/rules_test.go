@@ -0,0 +1,153 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	input := strings.Join([]string{
+		"# Logs",
+		"*.log",
+		"",
+		"!important.log",
+		"cache/",
+		"/build",
+		"docs/*.md",
+		`\#notes`,
+		`\!bang`,
+		"trailing   ",
+		`space\ `,
+		"**/tmp/**",
+	}, "\n")
+
+	rules, err := ParseRules(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+
+	want := []Rule{
+		{Pattern: "**/*.log"},
+		{Pattern: "**/important.log", Negate: true},
+		{Pattern: "**/cache", DirOnly: true},
+		{Pattern: "build"},
+		{Pattern: "docs/*.md"},
+		{Pattern: "**/#notes"},
+		{Pattern: "**/!bang"},
+		{Pattern: "**/trailing"},
+		{Pattern: "**/space "},
+		{Pattern: "**/tmp/**"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("ParseRules() =\n%v\nwant\n%v", rules, want)
+	}
+
+	if _, err := ParseRules(strings.NewReader("ok\n[broken\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ParseRules() of malformed pattern error = %v, want line 2", err)
+	}
+}
+
+func TestExcludedByRules(t *testing.T) {
+	rules := []Rule{
+		{Pattern: "**/*.log"},
+		{Pattern: "**/important.log", Negate: true},
+		{Pattern: "**/cache", DirOnly: true},
+		{Pattern: "build"},
+		{Pattern: "vendor"},
+		{Pattern: "vendor/keep.php", Negate: true},
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"logs/app.log", false, true},
+		{"logs/important.log", false, false},
+		{"cache", true, true},
+		{"app/cache", true, true},
+		{"app/cache/view.php", false, true},
+		{"cache", false, false}, // dir-only rule does not match a file
+		{"build", true, true},
+		{"build/out.js", false, true},
+		{"src/build", true, false}, // anchored
+		{"vendor/keep.php", false, true},
+		{"main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		if got := excludedByRules(rules, tt.path, tt.isDir); got != tt.want {
+			t.Errorf("excludedByRules(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestRulesExcludeAllBelow(t *testing.T) {
+	rules := []Rule{{Pattern: "**/node_modules/**"}, {Pattern: "**/cache", DirOnly: true}}
+	if !rulesExcludeAllBelow(rules, "web/node_modules") {
+		t.Error("rulesExcludeAllBelow() should prune node_modules")
+	}
+	if rulesExcludeAllBelow(rules, "web") {
+		t.Error("rulesExcludeAllBelow() should not prune web")
+	}
+
+	negated := append(rules, Rule{Pattern: "**/node_modules/keep", Negate: true})
+	if rulesExcludeAllBelow(negated, "web/node_modules") {
+		t.Error("rulesExcludeAllBelow() should not prune when a rule is negated")
+	}
+}
+
+func TestCalculateDirectoryWithRules(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := []string{
+		"app/main.go",
+		"app/debug.log",
+		"app/important.log",
+		"app/cache/data.bin",
+		"build/out.js",
+		"src/build/keep.go",
+	}
+	for _, f := range files {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := ParseRules(strings.NewReader("*.log\n!important.log\ncache/\n/build\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calc := NewCalculator(1)
+	result, err := calc.CalculateDirectoryWithFilter(context.Background(), tempDir, Filter{Rules: rules})
+	if err != nil {
+		t.Fatalf("CalculateDirectoryWithFilter() error = %v", err)
+	}
+
+	var gotFiles, gotDirs []string
+	for _, f := range result.Files {
+		gotFiles = append(gotFiles, f.Path)
+	}
+	for _, d := range result.Directories {
+		gotDirs = append(gotDirs, d.Path)
+	}
+
+	wantFiles := []string{"app/important.log", "app/main.go", "src/build/keep.go"}
+	if !reflect.DeepEqual(gotFiles, wantFiles) {
+		t.Errorf("files = %v, want %v", gotFiles, wantFiles)
+	}
+	wantDirs := []string{".", "app", "src", "src/build"}
+	if !reflect.DeepEqual(gotDirs, wantDirs) {
+		t.Errorf("directories = %v, want %v", gotDirs, wantDirs)
+	}
+}
@@ -0,0 +1,157 @@
+package hash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ScanExtensions are the default extensions flagged in excluded paths
+var ScanExtensions = []string{".php", ".phtml", ".phar", ".pht", ".php5", ".php7", ".cgi", ".pl", ".py", ".rb", ".sh", ".jsp", ".asp", ".aspx"}
+
+// scanConfigNames are per-directory server configuration files that can turn
+// on code execution for the directory they are dropped in
+var scanConfigNames = []string{".htaccess", ".user.ini"}
+
+// scanHeaderSize is the number of leading bytes read to detect scripts
+const scanHeaderSize = 512
+
+// Finding is a suspicious entry in an excluded path
+type Finding struct {
+	Path       string   `json:"path"`
+	ExcludedBy string   `json:"excluded_by"`
+	Reasons    []string `json:"reasons"`
+}
+
+// ScanExcluded walks the entries that filter excludes, without hashing them,
+// and reports the ones that look executable: a name with one of extensions
+// (before any later extension, so "a.php.jpg" counts), an executable bit,
+// a server configuration file, or content starting with a shebang or a PHP
+// open tag. Symlinks are never followed.
+func ScanExcluded(ctx context.Context, rootDir string, filter Filter, extensions []string) ([]Finding, error) {
+	resolvedDir, err := filepath.EvalSymlinks(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target directory: %w", err)
+	}
+
+	var findings []Finding
+	err = filepath.WalkDir(resolvedDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(resolvedDir, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		excludedBy := filter.ExcludedBy(filter.scoped(relPath), false)
+		if excludedBy == "" {
+			return nil
+		}
+
+		reasons, err := scanEntry(p, d, extensions)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while scanning
+			}
+			return fmt.Errorf("failed to scan %s: %w", relPath, err)
+		}
+		if len(reasons) > 0 {
+			findings = append(findings, Finding{Path: relPath, ExcludedBy: excludedBy, Reasons: reasons})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return findings, nil
+}
+
+// scanEntry returns why the entry at p looks executable
+func scanEntry(p string, d fs.DirEntry, extensions []string) ([]string, error) {
+	var reasons []string
+
+	name := d.Name()
+	if slices.Contains(scanConfigNames, strings.ToLower(name)) {
+		reasons = append(reasons, "server config file")
+	}
+	if ext := matchingExtension(name, extensions); ext != "" {
+		reasons = append(reasons, "extension "+ext)
+	}
+
+	if !d.Type().IsRegular() {
+		return reasons, nil
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0111 != 0 {
+		reasons = append(reasons, "executable bit")
+	}
+
+	header, err := readHeader(p)
+	if err != nil {
+		return nil, err
+	}
+	header = bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case bytes.HasPrefix(header, []byte("#!")):
+		reasons = append(reasons, "shebang")
+	case len(header) >= 5 && strings.EqualFold(string(header[:5]), "<?php"):
+		reasons = append(reasons, "PHP open tag")
+	}
+
+	return reasons, nil
+}
+
+// matchingExtension returns the first of extensions found among the
+// extensions of name, ignoring case, or an empty string
+func matchingExtension(name string, extensions []string) string {
+	name = strings.ToLower(strings.TrimLeft(name, "."))
+	for {
+		ext := path.Ext(name)
+		if ext == "" {
+			return ""
+		}
+		for _, e := range extensions {
+			if strings.EqualFold(e, ext) {
+				return e
+			}
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+}
+
+// readHeader returns up to scanHeaderSize leading bytes of a regular file
+func readHeader(p string) ([]byte, error) {
+	file, err := openRegularFile(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, scanHeaderSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,87 @@
+package hash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanExcluded(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]struct {
+		content string
+		mode    os.FileMode
+	}{
+		"index.php":                {"<?php // front", 0644},
+		"uploads/photo.jpg":        {"\xff\xd8\xff", 0644},
+		"uploads/shell.PHP":        {"<?php system($_GET['c']);", 0644},
+		"uploads/avatar.php.jpg":   {"\xff\xd8\xff", 0644},
+		"uploads/.htaccess":        {"AddType application/x-httpd-php .jpg", 0644},
+		"uploads/payload.txt":      {"\xef\xbb\xbf <?PHP eval($x);", 0644},
+		"tmp/run":                  {"#!/bin/sh\nid\n", 0755},
+		"tmp/blob":                 {"data", 0755},
+		"storage/logs/app.log":     {"#!not a script but still flagged", 0644},
+		"storage/cache/views.html": {"<html>", 0644},
+	}
+	for f, file := range files {
+		path := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file.content), file.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, file.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(tempDir, "uploads/link.php")); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := Filter{
+		Excludes: []string{"uploads/**", "tmp/**"},
+		Rules:    []Rule{{Pattern: "storage", DirOnly: true}},
+	}
+	findings, err := ScanExcluded(context.Background(), tempDir, filter, ScanExtensions)
+	if err != nil {
+		t.Fatalf("ScanExcluded() error = %v", err)
+	}
+
+	want := []Finding{
+		{Path: "storage/logs/app.log", ExcludedBy: "storage/", Reasons: []string{"shebang"}},
+		{Path: "tmp/blob", ExcludedBy: "tmp/**", Reasons: []string{"executable bit"}},
+		{Path: "tmp/run", ExcludedBy: "tmp/**", Reasons: []string{"executable bit", "shebang"}},
+		{Path: "uploads/.htaccess", ExcludedBy: "uploads/**", Reasons: []string{"server config file"}},
+		{Path: "uploads/avatar.php.jpg", ExcludedBy: "uploads/**", Reasons: []string{"extension .php"}},
+		{Path: "uploads/link.php", ExcludedBy: "uploads/**", Reasons: []string{"extension .php"}},
+		{Path: "uploads/payload.txt", ExcludedBy: "uploads/**", Reasons: []string{"PHP open tag"}},
+		{Path: "uploads/shell.PHP", ExcludedBy: "uploads/**", Reasons: []string{"extension .php", "PHP open tag"}},
+	}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("findings =\n%+v\nwant\n%+v", findings, want)
+	}
+}
+
+func TestMatchingExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"shell.php", ".php"},
+		{"SHELL.PhTmL", ".phtml"},
+		{"avatar.php.jpg", ".php"},
+		{"photo.jpg", ""},
+		{".php", ""},
+		{"README", ""},
+	}
+
+	for _, tt := range tests {
+		if got := matchingExtension(tt.name, ScanExtensions); got != tt.want {
+			t.Errorf("matchingExtension(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
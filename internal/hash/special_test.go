@@ -0,0 +1,92 @@
+package hash
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSpecialFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tempDir, "app.php"), []byte("<?php echo 'app';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(tempDir, "pipe"), 0644); err != nil {
+		t.Fatalf("Mkfifo() error = %v", err)
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(tempDir, "sock"))
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	// Creating device nodes needs root
+	hasDevice := syscall.Mknod(filepath.Join(tempDir, "null"), syscall.S_IFCHR|0666, 1<<8|3) == nil
+
+	// A FIFO would block os.Open forever, so guard against a hang
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	calc := NewCalculator(2)
+	result, err := calc.CalculateDirectory(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatalf("CalculateDirectory() error = %v", err)
+	}
+
+	entries := make(map[string]FileInfo)
+	for _, f := range result.Files {
+		entries[f.Path] = f
+	}
+
+	if f := entries["app.php"]; f.Type != "" || f.Hash == "" {
+		t.Errorf("app.php = %+v, want hashed regular file", f)
+	}
+	if f := entries["pipe"]; f.Type != "fifo" || f.Hash != "" || f.Size != 0 {
+		t.Errorf("pipe = %+v, want unhashed fifo", f)
+	}
+	if f := entries["sock"]; f.Type != "socket" || f.Hash != "" {
+		t.Errorf("sock = %+v, want unhashed socket", f)
+	}
+	if hasDevice {
+		if f := entries["null"]; f.Type != "char" || f.DevMajor != 1 || f.DevMinor != 3 {
+			t.Errorf("null = %+v, want char device 1:3", f)
+		}
+	}
+}
+
+func TestOpenRegularFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	regular := filepath.Join(tempDir, "file")
+	if err := os.WriteFile(regular, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pipe := filepath.Join(tempDir, "pipe")
+	if err := syscall.Mkfifo(pipe, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tempDir, "link")
+	if err := os.Symlink(regular, link); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := openRegularFile(regular)
+	if err != nil {
+		t.Fatalf("openRegularFile(file) error = %v", err)
+	}
+	file.Close()
+
+	// Must return immediately instead of waiting for a writer
+	if _, err := openRegularFile(pipe); err == nil {
+		t.Error("openRegularFile(pipe) should fail")
+	}
+	if _, err := openRegularFile(link); err == nil {
+		t.Error("openRegularFile(link) should not follow symlinks")
+	}
+}
@@ -0,0 +1,346 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// defaultMaxLinkGroups bounds the hard-link groups Stream keeps while some of
+// their links have not been walked
+const defaultMaxLinkGroups = 100_000
+
+// ErrTooManyLinkGroups is returned by Stream when more hard-link groups than
+// it keeps have links that were not walked, typically links outside the tree
+var ErrTooManyLinkGroups = errors.New("too many hard-linked files with links not walked yet")
+
+// StreamRoot is a directory walked by Stream. The paths below a named root
+// start with its name, as in a manifest with several roots; a single root
+// without a name gives the paths of CalculateDirectoryWithFilter.
+type StreamRoot struct {
+	Name string
+	Dir  string
+}
+
+// streamRoot is a root being walked
+type streamRoot struct {
+	name   string
+	dir    string                  // Resolved directory
+	filter Filter                  // Filter scoped to the root
+	seen   map[inodeKey]*linkGroup // Hard-link groups with links not walked yet
+}
+
+// linkGroup is a hard-link group being walked. It is dropped once all its
+// links were walked; links outside the tree keep it until the walk ends.
+type linkGroup struct {
+	first     *streamItem
+	remaining uint64 // Links not walked yet
+}
+
+// walkNode is an entry of a directory, or the walk into a subdirectory,
+// ordered by key among the other nodes of the directory
+type walkNode struct {
+	key     string
+	root    *streamRoot
+	path    string    // Path on disk
+	relPath string    // Path relative to the root
+	descend bool      // Walk the contents of the directory instead of recording it
+	allowed bool      // Set on a descend node once its directory was accepted
+	next    *walkNode // Descend node of a directory entry
+}
+
+// streamItem is an entry waiting to be delivered in path order
+type streamItem struct {
+	path   string
+	info   FileInfo
+	result chan streamResult // Set while the entry is being hashed
+	link   *streamItem       // First member of the hard-link group, whose hash is reused
+	linked bool              // The entry is the first member of a possible hard-link group
+}
+
+type streamResult struct {
+	info FileInfo
+	err  error
+}
+
+type streamJob struct {
+	item    *streamItem
+	rootDir string
+	path    string
+}
+
+// streamer walks the roots in path order and feeds the hashing workers
+type streamer struct {
+	c             *Calculator
+	ctx           context.Context
+	queue         chan *streamItem
+	jobs          chan streamJob
+	linkGroups    int // Open hard-link groups of all roots
+	maxLinkGroups int
+}
+
+// Stream walks the roots and calls fn for every recorded file and directory in
+// ascending path order, the order of manifest entries, so a tree can be compared
+// with a manifest without holding either in memory. Files are hashed by the
+// workers of the calculator and delivered in order; memory use depends on the
+// width of the directories, not on the number of files.
+//
+// Hard links are hashed once per root. The first member of a hard-link group
+// carries its own path as LinkGroup and later members carry the path of the
+// first; whether a first member has any other member in the tree is only known
+// when the walk is complete. A group is kept until all its links were walked;
+// ErrTooManyLinkGroups is returned when too many have links outside the tree.
+func (c *Calculator) Stream(ctx context.Context, roots []StreamRoot, filter Filter, fn func(FileInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	// The window bounds the entries between the walk and fn
+	window := min(c.numWorkers*2, 100)
+	s := &streamer{
+		c:             c,
+		ctx:           ctx,
+		queue:         make(chan *streamItem, window),
+		jobs:          make(chan streamJob, window),
+		maxLinkGroups: c.maxLinkGroups,
+	}
+	if s.maxLinkGroups == 0 {
+		s.maxLinkGroups = defaultMaxLinkGroups
+	}
+
+	for range c.numWorkers {
+		wg.Go(func() {
+			hasher := c.algorithm.New()
+			buf := make([]byte, c.bufferSize)
+
+			for job := range s.jobs {
+				if err := ctx.Err(); err != nil {
+					job.item.result <- streamResult{err: err}
+					continue
+				}
+				info, err := c.fileInfo(ctx, job.rootDir, job.path, hasher, buf)
+				job.item.result <- streamResult{info: info, err: err}
+			}
+		})
+	}
+
+	var walkErr error
+	wg.Go(func() {
+		defer close(s.jobs)
+		defer close(s.queue)
+		walkErr = s.walk(roots, filter)
+	})
+
+	for item := range s.queue {
+		switch {
+		case item.result != nil:
+			result := <-item.result
+			if result.err != nil {
+				return fmt.Errorf("failed to calculate file hashes: %w", result.err)
+			}
+			item.info = result.info
+			item.info.Path = item.path
+			if item.linked {
+				item.info.LinkGroup = item.path
+			}
+		case item.link != nil:
+			item.info = item.link.info
+			item.info.Path = item.path
+			item.info.LinkGroup = item.link.path
+		}
+
+		if err := fn(item.info); err != nil {
+			return err
+		}
+	}
+
+	if walkErr != nil {
+		return fmt.Errorf("failed to collect files: %w", walkErr)
+	}
+	return ctx.Err()
+}
+
+// walk visits the roots. A single root without a name is walked as its own
+// contents with the root directory sorted among them as ".", named roots as
+// the entries of a virtual directory.
+func (s *streamer) walk(roots []StreamRoot, filter Filter) error {
+	var nodes []*walkNode
+	for _, r := range roots {
+		if r.Name == "" && len(roots) > 1 {
+			return fmt.Errorf("roots must be named when there are several")
+		}
+
+		resolved, err := filepath.EvalSymlinks(r.Dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve target directory: %w", err)
+		}
+
+		rootFilter := filter
+		rootFilter.Root = r.Name
+		root := &streamRoot{name: r.Name, dir: resolved, filter: rootFilter, seen: make(map[inodeKey]*linkGroup)}
+
+		if r.Name == "" {
+			nodes = append(nodes, &walkNode{key: ".", root: root, path: resolved, relPath: "."})
+			if _, descend := rootFilter.visitDirectory(rootFilter.scoped(".")); descend {
+				children, err := s.readDir(root, resolved, ".")
+				if err != nil {
+					return err
+				}
+				nodes = append(nodes, children...)
+			}
+			continue
+		}
+
+		descend := &walkNode{key: r.Name + "/", root: root, path: resolved, relPath: ".", descend: true}
+		nodes = append(nodes, &walkNode{key: r.Name, root: root, path: resolved, relPath: ".", next: descend}, descend)
+	}
+
+	return s.visit(nodes)
+}
+
+// visit processes the nodes of a directory in key order, which is the path
+// order of the entries below it: "a.txt" sorts before the contents of "a"
+// because "." sorts before "/"
+func (s *streamer) visit(nodes []*walkNode) error {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].key < nodes[j].key })
+
+	for _, node := range nodes {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+
+		if !node.descend {
+			if err := s.entry(node); err != nil {
+				return err
+			}
+			continue
+		}
+		if !node.allowed {
+			continue
+		}
+
+		children, err := s.readDir(node.root, node.path, node.relPath)
+		if err != nil {
+			return err
+		}
+		if err := s.visit(children); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir returns the nodes of the entries of a directory
+func (s *streamer) readDir(root *streamRoot, dir, relDir string) ([]*walkNode, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*walkNode, 0, len(entries))
+	for _, e := range entries {
+		relPath := e.Name()
+		if relDir != "." {
+			relPath = relDir + "/" + e.Name()
+		}
+		node := &walkNode{key: e.Name(), root: root, path: filepath.Join(dir, e.Name()), relPath: relPath}
+		nodes = append(nodes, node)
+
+		if e.IsDir() {
+			node.next = &walkNode{key: e.Name() + "/", root: root, path: node.path, relPath: relPath, descend: true}
+			nodes = append(nodes, node.next)
+		}
+	}
+	return nodes, nil
+}
+
+// entry applies the filter to an entry and queues it for delivery, hashing
+// files unless they are further hard links of a queued file
+func (s *streamer) entry(node *walkNode) error {
+	info, err := os.Lstat(node.path)
+	if err != nil {
+		return err
+	}
+
+	root := node.root
+	matchPath := root.filter.scoped(node.relPath)
+	item := &streamItem{path: streamPath(root.name, node.relPath)}
+
+	if info.IsDir() {
+		record, descend := root.filter.visitDirectory(matchPath)
+		if node.next != nil {
+			node.next.allowed = descend
+		}
+		if !record {
+			return nil
+		}
+
+		item.info, err = s.c.directoryInfo(node.path, node.relPath, info)
+		if err != nil {
+			return err
+		}
+		item.info.Path = item.path
+		return s.send(item)
+	}
+
+	if !root.filter.includeFile(matchPath) {
+		return nil
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && info.Mode().IsRegular() && stat.Nlink > 1 {
+		key := inodeKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+		if group, ok := root.seen[key]; ok {
+			item.link = group.first
+			if group.remaining--; group.remaining == 0 {
+				delete(root.seen, key)
+				s.linkGroups--
+			}
+			return s.send(item)
+		}
+		if s.linkGroups >= s.maxLinkGroups {
+			return fmt.Errorf("%w: more than %d (%s)", ErrTooManyLinkGroups, s.maxLinkGroups, node.relPath)
+		}
+		root.seen[key] = &linkGroup{first: item, remaining: uint64(stat.Nlink) - 1}
+		s.linkGroups++
+		item.linked = true
+	}
+
+	item.result = make(chan streamResult, 1)
+	if err := s.send(item); err != nil {
+		return err
+	}
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.jobs <- streamJob{item: item, rootDir: root.dir, path: node.path}:
+		return nil
+	}
+}
+
+// send queues an item for delivery in walk order
+func (s *streamer) send(item *streamItem) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.queue <- item:
+		return nil
+	}
+}
+
+// streamPath returns the path of relPath below the root name
+func streamPath(name, relPath string) string {
+	switch {
+	case name == "":
+		return relPath
+	case relPath == ".":
+		return name
+	default:
+		return name + "/" + relPath
+	}
+}
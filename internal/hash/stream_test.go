@@ -0,0 +1,159 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStreamMatchesCalculateDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Names where walk order and path order differ: "a.txt" and "a-b" sort
+	// before the contents of "a", "-x" before the root "."
+	for _, name := range []string{"a/b.txt", "a/c/d.txt", "a.txt", "a-b/e.txt", "-x/f.txt", "logs/app.log", "z.txt"} {
+		writeFile(t, filepath.Join(tempDir, name), name)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(tempDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(tempDir, "z.txt"), filepath.Join(tempDir, "a/z-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(tempDir, "a.txt"), filepath.Join(tempDir, "logs/a-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	filters := map[string]Filter{
+		"all":      {},
+		"excludes": {Excludes: []string{"logs/**"}},
+		"includes": {Includes: []string{"a/**"}},
+	}
+
+	for name, filter := range filters {
+		t.Run(name, func(t *testing.T) {
+			calc := NewCalculator(3)
+			want, err := calc.CalculateDirectoryWithFilter(context.Background(), tempDir, filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var files, dirs []FileInfo
+			err = calc.Stream(context.Background(), []StreamRoot{{Dir: tempDir}}, filter, func(f FileInfo) error {
+				if f.IsDir {
+					dirs = append(dirs, f)
+					return nil
+				}
+				// The first member of a group is resolved by the caller
+				if f.LinkGroup == f.Path && !hasLinkMember(want.Files, f.Path) {
+					f.LinkGroup = ""
+				}
+				files = append(files, f)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(files, want.Files) {
+				t.Errorf("Stream() files = %+v\nwant %+v", files, want.Files)
+			}
+			if !reflect.DeepEqual(dirs, want.Directories) {
+				t.Errorf("Stream() directories = %+v\nwant %+v", dirs, want.Directories)
+			}
+		})
+	}
+}
+
+func TestStreamRoots(t *testing.T) {
+	base := t.TempDir()
+	writeFile(t, filepath.Join(base, "www/index.php"), "<?php")
+	writeFile(t, filepath.Join(base, "www-conf/site.conf"), "server {}")
+
+	var paths []string
+	roots := []StreamRoot{{Name: "www", Dir: filepath.Join(base, "www")}, {Name: "conf", Dir: filepath.Join(base, "www-conf")}}
+	err := NewCalculator(2).Stream(context.Background(), roots, Filter{}, func(f FileInfo) error {
+		paths = append(paths, f.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	want := []string{"conf", "conf/site.conf", "www", "www/index.php"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Stream() paths = %v, want %v", paths, want)
+	}
+}
+
+func TestStreamLinkGroups(t *testing.T) {
+	base := t.TempDir()
+	tree := filepath.Join(base, "tree")
+
+	// Files linked from outside the tree, as with rsync --link-dest, keep their
+	// groups open; pairs inside the tree close theirs right away
+	for i := range 20 {
+		outside := filepath.Join(base, "backup", fmt.Sprintf("%02d.txt", i))
+		writeFile(t, outside, outside)
+		if err := os.MkdirAll(filepath.Join(tree, "shared"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(outside, filepath.Join(tree, "shared", fmt.Sprintf("%02d.txt", i))); err != nil {
+			t.Fatal(err)
+		}
+
+		pair := filepath.Join(tree, "pairs", fmt.Sprintf("%02d-a.txt", i))
+		writeFile(t, pair, pair)
+		if err := os.Link(pair, filepath.Join(tree, "pairs", fmt.Sprintf("%02d-b.txt", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stream := func(maxLinkGroups int, filter Filter) (map[string]FileInfo, error) {
+		calc := NewCalculator(2)
+		calc.maxLinkGroups = maxLinkGroups
+		entries := make(map[string]FileInfo)
+		err := calc.Stream(context.Background(), []StreamRoot{{Dir: tree}}, filter, func(f FileInfo) error {
+			entries[f.Path] = f
+			return nil
+		})
+		return entries, err
+	}
+
+	entries, err := stream(5, Filter{Excludes: []string{"shared/**"}})
+	if err != nil {
+		t.Fatalf("Stream() of closed groups error = %v", err)
+	}
+	for i := range 20 {
+		a, b := entries[fmt.Sprintf("pairs/%02d-a.txt", i)], entries[fmt.Sprintf("pairs/%02d-b.txt", i)]
+		if a.LinkGroup != a.Path || b.LinkGroup != a.Path || b.Hash != a.Hash {
+			t.Errorf("pair %d: %+v and %+v should share the group and hash", i, a, b)
+		}
+	}
+
+	if _, err := stream(5, Filter{}); !errors.Is(err, ErrTooManyLinkGroups) {
+		t.Errorf("Stream() of open groups error = %v, want ErrTooManyLinkGroups", err)
+	}
+
+	entries, err = stream(20, Filter{})
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if f := entries["shared/00.txt"]; f.Nlink != 2 || f.LinkGroup != f.Path {
+		t.Errorf("shared/00.txt = %+v, want nlink 2 and its own group", f)
+	}
+}
+
+// hasLinkMember reports whether another entry belongs to the group of path
+func hasLinkMember(files []FileInfo, path string) bool {
+	for _, f := range files {
+		if f.Path != path && f.LinkGroup == path {
+			return true
+		}
+	}
+	return false
+}
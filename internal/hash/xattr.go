@@ -0,0 +1,54 @@
+package hash
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultXattrNamespaces covers file capabilities, SELinux labels and POSIX ACLs
+var DefaultXattrNamespaces = []string{"security", "system"}
+
+// xattrDigest returns a digest of the extended attributes of path in the given
+// namespaces, or an empty string when there are none. Symlinks are not
+// inspected because the syscalls would follow them.
+func xattrDigest(path string, namespaces []string, algorithm Algorithm) (string, error) {
+	names, err := listXattrs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to list extended attributes of %s: %w", path, err)
+	}
+
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, ns := range namespaces {
+			if strings.HasPrefix(name, ns+".") {
+				selected = append(selected, name)
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return "", nil
+	}
+	sort.Strings(selected)
+
+	// Length-prefix names and values so that no two attribute sets share a digest
+	hasher := algorithm.New()
+	var length [8]byte
+	for _, name := range selected {
+		value, err := getXattr(path, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read extended attribute %s of %s: %w", name, path, err)
+		}
+		binary.BigEndian.PutUint64(length[:], uint64(len(name)))
+		hasher.Write(length[:])
+		hasher.Write([]byte(name))
+		binary.BigEndian.PutUint64(length[:], uint64(len(value)))
+		hasher.Write(length[:])
+		hasher.Write(value)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,17 @@
+//go:build darwin
+
+package hash
+
+import "errors"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// listXattrs is not implemented on Darwin
+func listXattrs(path string) ([]string, error) {
+	return nil, errXattrUnsupported
+}
+
+// getXattr is not implemented on Darwin
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
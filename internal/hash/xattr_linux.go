@@ -0,0 +1,61 @@
+//go:build linux
+
+package hash
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// listXattrs returns the names of all extended attributes of path.
+// Filesystems without xattr support report no attributes.
+func listXattrs(path string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if err != nil {
+			if errors.Is(err, syscall.ENOTSUP) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := syscall.Listxattr(path, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // Attributes were added in between
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00"), nil
+	}
+}
+
+// getXattr returns the value of a single extended attribute
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		buf := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue // Value grew in between
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[:n], nil
+	}
+}
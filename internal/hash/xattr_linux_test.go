@@ -0,0 +1,75 @@
+package hash
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestXattrDigest(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "php")
+	if err := os.WriteFile(path, []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := xattrDigest(path, []string{"user"}, SHA256)
+	if err != nil {
+		t.Fatalf("xattrDigest() error = %v", err)
+	}
+	if digest != "" {
+		t.Errorf("digest without attributes = %q, want empty", digest)
+	}
+
+	if err := syscall.Setxattr(path, "user.kekkai", []byte("one"), 0); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			t.Skip("filesystem does not support user xattrs")
+		}
+		t.Fatal(err)
+	}
+	first, err := xattrDigest(path, []string{"user"}, SHA256)
+	if err != nil {
+		t.Fatalf("xattrDigest() error = %v", err)
+	}
+	if first == "" {
+		t.Fatal("digest should cover user.kekkai")
+	}
+
+	// Attributes outside the selected namespaces are ignored
+	if digest, _ := xattrDigest(path, []string{"security"}, SHA256); digest != "" {
+		t.Errorf("security digest = %q, want empty", digest)
+	}
+
+	if err := syscall.Setxattr(path, "user.kekkai", []byte("two"), 0); err != nil {
+		t.Fatal(err)
+	}
+	second, err := xattrDigest(path, []string{"user"}, SHA256)
+	if err != nil {
+		t.Fatalf("xattrDigest() error = %v", err)
+	}
+	if first == second {
+		t.Error("digest should change with the attribute value")
+	}
+
+	// The calculator records the digest only when enabled
+	calc := NewCalculator(1)
+	result, err := calc.CalculateDirectory(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files[0].XattrDigest != "" {
+		t.Error("XattrDigest should not be recorded by default")
+	}
+
+	calc.SetXattrNamespaces([]string{"user"})
+	result, err = calc.CalculateDirectory(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files[0].XattrDigest != second {
+		t.Errorf("XattrDigest = %q, want %q", result.Files[0].XattrDigest, second)
+	}
+}
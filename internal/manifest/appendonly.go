@@ -0,0 +1,137 @@
+package manifest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// appendState is the state of the append-only files kept by verify between
+// runs, so content appended after the manifest was generated is protected too
+type appendState struct {
+	ManifestGeneratedAt string             `json:"manifest_generated_at"`
+	Files               []hash.AppendEntry `json:"files"`
+}
+
+// withoutAppendOnly drops the entries tracked by the append-only check
+func (m *Manifest) withoutAppendOnly(files []hash.FileInfo) []hash.FileInfo {
+	if len(m.AppendOnly) == 0 {
+		return files
+	}
+
+	kept := make([]hash.FileInfo, 0, len(files))
+	for _, f := range files {
+		if _, ok := hash.MatchAppendRule(m.AppendOnly, f.Path); !ok {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// checkAppendOnly adds the append-only files that were truncated, rewritten
+// or deleted to the report. With statePath, the check starts from the state
+// saved by the previous run of the same manifest and saves the new state.
+func (m *Manifest) checkAppendOnly(ctx context.Context, targetDir, statePath string, report *VerificationReport) error {
+	for _, rule := range m.AppendOnly {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid append-only rule: %w", err)
+		}
+	}
+
+	previous := m.AppendFiles
+	if statePath != "" {
+		state, err := loadAppendState(statePath)
+		if err != nil {
+			return err
+		}
+		// A new manifest starts over from its own entries
+		if state != nil && state.ManifestGeneratedAt == m.GeneratedAt {
+			previous = state.Files
+		}
+	}
+
+	checks, err := hash.CheckAppendOnly(ctx, targetDir, m.AppendOnly, previous, m.HashAlgorithm.OrDefault())
+	if err != nil {
+		return fmt.Errorf("failed to check append-only files: %w", err)
+	}
+
+	next := &appendState{ManifestGeneratedAt: m.GeneratedAt}
+	for _, check := range checks {
+		if check.Previous != nil {
+			report.TotalFiles++
+		}
+
+		if check.Status.Violated() {
+			change := Change{Path: check.Path, Kind: ChangeAppend, Reason: string(check.Status), OldSize: &check.Previous.Size}
+			if check.Current != nil {
+				change.NewSize = &check.Current.Size
+			}
+			report.Changes = append(report.Changes, change)
+			// Keep reporting the violation until a new manifest is deployed
+			next.Files = append(next.Files, *check.Previous)
+			continue
+		}
+
+		if check.Previous != nil {
+			report.VerifiedFiles++
+		}
+		if check.Current != nil {
+			next.Files = append(next.Files, *check.Current)
+		}
+	}
+	report.sortChanges()
+
+	if statePath != "" {
+		return saveAppendState(statePath, next)
+	}
+	return nil
+}
+
+// loadAppendState reads the append-only state, or returns nil if there is none yet
+func loadAppendState(path string) (*appendState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read append-only state: %w", err)
+	}
+
+	var state appendState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse append-only state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveAppendState replaces the append-only state file atomically
+func saveAppendState(path string, state *appendState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal append-only state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".kekkai-append-*")
+	if err != nil {
+		return fmt.Errorf("failed to create append-only state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write append-only state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write append-only state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save append-only state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+func TestVerifyAppendOnly(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "storage/logs/app.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte("boot\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	generator.SetAppendOnly([]hash.AppendRule{{Path: "storage/logs/*.log", Rotate: []string{".1"}}})
+	m, err := generator.Generate(context.Background(), tempDir, []string{"storage/**"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if m.FileCount != 1 || len(m.AppendFiles) != 1 || m.AppendFiles[0].Size != 5 {
+		t.Fatalf("FileCount = %d, AppendFiles = %+v", m.FileCount, m.AppendFiles)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "append-state.json")
+	m.SetVerifyOptions(VerifyOptions{AppendState: statePath})
+
+	write := func(content string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|flag, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("request 1\n", os.O_APPEND)
+	report, err := m.Verify(context.Background(), tempDir, 0)
+	if err != nil {
+		t.Fatalf("Verify() should accept appended lines, got: %v", err)
+	}
+	if report.TotalFiles != 2 || report.VerifiedFiles != 2 {
+		t.Errorf("TotalFiles, VerifiedFiles = %d, %d, want 2, 2", report.TotalFiles, report.VerifiedFiles)
+	}
+
+	// The state protects the line appended after the manifest was generated
+	write("boot\nrequest X\n", os.O_TRUNC)
+	report, err = m.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	changes := report.ChangesOf(ChangeAppend)
+	if len(changes) != 1 || changes[0].Reason != string(hash.AppendRewritten) {
+		t.Fatalf("Changes = %v, want the rewritten log", report.Changes)
+	}
+
+	// The violation keeps being reported
+	if _, err := m.Verify(context.Background(), tempDir, 0); !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Errorf("second Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+
+	// Without state the log is checked against the manifest only
+	m.SetVerifyOptions(VerifyOptions{})
+	if _, err := m.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Errorf("Verify() without state error = %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+)
+
+// ChangeRule assigns a change policy to the entries matching a path glob.
+// The first rule whose Path matches an entry applies to it.
+type ChangeRule struct {
+	// Path is a glob matched against the entry path, e.g. "uploads/**"
+	Path string `json:"path"`
+
+	// Allow lists the changes tolerated under Path: change kinds such as
+	// "added" or "metadata_changed", or the metadata reasons "mode" and
+	// "owner". Allowed changes are reported as warnings.
+	Allow []string `json:"allow,omitempty"`
+
+	// Forbid lists globs of entries that may never be added or changed under
+	// Path, even when the change is allowed. Globs without '/' match the base
+	// name, e.g. "*.php" or ".htaccess".
+	Forbid []string `json:"forbid,omitempty"`
+}
+
+// metadataReasons can be allowed individually instead of every metadata change
+var metadataReasons = []string{"mode", "owner"}
+
+// LoadChangeRules loads change rules from a JSON file holding an array of rules
+func LoadChangeRules(filename string) ([]ChangeRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change rules: %w", err)
+	}
+
+	var rules []ChangeRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse change rules: %w", err)
+	}
+	if err := ValidateChangeRules(rules); err != nil {
+		return nil, fmt.Errorf("invalid change rules %s: %w", filename, err)
+	}
+
+	return rules, nil
+}
+
+// ValidateChangeRules checks the globs and allowed changes of every rule
+func ValidateChangeRules(rules []ChangeRule) error {
+	kinds := []ChangeKind{ChangeModified, ChangeAdded, ChangeDeleted, ChangeTypeChanged, ChangeMetadata, ChangeXattr, ChangeLink, ChangeAppend}
+
+	for i, rule := range rules {
+		if rule.Path == "" {
+			return fmt.Errorf("rule %d: path is required", i+1)
+		}
+		for _, pattern := range append([]string{rule.Path}, rule.Forbid...) {
+			if err := glob.Validate(pattern); err != nil {
+				return fmt.Errorf("rule %d: %w", i+1, err)
+			}
+		}
+		for _, allow := range rule.Allow {
+			if !slices.Contains(kinds, ChangeKind(allow)) && !slices.Contains(metadataReasons, allow) {
+				return fmt.Errorf("rule %d: unknown change %q in allow", i+1, allow)
+			}
+		}
+	}
+	return nil
+}
+
+// allows reports whether the rule tolerates the change
+func (r ChangeRule) allows(c Change) bool {
+	for _, allow := range r.Allow {
+		if allow == string(c.Kind) || (c.Kind == ChangeMetadata && allow == c.Reason) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbiddenBy returns the Forbid glob matching the entry, or an empty string
+func (r ChangeRule) forbiddenBy(p string) string {
+	for _, pattern := range r.Forbid {
+		name := p
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(p)
+		}
+		if glob.Match(pattern, name) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchChangeRule returns the first rule applying to p
+func matchChangeRule(rules []ChangeRule, p string) (ChangeRule, bool) {
+	for _, rule := range rules {
+		if glob.Match(rule.Path, p) {
+			return rule, true
+		}
+	}
+	return ChangeRule{}, false
+}
+
+// applyChangeRules moves changes allowed by their rule to the warnings and
+// records which rule fired for every change under a rule. A change to an
+// entry matching a Forbid glob always stays a failure; deleting such an
+// entry is judged by Allow alone.
+func (r *VerificationReport) applyChangeRules(rules []ChangeRule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	var changes []Change
+	for _, c := range r.Changes {
+		rule, ok := matchChangeRule(rules, c.Path)
+		if !ok {
+			changes = append(changes, c)
+			continue
+		}
+		c.Rule = rule.Path
+
+		if c.Kind != ChangeDeleted {
+			if forbidden := rule.forbiddenBy(c.Path); forbidden != "" {
+				c.ForbiddenBy = forbidden
+				changes = append(changes, c)
+				continue
+			}
+		}
+		if rule.allows(c) {
+			r.Warnings = append(r.Warnings, c)
+			continue
+		}
+		changes = append(changes, c)
+	}
+	r.Changes = changes
+	r.sortChanges()
+}
@@ -0,0 +1,130 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyChangeRules(t *testing.T) {
+	rules := []ChangeRule{
+		{Path: "uploads/**", Allow: []string{"added", "deleted"}, Forbid: []string{"*.php", "*.phtml", ".htaccess"}},
+		{Path: "config/*", Allow: []string{"mode"}},
+	}
+
+	report := &VerificationReport{Changes: []Change{
+		{Path: "uploads/photo.jpg", Kind: ChangeAdded},
+		{Path: "uploads/2024/shell.php", Kind: ChangeAdded},
+		{Path: "uploads/.htaccess", Kind: ChangeModified, Reason: "hash"},
+		{Path: "uploads/old.php", Kind: ChangeDeleted},
+		{Path: "config/app.ini", Kind: ChangeMetadata, Reason: "mode"},
+		{Path: "config/db.ini", Kind: ChangeModified, Reason: "hash"},
+		{Path: "config/app.ini", Kind: ChangeMetadata, Reason: "owner"},
+		{Path: "index.php", Kind: ChangeModified, Reason: "hash"},
+	}}
+	report.applyChangeRules(rules)
+
+	wantChanges := map[string]Change{
+		"uploads/2024/shell.php": {Rule: "uploads/**", ForbiddenBy: "*.php"},
+		"uploads/.htaccess":      {Rule: "uploads/**", ForbiddenBy: ".htaccess"},
+		"config/db.ini":          {Rule: "config/*"},
+		"config/app.ini":         {Rule: "config/*"},
+		"index.php":              {},
+	}
+	if len(report.Changes) != len(wantChanges) {
+		t.Fatalf("Changes = %v, want %d entries", report.Changes, len(wantChanges))
+	}
+	for _, c := range report.Changes {
+		want, ok := wantChanges[c.Path]
+		if !ok {
+			t.Errorf("unexpected failure %v", c)
+			continue
+		}
+		if c.Rule != want.Rule || c.ForbiddenBy != want.ForbiddenBy {
+			t.Errorf("%s: Rule = %q, ForbiddenBy = %q, want %q, %q", c.Path, c.Rule, c.ForbiddenBy, want.Rule, want.ForbiddenBy)
+		}
+	}
+	for _, c := range report.Changes {
+		if c.Path == "config/app.ini" && c.Reason != "owner" {
+			t.Errorf("config/app.ini: only the owner change should fail, got %v", c)
+		}
+	}
+
+	wantWarnings := map[string]bool{"uploads/photo.jpg": true, "uploads/old.php": true, "config/app.ini": true}
+	if len(report.Warnings) != len(wantWarnings) {
+		t.Fatalf("Warnings = %v, want %d entries", report.Warnings, len(wantWarnings))
+	}
+	for _, c := range report.Warnings {
+		if !wantWarnings[c.Path] || c.Rule == "" {
+			t.Errorf("unexpected warning %v", c)
+		}
+	}
+}
+
+func TestValidateChangeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []ChangeRule
+		wantErr bool
+	}{
+		{"valid", []ChangeRule{{Path: "uploads/**", Allow: []string{"added", "owner"}, Forbid: []string{"*.php"}}}, false},
+		{"missing path", []ChangeRule{{Allow: []string{"added"}}}, true},
+		{"malformed path", []ChangeRule{{Path: "uploads/["}}, true},
+		{"malformed forbid", []ChangeRule{{Path: "uploads/**", Forbid: []string{"{a"}}}, true},
+		{"unknown change", []ChangeRule{{Path: "uploads/**", Allow: []string{"created"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChangeRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateChangeRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyChangeRules(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"uploads", "config"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "config/app.ini"), []byte("debug=0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	generator.SetChangeRules([]ChangeRule{
+		{Path: "uploads/**", Allow: []string{"added"}, Forbid: []string{"*.php"}},
+	})
+	m, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "uploads/photo.jpg"), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Verify(context.Background(), tempDir, 0)
+	if err != nil {
+		t.Fatalf("Verify() should allow uploads, got: %v", err)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Path != "uploads/photo.jpg" {
+		t.Errorf("Warnings = %v, want the added upload", report.Warnings)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "uploads/shell.php"), []byte("<?php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = m.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].ForbiddenBy != "*.php" {
+		t.Errorf("Changes = %v, want the forbidden upload", report.Changes)
+	}
+}
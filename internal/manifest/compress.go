@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression applied to an encoded manifest
+type Compression string
+
+const (
+	// CompressionNone stores the manifest as is
+	CompressionNone Compression = "none"
+	// CompressionGzip compresses the manifest with gzip
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd compresses the manifest with Zstandard
+	CompressionZstd Compression = "zstd"
+)
+
+// Magic bytes at the start of compressed manifests
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Encoding is how a manifest is written: its format and compression.
+// The zero value is uncompressed JSON.
+type Encoding struct {
+	Format      Format
+	Compression Compression
+}
+
+// ParseCompression validates a compression name
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(s)); c {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return c, nil
+	default:
+		return "", fmt.Errorf("invalid compression %q (want none, gzip or zstd)", s)
+	}
+}
+
+// ContentEncoding returns the HTTP Content-Encoding of the compression, or
+// "" for an uncompressed manifest
+func (c Compression) ContentEncoding() string {
+	switch c {
+	case CompressionGzip, CompressionZstd:
+		return string(c)
+	default:
+		return ""
+	}
+}
+
+// compressWriter returns a writer compressing into w. Close flushes the
+// compressed stream but does not close w.
+func compressWriter(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// detectCompression reports the compression of the data at the start of r without consuming it
+func detectCompression(r *bufio.Reader) Compression {
+	magic, _ := r.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(magic, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// decompressReader returns a reader of the decompressed manifest, detected
+// by its magic bytes
+func decompressReader(r *bufio.Reader) (io.ReadCloser, error) {
+	switch detectCompression(r) {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// decompressFile returns file itself when it is not compressed, or else a
+// temporary file with its decompressed contents, so that the entries can be
+// read from offsets. The temporary file is removed once closed.
+func decompressFile(file *os.File) (*os.File, error) {
+	br := bufio.NewReader(file)
+	if detectCompression(br) == CompressionNone {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+
+	r, err := decompressReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifest: %w", err)
+	}
+	defer r.Close()
+
+	tmp, err := privateCopy(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifest: %w", err)
+	}
+	return tmp, nil
+}
+
+// privateCopy copies r to a temporary file that is removed right away and
+// returns it rewound. Only the returned descriptor can reach the copy.
+func privateCopy(r io.Reader) (*os.File, error) {
+	tmp, err := os.CreateTemp("", "kekkai-manifest-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary manifest file: %w", err)
+	}
+	// The open descriptor keeps the file readable
+	os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return tmp, nil
+}
@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressedManifests(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b.txt", "a.txt", "z.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+	m, err := NewGenerator(2).Generate(context.Background(), dir, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := encodeJSON(t, m)
+
+	magic := map[Compression][]byte{CompressionGzip: gzipMagic, CompressionZstd: zstdMagic}
+
+	for _, format := range []Format{FormatJSON, FormatNDJSON} {
+		for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+			enc := Encoding{Format: format, Compression: compression}
+			t.Run(fmt.Sprintf("%s+%s", format, compression), func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := SaveToWriterEncoded(m, &buf, enc); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.HasPrefix(buf.Bytes(), magic[compression]) {
+					t.Errorf("SaveToWriterEncoded() output starts with %x, want %x", buf.Bytes()[:4], magic[compression])
+				}
+
+				loaded, err := LoadFromReader(&buf)
+				if err != nil {
+					t.Fatalf("LoadFromReader() error = %v", err)
+				}
+				if got := encodeJSON(t, loaded); got != want {
+					t.Errorf("LoadFromReader() = %s\nwant %s", got, want)
+				}
+
+				manifestPath := filepath.Join(t.TempDir(), "manifest")
+				if err := SaveToFileEncoded(m, manifestPath, enc); err != nil {
+					t.Fatal(err)
+				}
+				loaded, err = LoadFromFile(manifestPath)
+				if err != nil {
+					t.Fatalf("LoadFromFile() error = %v", err)
+				}
+				if got := encodeJSON(t, loaded); got != want {
+					t.Errorf("LoadFromFile() = %s\nwant %s", got, want)
+				}
+
+				f, err := OpenManifestFile(manifestPath)
+				if err != nil {
+					t.Fatalf("OpenManifestFile() error = %v", err)
+				}
+				defer f.Close()
+				if f.Format() != format {
+					t.Errorf("Format() = %q, want %q", f.Format(), format)
+				}
+				if _, err := f.Verify(context.Background(), dir, 2); err != nil {
+					t.Errorf("stream Verify() error = %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestCompressedManifestCorrupt(t *testing.T) {
+	// The gzip magic followed by garbage
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json.gz")
+	if err := os.WriteFile(manifestPath, []byte{0x1f, 0x8b, 0x00, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFromFile(manifestPath); err == nil {
+		t.Error("LoadFromFile() of a corrupt gzip manifest should fail")
+	}
+	if _, err := OpenManifestFile(manifestPath); err == nil {
+		t.Error("OpenManifestFile() of a corrupt gzip manifest should fail")
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for in, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "GZIP": CompressionGzip, "zstd": CompressionZstd} {
+		if got, err := ParseCompression(in); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCompression("bzip2"); err == nil {
+		t.Error("ParseCompression(\"bzip2\") should fail")
+	}
+}
@@ -0,0 +1,183 @@
+package manifest
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// DiffReport lists the differences between two manifests
+type DiffReport struct {
+	OldFiles       int             `json:"old_files"`
+	NewFiles       int             `json:"new_files"`
+	OldGeneratedAt string          `json:"old_generated_at"`
+	NewGeneratedAt string          `json:"new_generated_at"`
+	Changes        []Change        `json:"changes,omitempty"`
+	PatternChanges []PatternChange `json:"pattern_changes,omitempty"`
+}
+
+// PatternChange lists the include or exclude patterns added and removed in one manifest field
+type PatternChange struct {
+	Field   string   `json:"field"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Identical reports whether the manifests record the same entries and patterns
+func (d *DiffReport) Identical() bool {
+	return len(d.Changes) == 0 && len(d.PatternChanges) == 0
+}
+
+// Diff compares two manifests with the same rules verify uses to compare a
+// manifest with the disk. Changes describe oldManifest as the expected state
+// and newManifest as the current one. When the manifests were hashed with
+// different algorithms, content digests are not compared.
+func Diff(oldManifest, newManifest *Manifest) *DiffReport {
+	report := oldManifest.compareWith(newManifest.Files, newManifest.Directories, diffOptions(oldManifest, newManifest))
+
+	return &DiffReport{
+		OldFiles:       len(oldManifest.Files),
+		NewFiles:       len(newManifest.Files),
+		OldGeneratedAt: oldManifest.GeneratedAt,
+		NewGeneratedAt: newManifest.GeneratedAt,
+		Changes:        report.Changes,
+		PatternChanges: diffHeaders(oldManifest, newManifest),
+	}
+}
+
+// DiffFiles compares two manifest files like Diff, reading the entries of
+// both one at a time. The entries must be sorted by path, as generate writes them.
+func DiffFiles(oldFile, newFile *ManifestFile) (*DiffReport, error) {
+	oldManifest, newManifest := oldFile.Header(), newFile.Header()
+
+	join, err := oldFile.newMergeJoin(diffOptions(oldManifest, newManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	newFiles := 0
+	for _, entries := range []iter.Seq2[hash.FileInfo, error]{newFile.Directories(), newFile.Files()} {
+		last := ""
+		for entry, err := range entries {
+			if err != nil {
+				return nil, err
+			}
+			if last != "" && entry.Path <= last {
+				return nil, fmt.Errorf("manifest entries are not sorted by path (%q after %q); regenerate the manifest", entry.Path, last)
+			}
+			last = entry.Path
+			if !entry.IsDir {
+				newFiles++
+			}
+			if err := join.add(entry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report, err := join.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DiffReport{
+		OldFiles:       report.TotalFiles,
+		NewFiles:       newFiles,
+		OldGeneratedAt: oldManifest.GeneratedAt,
+		NewGeneratedAt: newManifest.GeneratedAt,
+		Changes:        report.Changes,
+		PatternChanges: diffHeaders(oldManifest, newManifest),
+	}, nil
+}
+
+// diffOptions returns the options comparing the entries of two manifests
+func diffOptions(oldManifest, newManifest *Manifest) VerifyOptions {
+	var opts VerifyOptions
+	// Digests are only comparable when both sides recorded the same namespaces
+	opts.compareXattrs = len(oldManifest.XattrNamespaces) > 0 &&
+		slices.Equal(oldManifest.XattrNamespaces, newManifest.XattrNamespaces)
+	opts.ignoreHashes = oldManifest.HashAlgorithm.OrDefault() != newManifest.HashAlgorithm.OrDefault()
+	return opts
+}
+
+// withoutHash drops the content and extended attribute digests of an entry,
+// keeping the target of a symlink, whose digest only covers the target
+func withoutHash(f hash.FileInfo) hash.FileInfo {
+	f.Hash = ""
+	f.XattrDigest = ""
+	if f.IsSymlink {
+		f.Hash = f.LinkTarget
+	}
+	return f
+}
+
+// diffHeaders returns the pattern changes between two manifests
+func diffHeaders(oldManifest, newManifest *Manifest) []PatternChange {
+	var changes []PatternChange
+	for _, field := range []struct {
+		name     string
+		old, new []string
+		ordered  bool
+	}{
+		{"includes", oldManifest.Includes, newManifest.Includes, false},
+		{"excludes", oldManifest.Excludes, newManifest.Excludes, false},
+		{"exclude_rules", ruleStrings(oldManifest.ExcludeRules), ruleStrings(newManifest.ExcludeRules), true},
+		{"levels", levelStrings(oldManifest.Levels), levelStrings(newManifest.Levels), true},
+		{"hash_algorithm", []string{string(oldManifest.HashAlgorithm.OrDefault())}, []string{string(newManifest.HashAlgorithm.OrDefault())}, true},
+	} {
+		if change, ok := diffPatterns(field.name, field.old, field.new, field.ordered); ok {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// diffPatterns returns the patterns only present on one side. When order
+// matters (the last matching exclude rule wins), the same rules in a different
+// order are reported as the old rules removed and the new rules added.
+func diffPatterns(field string, oldPatterns, newPatterns []string, ordered bool) (PatternChange, bool) {
+	if slices.Equal(oldPatterns, newPatterns) {
+		return PatternChange{}, false
+	}
+
+	change := PatternChange{Field: field}
+	for _, p := range oldPatterns {
+		if !slices.Contains(newPatterns, p) {
+			change.Removed = append(change.Removed, p)
+		}
+	}
+	for _, p := range newPatterns {
+		if !slices.Contains(oldPatterns, p) {
+			change.Added = append(change.Added, p)
+		}
+	}
+
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		if !ordered {
+			return PatternChange{}, false
+		}
+		change.Removed = oldPatterns
+		change.Added = newPatterns
+	}
+	return change, true
+}
+
+// ruleStrings returns the rules in gitignore notation
+func ruleStrings(rules []hash.Rule) []string {
+	var s []string
+	for _, r := range rules {
+		s = append(s, r.String())
+	}
+	return s
+}
+
+// levelStrings returns the level rules as "GLOB=LEVEL"
+func levelStrings(rules []LevelRule) []string {
+	var s []string
+	for _, r := range rules {
+		s = append(s, r.String())
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+func TestDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	for path, content := range map[string]string{
+		"index.php":  "<?php echo 'v1';",
+		"config.php": "<?php return [];",
+		"old.php":    "<?php // removed in v2",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generator := NewGenerator(0)
+	oldManifest, err := generator.Generate(context.Background(), tempDir, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := Diff(oldManifest, oldManifest); !diff.Identical() {
+		t.Errorf("Diff() of a manifest with itself = %+v, want identical", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'v2';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "old.php")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "new.php"), []byte("<?php // added in v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator.SetExcludeRules([]hash.Rule{{Pattern: "**/cache", DirOnly: true}})
+	newManifest, err := generator.Generate(context.Background(), tempDir, []string{"*.log", "*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := Diff(oldManifest, newManifest)
+	if diff.Identical() {
+		t.Fatal("Diff() should report differences")
+	}
+	if diff.OldFiles != 3 || diff.NewFiles != 3 {
+		t.Errorf("OldFiles, NewFiles = %d, %d, want 3, 3", diff.OldFiles, diff.NewFiles)
+	}
+
+	var got []string
+	for _, c := range diff.Changes {
+		got = append(got, c.String())
+	}
+	want := []string{"modified: index.php (hash)", "added: new.php (file)", "deleted: old.php (file)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes = %v, want %v", got, want)
+	}
+
+	wantPatterns := []PatternChange{
+		{Field: "excludes", Added: []string{"*.tmp"}},
+		{Field: "exclude_rules", Added: []string{"**/cache/"}},
+	}
+	if !reflect.DeepEqual(diff.PatternChanges, wantPatterns) {
+		t.Errorf("PatternChanges = %+v, want %+v", diff.PatternChanges, wantPatterns)
+	}
+}
+
+func TestDiffPatterns(t *testing.T) {
+	// Exclude patterns are order independent
+	if change, ok := diffPatterns("excludes", []string{"a", "b"}, []string{"b", "a"}, false); ok {
+		t.Errorf("diffPatterns() of reordered excludes = %+v, want no change", change)
+	}
+
+	// The last matching exclude rule wins, so order matters
+	change, ok := diffPatterns("exclude_rules", []string{"a", "!b"}, []string{"!b", "a"}, true)
+	if !ok {
+		t.Fatal("diffPatterns() of reordered rules should report a change")
+	}
+	want := PatternChange{Field: "exclude_rules", Added: []string{"!b", "a"}, Removed: []string{"a", "!b"}}
+	if !reflect.DeepEqual(change, want) {
+		t.Errorf("diffPatterns() = %+v, want %+v", change, want)
+	}
+}
@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// Format is the encoding of a manifest file
+type Format string
+
+const (
+	// FormatJSON is a single indented JSON document
+	FormatJSON Format = "json"
+	// FormatNDJSON is a header line followed by one JSON entry per line, so
+	// the entries can be written and read one at a time
+	FormatNDJSON Format = "ndjson"
+)
+
+// ndjsonFormat identifies the header line of an NDJSON manifest
+const ndjsonFormat = "kekkai-manifest-ndjson"
+
+// ndjsonVersion is the version of the NDJSON layout written by this version
+const ndjsonVersion = 1
+
+// ndjsonHeader is the first line of an NDJSON manifest. The manifest carries
+// every field except the entries, which follow as directories, then files.
+type ndjsonHeader struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"format_version"`
+	Manifest      *Manifest `json:"manifest"`
+}
+
+// ParseFormat validates a manifest format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatJSON, FormatNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid manifest format %q (want json or ndjson)", s)
+	}
+}
+
+// SaveToFileEncoded saves the manifest to a file in the given format and compression
+func SaveToFileEncoded(manifest *Manifest, filename string, enc Encoding) error {
+	if enc == (Encoding{}) || enc == (Encoding{Format: FormatJSON, Compression: CompressionNone}) {
+		return SaveToFile(manifest, filename)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	if err := SaveToWriterEncoded(manifest, file, enc); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
+
+// SaveToWriterEncoded saves the manifest to an io.Writer in the given format and compression
+func SaveToWriterEncoded(manifest *Manifest, w io.Writer, enc Encoding) error {
+	cw, err := compressWriter(w, enc.Compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress manifest: %w", err)
+	}
+
+	if enc.Format == FormatNDJSON {
+		err = writeNDJSON(cw, manifest)
+	} else {
+		err = SaveToWriter(manifest, cw)
+	}
+	if err != nil {
+		cw.Close()
+		return err
+	}
+
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("failed to compress manifest: %w", err)
+	}
+	return nil
+}
+
+// writeNDJSON writes the header line, then every directory and file entry on a line of its own
+func writeNDJSON(w io.Writer, m *Manifest) error {
+	bw := bufio.NewWriter(w)
+
+	header := *m
+	header.Files = nil
+	header.Directories = nil
+	data, err := json.Marshal(ndjsonHeader{Format: ndjsonFormat, FormatVersion: ndjsonVersion, Manifest: &header})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest header: %w", err)
+	}
+	bw.Write(data)
+	bw.WriteByte('\n')
+
+	for _, entries := range [][]hash.FileInfo{m.Directories, m.Files} {
+		for _, f := range entries {
+			if err := writeEntry(bw, f); err != nil {
+				return err
+			}
+			bw.WriteByte('\n')
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return nil
+}
+
+// detectFormat reports the format of the manifest at the start of r without consuming it
+func detectFormat(r *bufio.Reader) Format {
+	prefix := []byte(`{"format":"` + ndjsonFormat + `"`)
+	head, _ := r.Peek(512)
+	if bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), prefix) {
+		return FormatNDJSON
+	}
+	return FormatJSON
+}
+
+// decodeNDJSONHeader decodes the header line and checks its version
+func decodeNDJSONHeader(dec *json.Decoder) (*Manifest, error) {
+	var header ndjsonHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.FormatVersion > ndjsonVersion {
+		return nil, fmt.Errorf("unsupported manifest format version %d (this version reads up to %d)", header.FormatVersion, ndjsonVersion)
+	}
+	if header.Manifest == nil {
+		return nil, fmt.Errorf("manifest header has no manifest")
+	}
+	return header.Manifest, nil
+}
+
+// loadNDJSON decodes an NDJSON manifest
+func loadNDJSON(r io.Reader) (*Manifest, error) {
+	dec := json.NewDecoder(r)
+	m, err := decodeNDJSONHeader(dec)
+	if err != nil {
+		return nil, err
+	}
+	m.Files = []hash.FileInfo{}
+	m.Directories = nil
+
+	for {
+		var f hash.FileInfo
+		if err := dec.Decode(&f); errors.Is(err, io.EOF) {
+			return m, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if f.IsDir {
+			m.Directories = append(m.Directories, f)
+		} else {
+			m.Files = append(m.Files, f)
+		}
+	}
+}
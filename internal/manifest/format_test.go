@@ -0,0 +1,177 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b.txt", "a.txt", "z.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	generator := NewGenerator(2)
+	m, err := generator.Generate(context.Background(), dir, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := SaveToWriterEncoded(m, &buf, Encoding{Format: FormatNDJSON}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if want := 1 + len(m.Directories) + len(m.Files); len(lines) != want {
+		t.Fatalf("NDJSON manifest has %d lines, want %d:\n%s", len(lines), want, buf.String())
+	}
+	if !strings.HasPrefix(lines[0], `{"format":"kekkai-manifest-ndjson","format_version":1,`) {
+		t.Errorf("header line = %s", lines[0])
+	}
+
+	loaded, err := LoadFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadFromReader() error = %v", err)
+	}
+	if got, want := encodeJSON(t, loaded), encodeJSON(t, m); got != want {
+		t.Errorf("LoadFromReader() = %s\nwant %s", got, want)
+	}
+	if err := loaded.VerifySignature(pub); err != nil {
+		t.Errorf("VerifySignature() of a loaded NDJSON manifest error = %v", err)
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.ndjson")
+	if err := SaveToFileEncoded(m, manifestPath, Encoding{Format: FormatNDJSON}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadFromFile(manifestPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	if got, want := encodeJSON(t, loaded), encodeJSON(t, m); got != want {
+		t.Errorf("LoadFromFile() = %s\nwant %s", got, want)
+	}
+
+	f, err := OpenManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Format() != FormatNDJSON {
+		t.Errorf("Format() = %q, want %q", f.Format(), FormatNDJSON)
+	}
+	if err := f.VerifySignature(pub); err != nil {
+		t.Errorf("stream VerifySignature() error = %v", err)
+	}
+	var paths []string
+	for entry, err := range f.Files() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, entry.Path)
+	}
+	if want := []string{"a.txt", "a/b.txt", "z.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Files() paths = %v, want %v", paths, want)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "a/b.txt"), "tampered")
+	report, err := f.Verify(context.Background(), dir, 2)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("stream Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Path != "a/b.txt" {
+		t.Errorf("stream Verify() changes = %+v, want a/b.txt", report.Changes)
+	}
+}
+
+func TestNDJSONUnsupportedVersion(t *testing.T) {
+	data := `{"format":"kekkai-manifest-ndjson","format_version":2,"manifest":{"version":"1.0"}}` + "\n"
+	_, err := LoadFromReader(strings.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "unsupported manifest format version 2") {
+		t.Errorf("LoadFromReader() error = %v, want an unsupported version error", err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"json": FormatJSON, "NDJSON": FormatNDJSON} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Error("ParseFormat(\"yaml\") should fail")
+	}
+}
+
+func TestDiffFilesMatchesDiff(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b.txt", "a.txt", "old.txt"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+	workDir := t.TempDir()
+
+	oldManifest, err := NewGenerator(2).Generate(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := filepath.Join(workDir, "old.json")
+	if err := SaveToFile(oldManifest, oldPath); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "a/b.txt"), "tampered")
+	writeTestFile(t, filepath.Join(dir, "a/new.txt"), "new")
+	if err := os.Remove(filepath.Join(dir, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	newManifest, err := NewGenerator(2).Generate(context.Background(), dir, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPath := filepath.Join(workDir, "new.ndjson")
+	if err := SaveToFileEncoded(newManifest, newPath, Encoding{Format: FormatNDJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	oldFile, err := OpenManifestFile(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldFile.Close()
+	newFile, err := OpenManifestFile(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newFile.Close()
+
+	got, err := DiffFiles(oldFile, newFile)
+	if err != nil {
+		t.Fatalf("DiffFiles() error = %v", err)
+	}
+	if want := Diff(oldManifest, newManifest); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffFiles() = %+v\nwant %+v", got, want)
+	}
+}
+
+// encodeJSON returns the JSON manifest, which compares times by their encoding
+func encodeJSON(t *testing.T, m *Manifest) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := SaveToWriter(m, &buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
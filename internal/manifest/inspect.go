@@ -0,0 +1,177 @@
+package manifest
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// Summary describes a manifest without listing its entries
+type Summary struct {
+	Version         string   `json:"version"`
+	GeneratedAt     string   `json:"generated_at"`
+	HashAlgorithm   string   `json:"hash_algorithm"`
+	FileCount       int      `json:"file_count"`
+	DirectoryCount  int      `json:"directory_count"`
+	TotalSize       int64    `json:"total_size"`
+	SignedBy        string   `json:"signed_by,omitempty"` // Key ID of the signature
+	XattrNamespaces []string `json:"xattr_namespaces,omitempty"`
+	Roots           []Root   `json:"roots,omitempty"`
+}
+
+// Patterns lists the include and exclude patterns recorded in a manifest
+type Patterns struct {
+	Includes     []string `json:"includes"`
+	Excludes     []string `json:"excludes"`
+	ExcludeRules []string `json:"exclude_rules"` // In gitignore notation
+}
+
+// PathLookup is the result of looking up a single path in a manifest.
+// When the path is not recorded, Reason explains why.
+type PathLookup struct {
+	Path       string         `json:"path"`
+	Found      bool           `json:"found"`
+	Entry      *hash.FileInfo `json:"entry,omitempty"`
+	ExcludedBy string         `json:"excluded_by,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+}
+
+// DirectoryTotal sums the files recorded below a top-level directory.
+// Files directly in the target directory are counted under ".".
+type DirectoryTotal struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Summary returns the metadata of the manifest
+func (m *Manifest) Summary() Summary {
+	s := Summary{
+		Version:         m.Version,
+		GeneratedAt:     m.GeneratedAt,
+		HashAlgorithm:   string(m.HashAlgorithm.OrDefault()),
+		FileCount:       len(m.Files),
+		DirectoryCount:  len(m.Directories),
+		XattrNamespaces: m.XattrNamespaces,
+		Roots:           m.Roots,
+	}
+	for _, f := range m.Files {
+		s.TotalSize += f.Size
+	}
+	if m.Signature != nil {
+		s.SignedBy = m.Signature.KeyID
+	}
+	return s
+}
+
+// Patterns returns the include and exclude patterns applied by verify
+func (m *Manifest) Patterns() Patterns {
+	return Patterns{
+		Includes:     m.Includes,
+		Excludes:     m.Excludes,
+		ExcludeRules: ruleStrings(m.ExcludeRules),
+	}
+}
+
+// Lookup finds a file or directory by its path relative to the target directory
+func (m *Manifest) Lookup(p string) PathLookup {
+	p = cleanRelPath(p)
+	lookup := PathLookup{Path: p}
+
+	for _, entries := range [][]hash.FileInfo{m.Files, m.Directories} {
+		for i := range entries {
+			if entries[i].Path == p {
+				lookup.Found = true
+				lookup.Entry = &entries[i]
+				return lookup
+			}
+		}
+	}
+
+	// The manifest does not say whether a missing path is a directory
+	filter := m.filter()
+	excludedBy := filter.ExcludedBy(p, false)
+	if excludedBy == "" {
+		excludedBy = filter.ExcludedBy(p, true)
+	}
+	switch {
+	case excludedBy != "":
+		lookup.ExcludedBy = excludedBy
+		lookup.Reason = fmt.Sprintf("excluded by %q", excludedBy)
+	case !filter.Included(p):
+		lookup.Reason = "not matched by any include pattern"
+	default:
+		lookup.Reason = "not present when the manifest was generated"
+	}
+	return lookup
+}
+
+// Entries returns the files and directories at or below prefix in path order.
+// An empty prefix or "." returns every entry.
+func (m *Manifest) Entries(prefix string) []hash.FileInfo {
+	prefix = cleanRelPath(prefix)
+
+	var entries []hash.FileInfo
+	for _, list := range [][]hash.FileInfo{m.Directories, m.Files} {
+		for _, e := range list {
+			if prefix == "." || e.Path == prefix || strings.HasPrefix(e.Path, prefix+"/") {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// TopLevelTotals returns the number and size of files per top-level directory
+func (m *Manifest) TopLevelTotals() []DirectoryTotal {
+	totals := make(map[string]*DirectoryTotal)
+	for _, f := range m.Files {
+		name, _, found := strings.Cut(f.Path, "/")
+		if !found {
+			name = "."
+		}
+		t, ok := totals[name]
+		if !ok {
+			t = &DirectoryTotal{Name: name}
+			totals[name] = t
+		}
+		t.Files++
+		t.Size += f.Size
+	}
+
+	result := make([]DirectoryTotal, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// cleanRelPath normalizes a user-supplied path to the form stored in
+// manifests, e.g. "./app//main.go" and "/app/main.go" become "app/main.go"
+func cleanRelPath(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+// Explain reports why a path is or is not recorded, using the patterns of the
+// manifest. A path recorded as a directory is always treated as one.
+func (m *Manifest) Explain(p string, isDir bool) hash.Explanation {
+	p = cleanRelPath(p)
+	if !isDir {
+		isDir = slices.ContainsFunc(m.Directories, func(d hash.FileInfo) bool { return d.Path == p })
+	}
+	return m.filter().Explain(p, isDir)
+}
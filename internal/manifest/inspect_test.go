@@ -0,0 +1,83 @@
+package manifest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+func TestInspect(t *testing.T) {
+	m := &Manifest{
+		Version:      "1.0",
+		Includes:     []string{"app/**", "config/**", "index.php"},
+		Excludes:     []string{"app/cache/**"},
+		ExcludeRules: []hash.Rule{{Pattern: "**/*.log"}, {Pattern: "**/tmp", DirOnly: true}},
+		Files: []hash.FileInfo{
+			{Path: "app/Kernel.php", Size: 10},
+			{Path: "app/Http/routes.php", Size: 20},
+			{Path: "config/app.php", Size: 5},
+			{Path: "index.php", Size: 1},
+		},
+		Directories: []hash.FileInfo{
+			{Path: ".", IsDir: true},
+			{Path: "app", IsDir: true},
+			{Path: "app/Http", IsDir: true},
+			{Path: "config", IsDir: true},
+		},
+		Signature: &Signature{KeyID: "0123abcd"},
+	}
+
+	s := m.Summary()
+	if s.FileCount != 4 || s.DirectoryCount != 4 || s.TotalSize != 36 || s.SignedBy != "0123abcd" {
+		t.Errorf("Summary() = %+v", s)
+	}
+
+	p := m.Patterns()
+	if !reflect.DeepEqual(p.ExcludeRules, []string{"**/*.log", "**/tmp/"}) {
+		t.Errorf("Patterns().ExcludeRules = %v", p.ExcludeRules)
+	}
+
+	lookups := []struct {
+		path       string
+		wantPath   string
+		found      bool
+		excludedBy string
+		reason     string
+	}{
+		{"app/Kernel.php", "app/Kernel.php", true, "", ""},
+		{"./app//Http", "app/Http", true, "", ""},
+		{"/config/app.php", "config/app.php", true, "", ""},
+		{"app/cache/view.php", "app/cache/view.php", false, "app/cache/**", `excluded by "app/cache/**"`},
+		{"app/storage/debug.log", "app/storage/debug.log", false, "**/*.log", `excluded by "**/*.log"`},
+		{"app/tmp/x", "app/tmp/x", false, "**/tmp/", `excluded by "**/tmp/"`},
+		{"vendor/autoload.php", "vendor/autoload.php", false, "", "not matched by any include pattern"},
+		{"app/new.php", "app/new.php", false, "", "not present when the manifest was generated"},
+	}
+	for _, tt := range lookups {
+		got := m.Lookup(tt.path)
+		if got.Path != tt.wantPath || got.Found != tt.found || got.ExcludedBy != tt.excludedBy || got.Reason != tt.reason {
+			t.Errorf("Lookup(%q) = %+v", tt.path, got)
+		}
+	}
+
+	var paths []string
+	for _, e := range m.Entries("app") {
+		paths = append(paths, e.Path)
+	}
+	if want := []string{"app", "app/Http", "app/Http/routes.php", "app/Kernel.php"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Entries(app) = %v, want %v", paths, want)
+	}
+	if n := len(m.Entries(".")); n != 8 {
+		t.Errorf("len(Entries(.)) = %d, want 8", n)
+	}
+
+	wantTotals := []DirectoryTotal{
+		{Name: ".", Files: 1, Size: 1},
+		{Name: "app", Files: 2, Size: 30},
+		{Name: "config", Files: 1, Size: 5},
+	}
+	if got := m.TopLevelTotals(); !reflect.DeepEqual(got, wantTotals) {
+		t.Errorf("TopLevelTotals() = %+v, want %+v", got, wantTotals)
+	}
+}
@@ -45,7 +45,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Initial verification should pass
-		if err := manifest.Verify(ctx, tempDir, 2); err != nil {
+		if _, err := manifest.Verify(ctx, tempDir, 2); err != nil {
 			t.Errorf("Initial verification failed: %v", err)
 		}
 
@@ -61,7 +61,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Verification should detect type change
-		err = manifest.Verify(ctx, tempDir, 2)
+		_, err = manifest.Verify(ctx, tempDir, 2)
 		if err == nil {
 			t.Error("Should detect symlink replaced with regular file")
 		} else if !strings.Contains(err.Error(), "modified:") && !strings.Contains(err.Error(), "type") {
@@ -77,7 +77,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Verification should detect hash change (different target)
-		err = manifest.Verify(ctx, tempDir, 2)
+		_, err = manifest.Verify(ctx, tempDir, 2)
 		if err == nil {
 			t.Error("Should detect symlink target change")
 		} else if !strings.Contains(err.Error(), "modified") {
@@ -114,7 +114,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 			}
 
 			// Verification should catch the type change
-			err := manifest.Verify(ctx, raceDir, 2)
+			_, err := manifest.Verify(ctx, raceDir, 2)
 			if err == nil {
 				t.Error("Should detect file type change in race condition")
 			}
@@ -128,7 +128,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 			}
 
 			// Should pass with original
-			err = manifest.Verify(ctx, raceDir, 2)
+			_, err = manifest.Verify(ctx, raceDir, 2)
 			if err != nil {
 				t.Errorf("Should pass with original file: %v", err)
 			}
@@ -181,7 +181,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Should detect the change
-		err = manifest.Verify(ctx, chainDir, 2)
+		_, err = manifest.Verify(ctx, chainDir, 2)
 		if err == nil {
 			t.Error("Should detect symlink chain manipulation")
 		}
@@ -227,7 +227,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Should detect the change
-		err = manifest.Verify(ctx, hiddenDir, 2)
+		_, err = manifest.Verify(ctx, hiddenDir, 2)
 		if err == nil {
 			t.Error("Should detect symlink retargeting to hidden file")
 		} else if !strings.Contains(err.Error(), "modified") && !strings.Contains(err.Error(), "added") {
@@ -274,7 +274,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		err = manifest.Verify(ctx, sizeDir, 2)
+		_, err = manifest.Verify(ctx, sizeDir, 2)
 		if err == nil {
 			t.Error("Should detect file size changes")
 		}
@@ -316,7 +316,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Verification should still pass (file is excluded)
-		err = manifest.Verify(ctx, excludeDir, 2)
+		_, err = manifest.Verify(ctx, excludeDir, 2)
 		if err != nil {
 			t.Errorf("Excluded files should not affect verification: %v", err)
 		}
@@ -328,7 +328,7 @@ func TestIntegrationSymlinkAttackScenarios(t *testing.T) {
 		}
 
 		// Should detect the added file
-		err = manifest.Verify(ctx, excludeDir, 2)
+		_, err = manifest.Verify(ctx, excludeDir, 2)
 		if err == nil {
 			t.Error("Should detect added symlink")
 		} else if !strings.Contains(err.Error(), "added") {
@@ -374,7 +374,7 @@ func TestManifestGenerationAndVerificationPerformance(t *testing.T) {
 
 	// Test verification performance
 	start = time.Now()
-	err = manifest.VerifyWithRateLimit(ctx, tempDir, 4, 10*1024*1024)
+	_, err = manifest.VerifyWithRateLimit(ctx, tempDir, 4, 10*1024*1024)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -385,7 +385,7 @@ func TestManifestGenerationAndVerificationPerformance(t *testing.T) {
 	// Test cache-based verification performance
 	cacheDir := t.TempDir()
 	start = time.Now()
-	err = manifest.VerifyWithCache(ctx, tempDir, cacheDir, "test", "app", 4, 0.1, false)
+	_, err = manifest.VerifyWithCache(ctx, tempDir, cacheDir, "test", "app", 4, 0.1, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -395,7 +395,7 @@ func TestManifestGenerationAndVerificationPerformance(t *testing.T) {
 
 	// Second cache verification should be faster
 	start = time.Now()
-	err = manifest.VerifyWithCache(ctx, tempDir, cacheDir, "test", "app", 4, 0.0, false)
+	_, err = manifest.VerifyWithCache(ctx, tempDir, cacheDir, "test", "app", 4, 0.0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -430,7 +430,8 @@ func TestConcurrentVerification(t *testing.T) {
 	done := make(chan error, 5)
 	for range 5 {
 		go func() {
-			done <- manifest.Verify(ctx, tempDir, 2)
+			_, err := manifest.Verify(ctx, tempDir, 2)
+			done <- err
 		}()
 	}
 
@@ -473,7 +474,7 @@ func TestManifestBackwardCompatibility(t *testing.T) {
 	}
 
 	// Test verification still works
-	err = manifest.Verify(ctx, tempDir, 1)
+	_, err = manifest.Verify(ctx, tempDir, 1)
 	if err != nil {
 		t.Errorf("Verification failed: %v", err)
 	}
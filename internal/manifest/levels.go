@@ -0,0 +1,76 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+)
+
+// Level selects how thoroughly verify checks an entry
+type Level string
+
+const (
+	// LevelHash compares content, metadata and existence (the default)
+	LevelHash Level = "hash"
+	// LevelMetadata compares type, mode, owner, extended attributes, hard
+	// links and existence; the content may change
+	LevelMetadata Level = "metadata"
+	// LevelExists only checks that the entry still exists
+	LevelExists Level = "exists"
+)
+
+// LevelRule assigns a monitoring level to the entries matching a path glob.
+// The first rule whose Path matches an entry applies to it.
+type LevelRule struct {
+	Path  string `json:"path"`
+	Level Level  `json:"level"`
+}
+
+// String formats the rule as "GLOB=LEVEL"
+func (r LevelRule) String() string {
+	return r.Path + "=" + string(r.Level)
+}
+
+// ParseLevelRule parses a "GLOB=LEVEL" argument, e.g. ".env=metadata"
+func ParseLevelRule(s string) (LevelRule, error) {
+	i := strings.LastIndex(s, "=")
+	if i < 0 {
+		return LevelRule{}, fmt.Errorf("level %q must be GLOB=LEVEL", s)
+	}
+
+	rule := LevelRule{Path: s[:i], Level: Level(s[i+1:])}
+	if err := rule.Validate(); err != nil {
+		return LevelRule{}, err
+	}
+	return rule, nil
+}
+
+// Validate checks the glob and the level of the rule
+func (r LevelRule) Validate() error {
+	if err := glob.Validate(r.Path); err != nil {
+		return err
+	}
+	switch r.Level {
+	case LevelHash, LevelMetadata, LevelExists:
+		return nil
+	default:
+		return fmt.Errorf("unknown level %q for %s (want hash, metadata or exists)", r.Level, r.Path)
+	}
+}
+
+// levelOf returns the level of the first rule matching p, or LevelHash
+func levelOf(rules []LevelRule, p string) Level {
+	for _, rule := range rules {
+		if glob.Match(rule.Path, p) {
+			return rule.Level
+		}
+	}
+	return LevelHash
+}
+
+// contentChange reports whether a change from compareEntry is about the
+// content, which LevelMetadata ignores
+func contentChange(c Change) bool {
+	return c.Kind == ChangeModified && (c.Reason == "hash" || c.Reason == "size" || c.Reason == "target")
+}
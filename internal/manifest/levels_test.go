@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLevelRule(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    LevelRule
+		wantErr bool
+	}{
+		{".env=metadata", LevelRule{Path: ".env", Level: LevelMetadata}, false},
+		{"storage/*.php=exists", LevelRule{Path: "storage/*.php", Level: LevelExists}, false},
+		{"a=b=hash", LevelRule{Path: "a=b", Level: LevelHash}, false},
+		{".env", LevelRule{}, true},
+		{".env=content", LevelRule{}, true},
+		{"[=hash", LevelRule{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevelRule(tt.arg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevelRule(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevelRule(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyLevels(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"index.php":       "<?php // front",
+		".env":            "APP_KEY=old",
+		"cache/views.php": "<?php // compiled",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generator := NewGenerator(0)
+	generator.SetLevels([]LevelRule{
+		{Path: ".env", Level: LevelMetadata},
+		{Path: "cache/*", Level: LevelExists},
+	})
+	m, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// Content changes are accepted below the hash level
+	if err := os.WriteFile(filepath.Join(tempDir, ".env"), []byte("APP_KEY=rotated-by-config-management"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "cache/views.php"), []byte("<?php // recompiled"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tempDir, "cache/views.php"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Verify(context.Background(), tempDir, 0)
+	if err != nil {
+		t.Fatalf("Verify() error = %v, changes: %v", err, report.Changes)
+	}
+	if report.VerifiedFiles != 3 {
+		t.Errorf("VerifiedFiles = %d, want 3", report.VerifiedFiles)
+	}
+
+	// Metadata is still compared at the metadata level
+	if err := os.Chmod(filepath.Join(tempDir, ".env"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	report, err = m.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if changes := report.ChangesOf(ChangeMetadata); len(changes) != 1 || changes[0].Path != ".env" {
+		t.Errorf("Changes = %v, want the mode change of .env", report.Changes)
+	}
+
+	// Existence is checked at every level
+	if err := os.Remove(filepath.Join(tempDir, "cache/views.php")); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = m.Verify(context.Background(), tempDir, 0)
+	if changes := report.ChangesOf(ChangeDeleted); len(changes) != 1 || changes[0].Path != "cache/views.php" {
+		t.Errorf("Changes = %v, want cache/views.php deleted", report.Changes)
+	}
+}
@@ -1,12 +1,15 @@
 package manifest
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/catatsuy/kekkai/internal/hash"
@@ -14,16 +17,37 @@ import (
 
 // Manifest represents the complete manifest structure
 type Manifest struct {
-	Version     string          `json:"version"`
-	FileCount   int             `json:"file_count"`
-	GeneratedAt string          `json:"generated_at"`
-	Excludes    []string        `json:"excludes,omitempty"`
-	Files       []hash.FileInfo `json:"files"`
+	Version         string             `json:"version"`
+	FileCount       int                `json:"file_count"`
+	GeneratedAt     string             `json:"generated_at"`
+	HashAlgorithm   hash.Algorithm     `json:"hash_algorithm,omitempty"` // Digest of file contents; empty in older manifests, meaning SHA-256
+	Includes        []string           `json:"includes,omitempty"`
+	Excludes        []string           `json:"excludes,omitempty"`
+	ExcludeRules    []hash.Rule        `json:"exclude_rules,omitempty"`    // Resolved gitignore-style rules from -exclude-from
+	XattrNamespaces []string           `json:"xattr_namespaces,omitempty"` // Extended attribute namespaces recorded per entry
+	ChangeRules     []ChangeRule       `json:"change_rules,omitempty"`     // Per-path policies applied by verify
+	AppendOnly      []hash.AppendRule  `json:"append_only,omitempty"`      // Globs of files that may only grow
+	AppendFiles     []hash.AppendEntry `json:"append_files,omitempty"`     // Size and digest of the append-only files
+	Levels          []LevelRule        `json:"levels,omitempty"`           // Per-path monitoring levels; entries default to hash
+	Roots           []Root             `json:"roots,omitempty"`            // Named target directories; entries are recorded under the root name
+	Merkle          *Merkle            `json:"merkle,omitempty"`           // Hash tree of the entries
+	Files           []hash.FileInfo    `json:"files"`
+	Directories     []hash.FileInfo    `json:"directories,omitempty"`
+	Signature       *Signature         `json:"signature,omitempty"`
+
+	verifyOptions VerifyOptions
 }
 
 // Generator handles manifest generation
 type Generator struct {
 	calculator *hash.Calculator
+	includes   []string
+	rules      []hash.Rule
+	xattrs     []string
+	changes    []ChangeRule
+	appendOnly []hash.AppendRule
+	levels     []LevelRule
+	algorithm  hash.Algorithm
 }
 
 // NewGenerator creates a manifest generator with custom worker count
@@ -40,26 +64,126 @@ func NewGeneratorWithRateLimit(numWorkers int, bytesPerSec int64) *Generator {
 	}
 }
 
+// SetIncludes limits the manifest to entries matching the given patterns.
+// Exclude patterns passed to Generate take precedence.
+func (g *Generator) SetIncludes(includes []string) {
+	g.includes = includes
+}
+
+// SetExcludeRules excludes entries with gitignore-style rules. The rules are
+// stored in the manifest so verification never needs the original file.
+func (g *Generator) SetExcludeRules(rules []hash.Rule) {
+	g.rules = rules
+}
+
+// SetChangeRules stores per-path change policies in the manifest
+func (g *Generator) SetChangeRules(rules []ChangeRule) {
+	g.changes = rules
+}
+
+// SetAppendOnly tracks the files matching the rules by size and prefix digest
+// instead of by content, so they may grow but not be truncated or rewritten
+func (g *Generator) SetAppendOnly(rules []hash.AppendRule) {
+	g.appendOnly = rules
+}
+
+// SetLevels stores per-path monitoring levels in the manifest
+func (g *Generator) SetLevels(rules []LevelRule) {
+	g.levels = rules
+}
+
+// SetHashAlgorithm sets the digest of file contents, which is recorded in
+// the manifest so verification uses the same one
+func (g *Generator) SetHashAlgorithm(algorithm hash.Algorithm) {
+	g.algorithm = algorithm
+	g.calculator.SetAlgorithm(algorithm)
+}
+
+// SetXattrNamespaces records a digest of the extended attributes in the given
+// namespaces for every entry; verification then compares them
+func (g *Generator) SetXattrNamespaces(namespaces []string) {
+	g.xattrs = namespaces
+	g.calculator.SetXattrNamespaces(namespaces)
+}
+
 // Generate creates a manifest for the specified directory with context
 func (g *Generator) Generate(ctx context.Context, targetDir string, excludes []string) (*Manifest, error) {
 	// Calculate hashes
-	result, err := g.calculator.CalculateDirectory(ctx, targetDir, excludes)
+	result, err := g.calculator.CalculateDirectoryWithFilter(ctx, targetDir, hash.Filter{Includes: g.includes, Excludes: excludes, Rules: g.rules})
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate directory hash: %w", err)
 	}
 
-	// Create manifest
-	manifest := &Manifest{
-		Version:     "1.0",
-		FileCount:   result.FileCount,
-		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
-		Excludes:    excludes,
-		Files:       result.Files,
+	manifest := g.newManifest(result, excludes)
+
+	if len(g.appendOnly) > 0 {
+		manifest.Files = manifest.withoutAppendOnly(manifest.Files)
+		manifest.FileCount = len(manifest.Files)
+		manifest.AppendFiles, err = hash.CollectAppendEntries(ctx, targetDir, g.appendOnly, g.algorithm.OrDefault())
+		if err != nil {
+			return nil, fmt.Errorf("failed to record append-only files: %w", err)
+		}
 	}
 
+	if manifest.Merkle, err = manifest.ComputeMerkle(); err != nil {
+		return nil, err
+	}
 	return manifest, nil
 }
 
+// GenerateRoots creates a single manifest covering several directories. The
+// entries of each root are recorded under its name, and the include and
+// exclude patterns are matched against these prefixed paths.
+func (g *Generator) GenerateRoots(ctx context.Context, roots []Root, excludes []string) (*Manifest, error) {
+	if err := ValidateRoots(roots); err != nil {
+		return nil, err
+	}
+	if len(g.appendOnly) > 0 {
+		return nil, fmt.Errorf("append-only files are not supported with multiple roots")
+	}
+
+	// Record absolute directories so verify does not depend on the working directory
+	roots = slices.Clone(roots)
+	for i := range roots {
+		abs, err := filepath.Abs(roots[i].Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve root %s: %w", roots[i].Name, err)
+		}
+		roots[i].Path = abs
+	}
+
+	result, err := calculateRoots(ctx, g.calculator, roots, hash.Filter{Includes: g.includes, Excludes: excludes, Rules: g.rules})
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate directory hash: %w", err)
+	}
+
+	manifest := g.newManifest(result, excludes)
+	manifest.Roots = roots
+	if manifest.Merkle, err = manifest.ComputeMerkle(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// newManifest creates a manifest of the calculated entries
+func (g *Generator) newManifest(result *hash.Result, excludes []string) *Manifest {
+	return &Manifest{
+		Version:         "1.0",
+		FileCount:       result.FileCount,
+		GeneratedAt:     time.Now().UTC().Format(time.RFC3339),
+		HashAlgorithm:   g.algorithm.OrDefault(),
+		Includes:        g.includes,
+		Excludes:        excludes,
+		ExcludeRules:    g.rules,
+		XattrNamespaces: g.xattrs,
+		ChangeRules:     g.changes,
+		AppendOnly:      g.appendOnly,
+		Levels:          g.levels,
+		Files:           result.Files,
+		Directories:     result.Directories,
+	}
+}
+
 // SaveToFile saves the manifest to a file
 func SaveToFile(manifest *Manifest, filename string) error {
 	data, err := json.MarshalIndent(manifest, "", "  ")
@@ -87,54 +211,91 @@ func SaveToWriter(manifest *Manifest, w io.Writer) error {
 	return nil
 }
 
-// LoadFromFile loads a manifest from a file
+// LoadFromFile loads a manifest from a file in any format and compression
 func LoadFromFile(filename string) (*Manifest, error) {
-	data, err := os.ReadFile(filename)
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read manifest file: %w", err)
 	}
+	defer file.Close()
 
-	var manifest Manifest
-	err = json.Unmarshal(data, &manifest)
+	manifest, err := loadManifest(file)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
 	}
-
-	return &manifest, nil
+	return manifest, nil
 }
 
-// LoadFromReader loads a manifest from an io.Reader
+// LoadFromReader loads a manifest from an io.Reader, detecting its format and compression
 func LoadFromReader(r io.Reader) (*Manifest, error) {
-	var manifest Manifest
-
-	decoder := json.NewDecoder(r)
-	if err := decoder.Decode(&manifest); err != nil {
+	manifest, err := loadManifest(r)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode manifest: %w", err)
 	}
+	return manifest, nil
+}
+
+// loadManifest decodes a JSON or NDJSON manifest, compressed or not
+func loadManifest(r io.Reader) (*Manifest, error) {
+	br := bufio.NewReader(r)
+	if detectCompression(br) != CompressionNone {
+		dr, err := decompressReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress manifest: %w", err)
+		}
+		defer dr.Close()
+		br = bufio.NewReader(dr)
+	}
 
+	if detectFormat(br) == FormatNDJSON {
+		return loadNDJSON(br)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(br).Decode(&manifest); err != nil {
+		return nil, err
+	}
 	return &manifest, nil
 }
 
-// Verify checks the integrity of files with context
-func (m *Manifest) Verify(ctx context.Context, targetDir string, numWorkers int) error {
+// filter returns the include and exclude patterns recorded in the manifest
+func (m *Manifest) filter() hash.Filter {
+	return hash.Filter{Includes: m.Includes, Excludes: m.Excludes, Rules: m.ExcludeRules}
+}
+
+// SetVerifyOptions sets options used by subsequent Verify* calls
+func (m *Manifest) SetVerifyOptions(opts VerifyOptions) {
+	m.verifyOptions = opts
+}
+
+// Verify checks the integrity of files with context.
+// The returned error wraps ErrIntegrityCheckFailed when the report contains changes.
+func (m *Manifest) Verify(ctx context.Context, targetDir string, numWorkers int) (*VerificationReport, error) {
 	calculator := hash.NewCalculator(numWorkers)
 	return m.verifyWithCalculator(ctx, targetDir, calculator)
 }
 
 // VerifyWithRateLimit checks the integrity of files with rate limiting and context
-func (m *Manifest) VerifyWithRateLimit(ctx context.Context, targetDir string, numWorkers int, bytesPerSec int64) error {
+func (m *Manifest) VerifyWithRateLimit(ctx context.Context, targetDir string, numWorkers int, bytesPerSec int64) (*VerificationReport, error) {
 	calculator := hash.NewCalculatorWithRateLimit(numWorkers, bytesPerSec)
 	return m.verifyWithCalculator(ctx, targetDir, calculator)
 }
 
+// errCacheWithRoots is returned by the cached verification of a manifest with
+// several roots; the cache is keyed by paths relative to a single directory
+var errCacheWithRoots = errors.New("cache is not supported for manifests with multiple roots")
+
 // VerifyWithCache checks integrity using cache with probabilistic verification
-func (m *Manifest) VerifyWithCache(ctx context.Context, targetDir, cacheDir, baseName, appName string, numWorkers int, verifyProbability float64, debug bool) error {
+func (m *Manifest) VerifyWithCache(ctx context.Context, targetDir, cacheDir, baseName, appName string, numWorkers int, verifyProbability float64, debug bool) (*VerificationReport, error) {
+	if len(m.Roots) > 0 {
+		return nil, errCacheWithRoots
+	}
 	calculator := hash.NewCalculator(numWorkers)
 	calculator.SetDebugMode(debug)
 	// Enable cache for the specified directory
 	manifestTime, _ := time.Parse(time.RFC3339, m.GeneratedAt)
 	if err := calculator.EnableMetadataCache(cacheDir, baseName, appName, manifestTime); err != nil {
-		return fmt.Errorf("failed to enable cache: %w", err)
+		return nil, fmt.Errorf("failed to enable cache: %w", err)
 	}
 	calculator.SetVerifyProbability(verifyProbability)
 	// Set manifest hashes for cache-based verification
@@ -145,7 +306,7 @@ func (m *Manifest) VerifyWithCache(ctx context.Context, targetDir, cacheDir, bas
 	calculator.SetManifestHashes(manifestHashes)
 
 	// Perform verification
-	err := m.verifyWithCalculator(ctx, targetDir, calculator)
+	report, err := m.verifyWithCalculator(ctx, targetDir, calculator)
 
 	// Only update cache if verification was successful
 	if err == nil {
@@ -153,17 +314,20 @@ func (m *Manifest) VerifyWithCache(ctx context.Context, targetDir, cacheDir, bas
 		calculator.SaveMetadataCache()
 	}
 
-	return err
+	return report, err
 }
 
 // VerifyWithCacheAndRateLimit combines cache verification with rate limiting
-func (m *Manifest) VerifyWithCacheAndRateLimit(ctx context.Context, targetDir, cacheDir, baseName, appName string, numWorkers int, bytesPerSec int64, verifyProbability float64, debug bool) error {
+func (m *Manifest) VerifyWithCacheAndRateLimit(ctx context.Context, targetDir, cacheDir, baseName, appName string, numWorkers int, bytesPerSec int64, verifyProbability float64, debug bool) (*VerificationReport, error) {
+	if len(m.Roots) > 0 {
+		return nil, errCacheWithRoots
+	}
 	calculator := hash.NewCalculatorWithRateLimit(numWorkers, bytesPerSec)
 	calculator.SetDebugMode(debug)
 	// Enable cache for the specified directory
 	manifestTime, _ := time.Parse(time.RFC3339, m.GeneratedAt)
 	if err := calculator.EnableMetadataCache(cacheDir, baseName, appName, manifestTime); err != nil {
-		return fmt.Errorf("failed to enable cache: %w", err)
+		return nil, fmt.Errorf("failed to enable cache: %w", err)
 	}
 	calculator.SetVerifyProbability(verifyProbability)
 	// Set manifest hashes for cache-based verification
@@ -174,7 +338,7 @@ func (m *Manifest) VerifyWithCacheAndRateLimit(ctx context.Context, targetDir, c
 	calculator.SetManifestHashes(manifestHashes)
 
 	// Perform verification
-	err := m.verifyWithCalculator(ctx, targetDir, calculator)
+	report, err := m.verifyWithCalculator(ctx, targetDir, calculator)
 
 	// Only update cache if verification was successful
 	if err == nil {
@@ -182,82 +346,201 @@ func (m *Manifest) VerifyWithCacheAndRateLimit(ctx context.Context, targetDir, c
 		calculator.SaveMetadataCache()
 	}
 
-	return err
+	return report, err
 }
 
 // verifyWithCalculator performs the actual verification with the provided calculator and context
-func (m *Manifest) verifyWithCalculator(ctx context.Context, targetDir string, calculator *hash.Calculator) error {
-	// Calculate current state with same patterns
-	currentResult, err := calculator.CalculateDirectory(ctx, targetDir, m.Excludes)
+func (m *Manifest) verifyWithCalculator(ctx context.Context, targetDir string, calculator *hash.Calculator) (*VerificationReport, error) {
+	// Calculate current state with same patterns and digest
+	if err := m.setupCalculator(calculator); err != nil {
+		return nil, err
+	}
+	currentResult, err := m.calculate(ctx, targetDir, calculator)
 	if err != nil {
-		return fmt.Errorf("failed to calculate current state: %w", err)
+		return nil, fmt.Errorf("failed to calculate current state: %w", err)
 	}
 
-	// Compare file hashes
-	manifestMap := make(map[string]hash.FileInfo)
-	for _, f := range m.Files {
-		manifestMap[f.Path] = f
+	opts := m.verifyOptions
+	opts.compareXattrs = len(m.XattrNamespaces) > 0
+	opts.levels = m.Levels
+
+	currentFiles := m.withoutAppendOnly(currentResult.Files)
+	report := m.compareWith(currentFiles, currentResult.Directories, opts)
+	if len(m.AppendOnly) > 0 {
+		if err := m.checkAppendOnly(ctx, targetDir, opts.AppendState, report); err != nil {
+			return nil, err
+		}
+	}
+	report.applyChangeRules(m.ChangeRules)
+
+	if m.Merkle != nil && !report.OK() {
+		// Manifests from older versions have no directory entries
+		var currentDirs []hash.FileInfo
+		if len(m.Directories) > 0 {
+			currentDirs = currentResult.Directories
+		}
+		subtree, err := m.differingSubtree(currentFiles, currentDirs)
+		if err != nil {
+			return nil, err
+		}
+		report.setDifferingSubtree(subtree)
+	}
+	return report, report.Err()
+}
+
+// setupCalculator makes the calculator record entries like the manifest did
+func (m *Manifest) setupCalculator(calculator *hash.Calculator) error {
+	algorithm, err := hash.ParseAlgorithm(string(m.HashAlgorithm))
+	if err != nil {
+		return fmt.Errorf("cannot verify manifest: %w", err)
+	}
+	calculator.SetAlgorithm(algorithm)
+	calculator.SetXattrNamespaces(m.XattrNamespaces)
+	return nil
+}
+
+// calculate hashes the target directory, or every root of a manifest with
+// several roots, using the patterns of the manifest
+func (m *Manifest) calculate(ctx context.Context, targetDir string, calculator *hash.Calculator) (*hash.Result, error) {
+	if len(m.Roots) == 0 {
+		return calculator.CalculateDirectoryWithFilter(ctx, targetDir, m.filter())
+	}
+
+	roots, err := m.verifyRoots(m.verifyOptions.RootPaths)
+	if err != nil {
+		return nil, err
+	}
+	return calculateRoots(ctx, calculator, roots, m.filter())
+}
+
+// ScanExcluded reports suspicious entries in the paths the manifest excludes.
+// See hash.ScanExcluded. The roots of a manifest with several roots are
+// scanned instead of targetDir.
+func (m *Manifest) ScanExcluded(ctx context.Context, targetDir string, extensions []string) ([]hash.Finding, error) {
+	if len(m.Roots) == 0 {
+		return hash.ScanExcluded(ctx, targetDir, m.filter(), extensions)
+	}
+
+	roots, err := m.verifyRoots(m.verifyOptions.RootPaths)
+	if err != nil {
+		return nil, err
 	}
 
-	currentMap := make(map[string]hash.FileInfo)
-	for _, f := range currentResult.Files {
-		currentMap[f.Path] = f
+	var findings []hash.Finding
+	for _, root := range roots {
+		filter := m.filter()
+		filter.Root = root.Name
+
+		rootFindings, err := hash.ScanExcluded(ctx, root.Path, filter, extensions)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %w", root.Name, err)
+		}
+		for _, finding := range rootFindings {
+			finding.Path = rootPath(root.Name, finding.Path)
+			findings = append(findings, finding)
+		}
+	}
+	return findings, nil
+}
+
+// compareWith builds a report of the differences between the manifest and
+// the given entries, either scanned from disk or recorded in another manifest
+func (m *Manifest) compareWith(files, directories []hash.FileInfo, opts VerifyOptions) *VerificationReport {
+	report := compareFiles(m.Files, files, opts)
+
+	// Manifests from older versions have no directory entries
+	if len(m.Directories) > 0 && len(directories) > 0 {
+		report.compareEntries(m.Directories, directories, opts)
+		report.sortChanges()
 	}
 
-	issues := make([]string, 0, 10)
+	return report
+}
+
+// compareFiles builds a report of the differences between expected and actual entries
+func compareFiles(expected, actual []hash.FileInfo, opts VerifyOptions) *VerificationReport {
+	report := &VerificationReport{
+		TotalFiles: len(expected),
+	}
+	report.VerifiedFiles = report.compareEntries(expected, actual, opts)
+	report.sortChanges()
+	return report
+}
+
+// compareEntries appends the differences between expected and actual entries
+// to the report and returns the number of unchanged entries
+func (r *VerificationReport) compareEntries(expected, actual []hash.FileInfo, opts VerifyOptions) int {
+	expectedMap := make(map[string]hash.FileInfo, len(expected))
+	for _, f := range expected {
+		expectedMap[f.Path] = f
+	}
+
+	actualMap := make(map[string]hash.FileInfo, len(actual))
+	for _, f := range actual {
+		actualMap[f.Path] = f
+	}
+
+	verified := 0
 
 	// Check for modified/deleted files (checking hash/size/type)
-	for path, expectedFile := range manifestMap {
-		if actualFile, exists := currentMap[path]; exists {
-			// Check file type (symlink vs regular file)
-			if expectedFile.IsSymlink != actualFile.IsSymlink {
-				// Use modified: prefix for CLI compatibility
-				issues = append(issues, fmt.Sprintf(
-					"modified: %s (type %s→%s)",
-					path,
-					func() string {
-						if expectedFile.IsSymlink {
-							return "symlink"
-						}
-						return "file"
-					}(),
-					func() string {
-						if actualFile.IsSymlink {
-							return "symlink"
-						}
-						return "file"
-					}(),
-				))
-				continue
-			}
-			// Check content hash
-			if expectedFile.Hash != actualFile.Hash {
-				issues = append(issues, fmt.Sprintf("modified: %s (hash)", path))
-				continue
-			}
-			// Check size (for both symlinks and regular files for consistency with totalHash)
-			if expectedFile.Size != actualFile.Size {
-				issues = append(issues, fmt.Sprintf(
-					"modified: %s (size %d→%d)", path, expectedFile.Size, actualFile.Size))
-				continue
-			}
-		} else {
-			issues = append(issues, fmt.Sprintf("deleted: %s", path))
+	for path, expectedFile := range expectedMap {
+		actualFile, exists := actualMap[path]
+		if !exists {
+			r.Changes = append(r.Changes, deletedChange(expectedFile))
+			continue
+		}
+		if r.compareExisting(expectedFile, actualFile, opts) {
+			verified++
 		}
 	}
 
 	// Check for added files
-	for path := range currentMap {
-		if _, exists := manifestMap[path]; !exists {
-			issues = append(issues, fmt.Sprintf("added: %s", path))
+	for path, actualFile := range actualMap {
+		if _, exists := expectedMap[path]; !exists {
+			r.Changes = append(r.Changes, addedChange(actualFile))
 		}
 	}
 
-	if len(issues) > 0 {
-		return fmt.Errorf("integrity check failed:\n%s", strings.Join(issues, "\n"))
+	return verified
+}
+
+// compareExisting appends the differences between an entry and its current
+// state to the report and reports whether the entry is unchanged
+func (r *VerificationReport) compareExisting(expected, actual hash.FileInfo, opts VerifyOptions) bool {
+	level := levelOf(opts.levels, expected.Path)
+	if level == LevelExists {
+		return true
+	}
+	if opts.ignoreHashes {
+		expected, actual = withoutHash(expected), withoutHash(actual)
 	}
 
-	return nil
+	clean := true
+	if change, changed := compareEntry(expected, actual); changed && !(level == LevelMetadata && contentChange(change)) {
+		r.Changes = append(r.Changes, change)
+		clean = false
+		if change.Kind == ChangeTypeChanged {
+			// Metadata of a different kind of entry is not comparable
+			return false
+		}
+	}
+	if opts.compareXattrs && expected.XattrDigest != actual.XattrDigest {
+		r.Changes = append(r.Changes, xattrChange(expected, actual))
+		clean = false
+	}
+	if links := compareLinks(expected, actual); len(links) > 0 {
+		r.Changes = append(r.Changes, links...)
+		clean = false
+	}
+	for _, change := range compareMetadata(expected, actual) {
+		if change.Reason == "owner" && opts.OwnerAdvisory {
+			r.Warnings = append(r.Warnings, change)
+			continue
+		}
+		r.Changes = append(r.Changes, change)
+		clean = false
+	}
+	return clean
 }
 
 // GetSummary returns a summary of the manifest
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -169,7 +170,7 @@ func TestManifestVerify(t *testing.T) {
 	}
 
 	// Verify should pass
-	err = manifest.Verify(context.Background(), tempDir, 0)
+	_, err = manifest.Verify(context.Background(), tempDir, 0)
 	if err != nil {
 		t.Errorf("Verify() should pass for unchanged files: %v", err)
 	}
@@ -182,7 +183,7 @@ func TestManifestVerify(t *testing.T) {
 	}
 
 	// Verify should fail
-	err = manifest.Verify(context.Background(), tempDir, 0)
+	_, err = manifest.Verify(context.Background(), tempDir, 0)
 	if err == nil {
 		t.Error("Verify() should fail for modified files")
 	}
@@ -276,6 +277,65 @@ func TestManifestWithPatterns(t *testing.T) {
 	}
 }
 
+func TestManifestIncludePatterns(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"app/Kernel.php":       "<?php // kernel",
+		"app/cache/view.php":   "<?php // compiled",
+		"config/app.php":       "<?php return [];",
+		"public/index.php":     "<?php // front controller",
+		"public/css/app.css":   "body {}",
+		"storage/logs/app.log": "log line",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tempDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generator := NewGenerator(0)
+	generator.SetIncludes([]string{"app/**", "config/**", "public/*.php"})
+	manifest, err := generator.Generate(context.Background(), tempDir, []string{"app/cache/**"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if manifest.FileCount != 3 {
+		t.Errorf("FileCount = %d, want 3", manifest.FileCount)
+	}
+	if !reflect.DeepEqual(manifest.Includes, []string{"app/**", "config/**", "public/*.php"}) {
+		t.Errorf("Includes = %v", manifest.Includes)
+	}
+
+	// Changes outside the include patterns are ignored
+	if err := os.WriteFile(filepath.Join(tempDir, "public/css/app.css"), []byte("body { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "storage/logs/new.log"), []byte("more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "app/cache/other.php"), []byte("<?php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifest.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Fatalf("Verify() should ignore paths outside the includes, got: %v", err)
+	}
+
+	// Changes inside them are detected
+	if err := os.WriteFile(filepath.Join(tempDir, "public/shell.php"), []byte("<?php eval($_POST['x']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = manifest.Verify(context.Background(), tempDir, 0)
+	if err == nil || !strings.Contains(err.Error(), "added: public/shell.php") {
+		t.Errorf("Verify() should report public/shell.php, got: %v", err)
+	}
+}
+
 func TestManifestExcludePatterns(t *testing.T) {
 	// Create test directory
 	tempDir := t.TempDir()
@@ -319,7 +379,7 @@ func TestManifestExcludePatterns(t *testing.T) {
 
 	// Test manifest.Verify() uses excludes correctly
 	t.Run("verify with original files", func(t *testing.T) {
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err != nil {
 			t.Errorf("Verify() should succeed with original files: %v", err)
 		}
@@ -333,7 +393,7 @@ func TestManifestExcludePatterns(t *testing.T) {
 		}
 
 		// Verify should still pass because the file is excluded
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err != nil {
 			t.Errorf("Verify() should succeed even with modified excluded file: %v", err)
 		}
@@ -347,7 +407,7 @@ func TestManifestExcludePatterns(t *testing.T) {
 		}
 
 		// Verify should still pass because the file matches exclude pattern
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err != nil {
 			t.Errorf("Verify() should succeed even with added excluded file: %v", err)
 		}
@@ -361,7 +421,7 @@ func TestManifestExcludePatterns(t *testing.T) {
 		}
 
 		// Verify should fail because the file is included
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail with modified included file")
 		} else if !strings.Contains(err.Error(), "modified: app.go") {
@@ -382,7 +442,7 @@ func TestManifestExcludePatterns(t *testing.T) {
 		}
 
 		// Verify should fail because the file is not excluded
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail with added included file")
 		} else if !strings.Contains(err.Error(), "added: new.go") {
@@ -433,13 +493,13 @@ func TestVerifyWithRateLimit(t *testing.T) {
 	}
 
 	// Test normal verify
-	err = manifest.Verify(context.Background(), tempDir, 0)
+	_, err = manifest.Verify(context.Background(), tempDir, 0)
 	if err != nil {
 		t.Errorf("Normal verify should pass: %v", err)
 	}
 
 	// Test rate limited verify
-	err = manifest.VerifyWithRateLimit(context.Background(), tempDir, 0, 1024*1024) // 1MB/s
+	_, err = manifest.VerifyWithRateLimit(context.Background(), tempDir, 0, 1024*1024) // 1MB/s
 	if err != nil {
 		t.Errorf("Rate limited verify should pass: %v", err)
 	}
@@ -452,8 +512,8 @@ func TestVerifyWithRateLimit(t *testing.T) {
 	}
 
 	// Both should fail with modified file
-	err1 := manifest.Verify(context.Background(), tempDir, 0)
-	err2 := manifest.VerifyWithRateLimit(context.Background(), tempDir, 0, 1024*1024)
+	_, err1 := manifest.Verify(context.Background(), tempDir, 0)
+	_, err2 := manifest.VerifyWithRateLimit(context.Background(), tempDir, 0, 1024*1024)
 
 	if err1 == nil || err2 == nil {
 		t.Error("Both verify methods should fail with modified file")
@@ -482,3 +542,143 @@ func createTestDirectory(t *testing.T) string {
 
 	return tempDir
 }
+
+func TestManifestExcludeRules(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"app/main.php":           "<?php // main",
+		"storage/logs/app.log":   "log line",
+		"storage/logs/audit.log": "audit line",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(tempDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := hash.ParseRules(strings.NewReader("*.log\n!audit.log\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	generator.SetExcludeRules(rules)
+	generated, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if generated.FileCount != 2 {
+		t.Errorf("FileCount = %d, want 2", generated.FileCount)
+	}
+
+	// The rules travel with the manifest
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := SaveToFile(generated, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.ExcludeRules, rules) {
+		t.Errorf("ExcludeRules = %v, want %v", loaded.ExcludeRules, rules)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "storage/logs/new.log"), []byte("more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Fatalf("Verify() should ignore excluded logs, got: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "storage/logs/audit.log"), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Verify(context.Background(), tempDir, 0); err == nil {
+		t.Error("Verify() should detect a change to a re-included file")
+	}
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	tempDir := createTestDirectory(t)
+
+	generator := NewGenerator(2)
+	generator.SetHashAlgorithm(hash.SHA512)
+	m, err := generator.Generate(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.HashAlgorithm != hash.SHA512 || len(m.Files[0].Hash) != 128 {
+		t.Fatalf("HashAlgorithm = %q, hash = %s, want a SHA-512 manifest", m.HashAlgorithm, m.Files[0].Hash)
+	}
+	if _, err := m.Verify(ctx, tempDir, 2); err != nil {
+		t.Errorf("Verify() of a SHA-512 manifest error = %v", err)
+	}
+
+	// Manifests without the field were hashed with SHA-256
+	legacy, err := NewGenerator(2).Generate(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.HashAlgorithm != hash.SHA256 {
+		t.Errorf("default HashAlgorithm = %q, want sha256", legacy.HashAlgorithm)
+	}
+	legacy.HashAlgorithm = ""
+	if _, err := legacy.Verify(ctx, tempDir, 2); err != nil {
+		t.Errorf("Verify() of a manifest without an algorithm error = %v", err)
+	}
+
+	// Digests of different algorithms are not compared, other changes are
+	if diff := Diff(legacy, m); len(diff.Changes) != 0 || len(diff.PatternChanges) != 1 || diff.PatternChanges[0].Field != "hash_algorithm" {
+		t.Errorf("Diff() across algorithms = %+v, want only the algorithm change", diff)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("longer tampered content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := generator.Generate(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := Diff(legacy, changed); len(diff.Changes) != 1 || diff.Changes[0].Reason != "size" {
+		t.Errorf("Diff() across algorithms = %+v, want a size change of test.txt", diff.Changes)
+	}
+	if _, err := m.Verify(ctx, tempDir, 2); !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Errorf("Verify() after tampering error = %v, want ErrIntegrityCheckFailed", err)
+	}
+
+	m.HashAlgorithm = "md5"
+	if _, err := m.Verify(ctx, tempDir, 2); err == nil || !strings.Contains(err.Error(), "unsupported hash algorithm") {
+		t.Errorf("Verify() with an unknown algorithm error = %v, want an unsupported algorithm error", err)
+	}
+
+	// Append-only prefix digests use the algorithm of the manifest too
+	if err := os.WriteFile(filepath.Join(tempDir, "app.log"), []byte("line 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generator.SetAppendOnly([]hash.AppendRule{{Path: "*.log"}})
+	logged, err := generator.Generate(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged.AppendFiles) != 1 || len(logged.AppendFiles[0].Hash) != 128 {
+		t.Fatalf("AppendFiles = %+v, want a SHA-512 prefix digest", logged.AppendFiles)
+	}
+	f, err := os.OpenFile(filepath.Join(tempDir, "app.log"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString("line 2\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := logged.Verify(ctx, tempDir, 2); err != nil {
+		t.Errorf("Verify() after appending to a log error = %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// Merkle is a hash tree over the entries of a manifest. The digest of a
+// directory covers the name, type, content digest, size, mode and device
+// numbers of everything below it, so two trees with the same root hold the
+// same content. Owners, modification times and hard links are not covered,
+// so hosts deployed from the same build share a root. Entries at the metadata
+// or exists level contribute only what verify compares for them.
+type Merkle struct {
+	Root        string            `json:"root"`
+	Directories map[string]string `json:"directories,omitempty"` // Digest of every directory below the root, by path
+}
+
+// ComputeMerkle computes the hash tree of the entries with the algorithm of
+// the manifest
+func (m *Manifest) ComputeMerkle() (*Merkle, error) {
+	b, err := m.newMerkleBuilder(nil)
+	if err != nil {
+		return nil, err
+	}
+	b.digests = make(map[string]string)
+	b.addAll(m.Files, m.Directories)
+	root := b.finish()
+
+	delete(b.digests, ".")
+	return &Merkle{Root: root.digest, Directories: b.digests}, nil
+}
+
+// differingSubtree builds the hash tree of the current entries and returns
+// the deepest directory whose subtree differs from the recorded one
+func (m *Manifest) differingSubtree(files, directories []hash.FileInfo) (string, error) {
+	b, err := m.newMerkleBuilder(m.Merkle)
+	if err != nil {
+		return "", err
+	}
+	b.addAll(files, directories)
+	return b.finish().confined, nil
+}
+
+// newMerkleBuilder returns a builder with the algorithm and levels of the manifest
+func (m *Manifest) newMerkleBuilder(recorded *Merkle) (*merkleBuilder, error) {
+	algorithm, err := hash.ParseAlgorithm(string(m.HashAlgorithm))
+	if err != nil {
+		return nil, err
+	}
+	return &merkleBuilder{
+		algorithm: algorithm,
+		levels:    m.Levels,
+		recorded:  recorded,
+		frames:    []*merkleFrame{newMerkleFrame(".")},
+	}, nil
+}
+
+// merkleBuilder computes a hash tree from entries added in path order. The
+// contents of a directory are contiguous in that order, so only the
+// directories on the path to the last entry are open at any time.
+type merkleBuilder struct {
+	algorithm hash.Algorithm
+	levels    []LevelRule
+	recorded  *Merkle           // Tree to locate the differences against, or nil
+	digests   map[string]string // Digests of the closed directories, when kept
+	frames    []*merkleFrame    // Open directories from the root down
+}
+
+// merkleFrame is an open directory with the children added so far
+type merkleFrame struct {
+	path    string
+	leaves  map[string][]byte // Encoded files by name
+	subdirs map[string]merkleSubtree
+}
+
+// merkleSubtree is a child directory of a frame
+type merkleSubtree struct {
+	entry    []byte // Encoded directory entry, nil when the manifest has none
+	closed   bool
+	digest   string
+	confined string // Deepest directory holding the differences with the recorded tree, "" when there are none
+}
+
+func newMerkleFrame(p string) *merkleFrame {
+	return &merkleFrame{path: p, leaves: make(map[string][]byte), subdirs: make(map[string]merkleSubtree)}
+}
+
+// addAll adds files and directories held in memory, in path order
+func (b *merkleBuilder) addAll(files, directories []hash.FileInfo) {
+	entries := slices.Concat(directories, files)
+	slices.SortFunc(entries, func(x, y hash.FileInfo) int { return strings.Compare(x.Path, y.Path) })
+	for _, f := range entries {
+		b.add(f)
+	}
+}
+
+// add adds the next entry in path order
+func (b *merkleBuilder) add(f hash.FileInfo) {
+	if f.Path == "." {
+		return
+	}
+	frame := b.open(path.Dir(f.Path))
+	name := path.Base(f.Path)
+	enc := encodeLeaf(f, levelOf(b.levels, f.Path))
+	if f.IsDir {
+		// The contents follow later, after the siblings sorting before "name/"
+		frame.subdirs[name] = merkleSubtree{entry: enc}
+		return
+	}
+	frame.leaves[name] = enc
+}
+
+// open closes the frames outside dir and opens the frames down to it
+func (b *merkleBuilder) open(dir string) *merkleFrame {
+	for {
+		top := b.frames[len(b.frames)-1]
+		if top.path == dir || top.path == "." || strings.HasPrefix(dir, top.path+"/") {
+			break
+		}
+		b.close()
+	}
+
+	top := b.frames[len(b.frames)-1]
+	if top.path == dir {
+		return top
+	}
+	rest := strings.TrimPrefix(dir, top.path+"/")
+	if top.path == "." {
+		rest = dir
+	}
+	p := top.path
+	for name := range strings.SplitSeq(rest, "/") {
+		if p == "." {
+			p = name
+		} else {
+			p += "/" + name
+		}
+		b.frames = append(b.frames, newMerkleFrame(p))
+	}
+	return b.frames[len(b.frames)-1]
+}
+
+// close closes the innermost frame and stores its digest in its parent
+func (b *merkleBuilder) close() {
+	frame := b.frames[len(b.frames)-1]
+	b.frames = b.frames[:len(b.frames)-1]
+	parent := b.frames[len(b.frames)-1]
+
+	name := path.Base(frame.path)
+	sub := b.summarize(frame)
+	sub.entry = parent.subdirs[name].entry
+	parent.subdirs[name] = sub
+}
+
+// finish closes every frame and returns the root
+func (b *merkleBuilder) finish() merkleSubtree {
+	for len(b.frames) > 1 {
+		b.close()
+	}
+	return b.summarize(b.frames[0])
+}
+
+// summarize computes the digest of a frame and locates its differences with
+// the recorded tree
+func (b *merkleBuilder) summarize(frame *merkleFrame) merkleSubtree {
+	// Directories whose contents never followed are empty
+	for name, sub := range frame.subdirs {
+		if !sub.closed {
+			empty := b.summarize(newMerkleFrame(path.Join(frame.path, name)))
+			empty.entry = sub.entry
+			frame.subdirs[name] = empty
+		}
+	}
+
+	sub := merkleSubtree{closed: true, digest: b.digest(frame, "", "")}
+	if b.digests != nil {
+		b.digests[frame.path] = sub.digest
+	}
+	if b.recorded == nil {
+		return sub
+	}
+
+	recorded := b.recorded.directory(frame.path)
+	if sub.digest == recorded {
+		return sub
+	}
+	sub.confined = frame.path
+
+	// The differences are confined to a single child directory when the
+	// frame hashes as recorded with the recorded digest of that child
+	var differing []string
+	for name, child := range frame.subdirs {
+		if child.digest != b.recorded.directory(path.Join(frame.path, name)) {
+			differing = append(differing, name)
+		}
+	}
+	if len(differing) == 1 {
+		name := differing[0]
+		childRecorded := b.recorded.directory(path.Join(frame.path, name))
+		if childRecorded != "" && b.digest(frame, name, childRecorded) == recorded {
+			sub.confined = frame.subdirs[name].confined
+		}
+	}
+	return sub
+}
+
+// digest hashes the children of a frame in name order, using digest as the
+// digest of the child directory named replace when it is set
+func (b *merkleBuilder) digest(frame *merkleFrame, replace, digest string) string {
+	names := make([]string, 0, len(frame.leaves)+len(frame.subdirs))
+	for name := range frame.leaves {
+		names = append(names, name)
+	}
+	for name := range frame.subdirs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	h := b.algorithm.New()
+	for _, name := range names {
+		writeField(h, []byte(name))
+		if leaf, ok := frame.leaves[name]; ok {
+			writeField(h, leaf)
+			continue
+		}
+		child := frame.subdirs[name]
+		if name == replace {
+			child.digest = digest
+		}
+		writeField(h, child.entry)
+		writeField(h, []byte(child.digest))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// directory returns the recorded digest of the directory at p
+func (m *Merkle) directory(p string) string {
+	if p == "." {
+		return m.Root
+	}
+	return m.Directories[p]
+}
+
+// encodeLeaf encodes the fields of an entry compared at the given level
+func encodeLeaf(f hash.FileInfo, level Level) []byte {
+	var buf bytes.Buffer
+	writeField(&buf, []byte(EntryType(f)))
+	if level == LevelExists {
+		return buf.Bytes()
+	}
+	writeField(&buf, []byte(f.Mode))
+	writeField(&buf, []byte(formatDevice(f)))
+	if level == LevelMetadata {
+		return buf.Bytes()
+	}
+	writeField(&buf, []byte(f.Hash))
+	writeField(&buf, []byte(fmt.Sprint(f.Size)))
+	writeField(&buf, []byte(f.LinkTarget))
+	return buf.Bytes()
+}
+
+// writeField writes a length-prefixed field, so that no two sequences of
+// fields have the same encoding
+func writeField(w io.Writer, field []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+	w.Write(length[:])
+	w.Write(field)
+}
@@ -0,0 +1,144 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeMerkle(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, name := range []string{"app/a.php", "app/lib/b.php", "public/index.php", "README"} {
+		writeTestFile(t, filepath.Join(dir, name), name)
+	}
+
+	m, err := NewGenerator(2).Generate(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Merkle == nil || len(m.Merkle.Root) != 64 {
+		t.Fatalf("Merkle = %+v, want a SHA-256 root", m.Merkle)
+	}
+	for _, p := range []string{"app", "app/lib", "public"} {
+		if m.Merkle.Directories[p] == "" {
+			t.Errorf("Merkle.Directories has no digest for %s: %v", p, m.Merkle.Directories)
+		}
+	}
+
+	// Modification times are not part of the tree
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "app/a.php"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	touched, err := NewGenerator(2).Generate(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if touched.Merkle.Root != m.Merkle.Root {
+		t.Errorf("Merkle root changed with a modification time: %s -> %s", m.Merkle.Root, touched.Merkle.Root)
+	}
+
+	// Content changes propagate to the root through the parents only
+	writeTestFile(t, filepath.Join(dir, "app/lib/b.php"), "tampered")
+	changed, err := NewGenerator(2).Generate(ctx, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Merkle.Root == m.Merkle.Root {
+		t.Error("Merkle root should change with a file")
+	}
+	for p, want := range map[string]bool{"app": true, "app/lib": true, "public": false} {
+		if got := changed.Merkle.Directories[p] != m.Merkle.Directories[p]; got != want {
+			t.Errorf("digest of %s changed = %v, want %v", p, got, want)
+		}
+	}
+
+	// The stored tree matches the one computed from the entries
+	recomputed, err := changed.ComputeMerkle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recomputed.Root != changed.Merkle.Root {
+		t.Errorf("ComputeMerkle() root = %s, want %s", recomputed.Root, changed.Merkle.Root)
+	}
+}
+
+func TestVerifyDifferingSubtree(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   string
+	}{
+		{"nested file", func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "app/lib/deep/c.php"), "tampered")
+		}, "app/lib/deep"},
+		{"added file", func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "app/lib/shell.php"), "<?php")
+		}, "app/lib"},
+		{"empty directory", func(t *testing.T, dir string) {
+			if err := os.Mkdir(filepath.Join(dir, "app/lib/deep/new"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, "app/lib/deep"},
+		{"two subtrees", func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "app/a.php"), "tampered")
+			writeTestFile(t, filepath.Join(dir, "app/lib/b.php"), "tampered")
+		}, "app"},
+		{"spread", func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "app/a.php"), "tampered")
+			writeTestFile(t, filepath.Join(dir, "public/index.php"), "tampered")
+		}, ""},
+		{"mode outside the tree", func(t *testing.T, dir string) {
+			// A directory mode change is reported at the directory itself
+			if err := os.Chmod(filepath.Join(dir, "app/lib"), 0700); err != nil {
+				t.Fatal(err)
+			}
+		}, "app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"app/a.php", "app/lib/b.php", "app/lib/deep/c.php", "public/index.php"} {
+				writeTestFile(t, filepath.Join(dir, name), name)
+			}
+			m, err := NewGenerator(2).Generate(ctx, dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+			if err := SaveToFile(m, manifestPath); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(t, dir)
+
+			report, err := m.Verify(ctx, dir, 2)
+			if !errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+			}
+			if report.DifferingSubtree != tt.want {
+				t.Errorf("DifferingSubtree = %q, want %q (changes %v)", report.DifferingSubtree, tt.want, report.Changes)
+			}
+
+			f, err := OpenManifestFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			streamed, err := f.Verify(ctx, dir, 2)
+			if streamed == nil {
+				t.Fatalf("stream Verify() error = %v", err)
+			}
+			if streamed.DifferingSubtree != tt.want {
+				t.Errorf("stream DifferingSubtree = %q, want %q", streamed.DifferingSubtree, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// ErrIntegrityCheckFailed is wrapped by the error returned from Verify* when
+// the report contains changes
+var ErrIntegrityCheckFailed = errors.New("integrity check failed")
+
+// ChangeKind describes how an entry differs from the manifest
+type ChangeKind string
+
+const (
+	ChangeModified    ChangeKind = "modified"
+	ChangeAdded       ChangeKind = "added"
+	ChangeDeleted     ChangeKind = "deleted"
+	ChangeTypeChanged ChangeKind = "type_changed"
+	ChangeMetadata    ChangeKind = "metadata_changed"
+	ChangeXattr       ChangeKind = "xattr_changed"
+	ChangeLink        ChangeKind = "link_changed"
+	ChangeAppend      ChangeKind = "append_violated"
+)
+
+// VerifyOptions tunes how differences are classified during verification
+type VerifyOptions struct {
+	// OwnerAdvisory reports uid/gid changes as warnings instead of failures,
+	// for deployments where uids differ between hosts
+	OwnerAdvisory bool
+
+	// AppendState is a file where the state of the append-only files is kept
+	// between runs; without it they are checked against the manifest only
+	AppendState string
+
+	// RootPaths replaces the directories recorded for the roots of a manifest
+	// with several roots, keyed by root name
+	RootPaths map[string]string
+
+	// compareXattrs is set when the manifest recorded extended attributes
+	compareXattrs bool
+
+	// levels are the monitoring levels recorded in the manifest
+	levels []LevelRule
+
+	// ignoreHashes is set when comparing manifests hashed with different
+	// algorithms, whose content digests are not comparable
+	ignoreHashes bool
+}
+
+// Change is a single difference between the manifest and the current state.
+// Old* fields describe the manifest entry and New* fields the current entry;
+// they are empty when the entry does not exist on that side.
+type Change struct {
+	Path          string     `json:"path"`
+	Kind          ChangeKind `json:"kind"`
+	Reason        string     `json:"reason,omitempty"`
+	OldType       string     `json:"old_type,omitempty"`
+	NewType       string     `json:"new_type,omitempty"`
+	OldHash       string     `json:"old_hash,omitempty"`
+	NewHash       string     `json:"new_hash,omitempty"`
+	OldSize       *int64     `json:"old_size,omitempty"`
+	NewSize       *int64     `json:"new_size,omitempty"`
+	OldLinkTarget string     `json:"old_link_target,omitempty"`
+	NewLinkTarget string     `json:"new_link_target,omitempty"`
+	OldMode       string     `json:"old_mode,omitempty"`
+	NewMode       string     `json:"new_mode,omitempty"`
+	OldOwner      string     `json:"old_owner,omitempty"`
+	NewOwner      string     `json:"new_owner,omitempty"`
+	OldDevice     string     `json:"old_device,omitempty"`
+	NewDevice     string     `json:"new_device,omitempty"`
+	OldXattr      string     `json:"old_xattr_digest,omitempty"`
+	NewXattr      string     `json:"new_xattr_digest,omitempty"`
+	OldNlink      uint64     `json:"old_nlink,omitempty"`
+	NewNlink      uint64     `json:"new_nlink,omitempty"`
+	OldLinkGroup  string     `json:"old_link_group,omitempty"`
+	NewLinkGroup  string     `json:"new_link_group,omitempty"`
+	Rule          string     `json:"rule,omitempty"`         // Path glob of the change rule applying to the entry
+	ForbiddenBy   string     `json:"forbidden_by,omitempty"` // Forbid glob of that rule matching the entry
+}
+
+// Detail returns a short human-readable description of what changed
+func (c Change) Detail() string {
+	switch c.Kind {
+	case ChangeTypeChanged:
+		return fmt.Sprintf("%s→%s", c.OldType, c.NewType)
+	case ChangeAdded:
+		return c.NewType
+	case ChangeDeleted:
+		return c.OldType
+	case ChangeAppend:
+		if c.NewSize == nil {
+			return c.Reason
+		}
+		return fmt.Sprintf("%s, size %d→%d", c.Reason, derefSize(c.OldSize), derefSize(c.NewSize))
+	}
+
+	switch c.Reason {
+	case "mode":
+		return fmt.Sprintf("mode %s→%s", c.OldMode, c.NewMode)
+	case "owner":
+		return fmt.Sprintf("owner %s→%s", c.OldOwner, c.NewOwner)
+	case "target":
+		return fmt.Sprintf("target %s→%s", c.OldLinkTarget, c.NewLinkTarget)
+	case "size":
+		return fmt.Sprintf("size %d→%d", derefSize(c.OldSize), derefSize(c.NewSize))
+	case "device":
+		return fmt.Sprintf("device %s→%s", c.OldDevice, c.NewDevice)
+	case "nlink":
+		return fmt.Sprintf("links %d→%d", c.OldNlink, c.NewNlink)
+	case "link_group":
+		return fmt.Sprintf("link group %s→%s", orNone(c.OldLinkGroup), orNone(c.NewLinkGroup))
+	case "xattr":
+		return fmt.Sprintf("xattrs %s→%s", shortDigest(c.OldXattr), shortDigest(c.NewXattr))
+	default:
+		return c.Reason
+	}
+}
+
+// RuleDetail describes the change rule applying to the change, or returns an
+// empty string when no rule applies
+func (c Change) RuleDetail() string {
+	if c.Rule == "" {
+		return ""
+	}
+	if c.ForbiddenBy != "" {
+		return fmt.Sprintf("rule %s forbids %s", c.Rule, c.ForbiddenBy)
+	}
+	return "rule " + c.Rule
+}
+
+// String formats the change as "kind: path (detail) [rule]"
+func (c Change) String() string {
+	label := strings.ReplaceAll(string(c.Kind), "_", " ")
+	s := fmt.Sprintf("%s: %s", label, c.Path)
+	if detail := c.Detail(); detail != "" {
+		s += fmt.Sprintf(" (%s)", detail)
+	}
+	if rule := c.RuleDetail(); rule != "" {
+		s += fmt.Sprintf(" [%s]", rule)
+	}
+	return s
+}
+
+// VerificationReport is the structured result of a verification run.
+// Warnings are reported but do not fail the verification.
+type VerificationReport struct {
+	TotalFiles    int      `json:"total_files"`
+	VerifiedFiles int      `json:"verified_files"`
+	Changes       []Change `json:"changes,omitempty"`
+	Warnings      []Change `json:"warnings,omitempty"`
+
+	// DifferingSubtree is the deepest directory holding every difference
+	// found with the hash tree of the manifest; empty when they are spread
+	// over the whole tree or the manifest has no hash tree
+	DifferingSubtree string `json:"differing_subtree,omitempty"`
+}
+
+// setDifferingSubtree records the subtree located with the hash tree when
+// every change lies below it; changes the tree does not cover, such as an
+// owner or a hard link, may lie elsewhere
+func (r *VerificationReport) setDifferingSubtree(p string) {
+	if p == "" || p == "." {
+		return
+	}
+	for _, c := range r.Changes {
+		if c.Path != p && !strings.HasPrefix(c.Path, p+"/") {
+			return
+		}
+	}
+	r.DifferingSubtree = p
+}
+
+// OK reports whether no changes were found
+func (r *VerificationReport) OK() bool {
+	return len(r.Changes) == 0
+}
+
+// ChangesOf returns the changes of the given kind in path order
+func (r *VerificationReport) ChangesOf(kind ChangeKind) []Change {
+	var changes []Change
+	for _, c := range r.Changes {
+		if c.Kind == kind {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Err returns an error wrapping ErrIntegrityCheckFailed that lists every change,
+// or nil when the report is clean
+func (r *VerificationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+
+	lines := make([]string, 0, len(r.Changes))
+	for _, c := range r.Changes {
+		lines = append(lines, c.String())
+	}
+	return fmt.Errorf("%w:\n%s", ErrIntegrityCheckFailed, strings.Join(lines, "\n"))
+}
+
+// sortChanges orders changes by path, then kind, for deterministic output
+func (r *VerificationReport) sortChanges() {
+	for _, changes := range [][]Change{r.Changes, r.Warnings} {
+		sort.SliceStable(changes, func(i, j int) bool {
+			if changes[i].Path != changes[j].Path {
+				return changes[i].Path < changes[j].Path
+			}
+			if changes[i].Kind != changes[j].Kind {
+				return changes[i].Kind < changes[j].Kind
+			}
+			return changes[i].Reason < changes[j].Reason
+		})
+	}
+}
+
+// compareMetadata returns mode and ownership changes between two entries.
+// Fields missing from the expected entry (older manifests) are not compared.
+func compareMetadata(expected, actual hash.FileInfo) []Change {
+	var changes []Change
+
+	if expected.Mode != "" && expected.Mode != actual.Mode {
+		changes = append(changes, Change{
+			Path:    expected.Path,
+			Kind:    ChangeMetadata,
+			Reason:  "mode",
+			OldType: EntryType(expected),
+			NewType: EntryType(actual),
+			OldMode: expected.Mode,
+			NewMode: actual.Mode,
+		})
+	}
+
+	if oldOwner, newOwner := formatOwner(expected), formatOwner(actual); oldOwner != "" && oldOwner != newOwner {
+		changes = append(changes, Change{
+			Path:     expected.Path,
+			Kind:     ChangeMetadata,
+			Reason:   "owner",
+			OldType:  EntryType(expected),
+			NewType:  EntryType(actual),
+			OldOwner: oldOwner,
+			NewOwner: newOwner,
+		})
+	}
+
+	return changes
+}
+
+// compareLinks returns hard-link changes between two regular files: a link
+// count that grew (the file was linked elsewhere) or a different link group.
+// Entries without a recorded link count (older manifests) are not compared.
+func compareLinks(expected, actual hash.FileInfo) []Change {
+	if expected.Nlink == 0 {
+		return nil
+	}
+
+	var changes []Change
+	base := Change{
+		Path:    expected.Path,
+		Kind:    ChangeLink,
+		OldType: EntryType(expected),
+		NewType: EntryType(actual),
+	}
+
+	if actual.Nlink > expected.Nlink {
+		change := base
+		change.Reason = "nlink"
+		change.OldNlink = expected.Nlink
+		change.NewNlink = actual.Nlink
+		changes = append(changes, change)
+	}
+
+	if expected.LinkGroup != actual.LinkGroup {
+		change := base
+		change.Reason = "link_group"
+		change.OldLinkGroup = expected.LinkGroup
+		change.NewLinkGroup = actual.LinkGroup
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// xattrChange describes a change of the extended attribute digest
+func xattrChange(expected, actual hash.FileInfo) Change {
+	return Change{
+		Path:     expected.Path,
+		Kind:     ChangeXattr,
+		Reason:   "xattr",
+		OldType:  EntryType(expected),
+		NewType:  EntryType(actual),
+		OldXattr: expected.XattrDigest,
+		NewXattr: actual.XattrDigest,
+	}
+}
+
+// orNone returns s, or "none" when it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// shortDigest abbreviates a digest for display, using "none" for no attributes
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "none"
+	}
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// formatOwner returns "uid:gid", or an empty string when ownership was not recorded
+func formatOwner(f hash.FileInfo) string {
+	if f.UID == nil || f.GID == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", *f.UID, *f.GID)
+}
+
+// compareEntry returns the content change between an expected and an actual entry, if any
+func compareEntry(expected, actual hash.FileInfo) (Change, bool) {
+	change := Change{
+		Path:          expected.Path,
+		OldType:       EntryType(expected),
+		NewType:       EntryType(actual),
+		OldHash:       expected.Hash,
+		NewHash:       actual.Hash,
+		OldSize:       &expected.Size,
+		NewSize:       &actual.Size,
+		OldLinkTarget: expected.LinkTarget,
+		NewLinkTarget: actual.LinkTarget,
+	}
+
+	// Check file type (symlink vs regular file)
+	if change.OldType != change.NewType {
+		change.Kind = ChangeTypeChanged
+		return change, true
+	}
+
+	change.Kind = ChangeModified
+
+	// Check content hash
+	if expected.Hash != actual.Hash {
+		change.Reason = "hash"
+		if expected.IsSymlink && expected.LinkTarget != actual.LinkTarget {
+			change.Reason = "target"
+		}
+		return change, true
+	}
+
+	// Check size (for both symlinks and regular files for consistency with totalHash)
+	if expected.Size != actual.Size {
+		change.Reason = "size"
+		return change, true
+	}
+
+	// Check device numbers (a disk node swapped for /dev/mem keeps type and size)
+	if oldDevice, newDevice := formatDevice(expected), formatDevice(actual); oldDevice != newDevice {
+		change.Reason = "device"
+		change.OldDevice = oldDevice
+		change.NewDevice = newDevice
+		return change, true
+	}
+
+	return Change{}, false
+}
+
+// deletedChange describes an entry that exists only in the manifest
+func deletedChange(expected hash.FileInfo) Change {
+	return Change{
+		Path:          expected.Path,
+		Kind:          ChangeDeleted,
+		OldType:       EntryType(expected),
+		OldHash:       expected.Hash,
+		OldSize:       &expected.Size,
+		OldLinkTarget: expected.LinkTarget,
+	}
+}
+
+// addedChange describes an entry that exists only in the current state
+func addedChange(actual hash.FileInfo) Change {
+	return Change{
+		Path:          actual.Path,
+		Kind:          ChangeAdded,
+		NewType:       EntryType(actual),
+		NewHash:       actual.Hash,
+		NewSize:       &actual.Size,
+		NewLinkTarget: actual.LinkTarget,
+	}
+}
+
+// formatDevice returns "major:minor" for device nodes, or an empty string
+func formatDevice(f hash.FileInfo) string {
+	if f.Type != "char" && f.Type != "block" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", f.DevMajor, f.DevMinor)
+}
+
+// EntryType returns the type name of an entry: file, dir, symlink, fifo, socket, char or block
+func EntryType(f hash.FileInfo) string {
+	switch {
+	case f.Type != "":
+		return f.Type
+	case f.IsSymlink:
+		return "symlink"
+	case f.IsDir:
+		return "dir"
+	default:
+		return "file"
+	}
+}
+
+func derefSize(size *int64) int64 {
+	if size == nil {
+		return 0
+	}
+	return *size
+}
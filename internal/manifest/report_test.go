@@ -0,0 +1,424 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+func TestVerificationReport(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"app.php":    "<?php echo 'app';",
+		"config.php": "<?php return [];",
+		"remove.php": "<?php // removed later",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("config.php", filepath.Join(tempDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("app.php", filepath.Join(tempDir, "entry")); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !report.OK() || report.VerifiedFiles != manifest.FileCount || report.TotalFiles != manifest.FileCount {
+		t.Fatalf("unexpected clean report: %+v", report)
+	}
+
+	// Apply one change of each kind
+	if err := os.WriteFile(filepath.Join(tempDir, "app.php"), []byte("<?php system($_GET['c']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "remove.php")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "shell.php"), []byte("<?php eval($_POST['x']);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/tmp/evil.php", filepath.Join(tempDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "entry")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "entry"), []byte("symlink:app.php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if report == nil {
+		t.Fatal("Verify() should return a report on integrity failure")
+	}
+
+	byPath := make(map[string]Change)
+	for _, c := range report.Changes {
+		byPath[c.Path] = c
+	}
+	if len(byPath) != 5 {
+		t.Fatalf("expected 5 changes, got %d: %+v", len(report.Changes), report.Changes)
+	}
+
+	if c := byPath["app.php"]; c.Kind != ChangeModified || c.Reason != "hash" || c.OldHash == c.NewHash || c.OldHash == "" {
+		t.Errorf("app.php change = %+v", c)
+	}
+	if c := byPath["app.php"]; c.OldSize == nil || c.NewSize == nil || *c.OldSize == *c.NewSize {
+		t.Errorf("app.php sizes should be recorded, got %+v", c)
+	}
+	if c := byPath["remove.php"]; c.Kind != ChangeDeleted || c.OldHash == "" || c.NewHash != "" || c.NewSize != nil {
+		t.Errorf("remove.php change = %+v", c)
+	}
+	if c := byPath["shell.php"]; c.Kind != ChangeAdded || c.NewHash == "" || c.OldHash != "" || c.OldSize != nil {
+		t.Errorf("shell.php change = %+v", c)
+	}
+	if c := byPath["current"]; c.Kind != ChangeModified || c.Reason != "target" || c.OldLinkTarget != "config.php" || c.NewLinkTarget != "/tmp/evil.php" {
+		t.Errorf("current change = %+v", c)
+	}
+	if c := byPath["entry"]; c.Kind != ChangeTypeChanged || c.OldType != "symlink" || c.NewType != "file" {
+		t.Errorf("entry change = %+v", c)
+	}
+
+	// Changes are ordered by path
+	for i := 1; i < len(report.Changes); i++ {
+		if report.Changes[i-1].Path > report.Changes[i].Path {
+			t.Errorf("changes are not sorted: %s before %s", report.Changes[i-1].Path, report.Changes[i].Path)
+		}
+	}
+
+	if report.VerifiedFiles != manifest.FileCount-4 {
+		t.Errorf("VerifiedFiles = %d, want %d", report.VerifiedFiles, manifest.FileCount-4)
+	}
+
+	if !strings.Contains(err.Error(), "target config.php→/tmp/evil.php") {
+		t.Errorf("error should describe the symlink target change, got: %v", err)
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	oldSize, newSize := int64(8), int64(999)
+
+	tests := []struct {
+		change Change
+		want   string
+	}{
+		{Change{Path: "a.txt", Kind: ChangeModified, Reason: "hash"}, "modified: a.txt (hash)"},
+		{Change{Path: "a.txt", Kind: ChangeModified, Reason: "size", OldSize: &oldSize, NewSize: &newSize}, "modified: a.txt (size 8→999)"},
+		{Change{Path: "link", Kind: ChangeTypeChanged, OldType: "symlink", NewType: "file"}, "type changed: link (symlink→file)"},
+		{Change{Path: "new.txt", Kind: ChangeAdded, NewType: "file"}, "added: new.txt (file)"},
+		{Change{Path: "old.txt", Kind: ChangeDeleted, OldType: "symlink"}, "deleted: old.txt (symlink)"},
+		{Change{Path: "uploads/x.php", Kind: ChangeAdded, NewType: "file", Rule: "uploads/**", ForbiddenBy: "*.php"}, "added: uploads/x.php (file) [rule uploads/** forbids *.php]"},
+		{Change{Path: "config/a.ini", Kind: ChangeModified, Reason: "hash", Rule: "config/*"}, "modified: config/a.ini (hash) [rule config/*]"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.change.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestVerifyMetadataChanges(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"index.php", "upload.php"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("<?php // "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// Same content, but setuid and world-writable
+	if err := os.Chmod(filepath.Join(tempDir, "index.php"), 0755|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tempDir, "upload.php"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+
+	changes := report.ChangesOf(ChangeMetadata)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 metadata changes, got %+v", report.Changes)
+	}
+	if c := changes[0]; c.Path != "index.php" || c.Reason != "mode" || c.OldMode != "0644" || c.NewMode != "4755" {
+		t.Errorf("index.php change = %+v", c)
+	}
+	if !strings.Contains(err.Error(), "metadata changed: upload.php (mode 0644→0666)") {
+		t.Errorf("error should describe the mode change, got: %v", err)
+	}
+	if len(report.ChangesOf(ChangeModified)) != 0 {
+		t.Errorf("content should be unchanged, got %+v", report.Changes)
+	}
+
+	// Manifests without recorded metadata only compare content
+	legacy := *manifest
+	legacy.Files = make([]hash.FileInfo, len(manifest.Files))
+	for i, f := range manifest.Files {
+		f.Mode, f.UID, f.GID = "", nil, nil
+		legacy.Files[i] = f
+	}
+	if _, err := legacy.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Errorf("legacy manifest should verify, got: %v", err)
+	}
+}
+
+func TestVerifyOwnerAdvisory(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "index.php")
+	if err := os.WriteFile(path, []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+	if err := os.Chown(path, int(uid)+1, int(gid)+1); err != nil {
+		t.Skipf("cannot change owner: %v", err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	want := fmt.Sprintf("metadata changed: index.php (owner %d:%d→%d:%d)", uid, gid, uid+1, gid+1)
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("error should contain %q, got: %v", want, err)
+	}
+
+	manifest.SetVerifyOptions(VerifyOptions{OwnerAdvisory: true})
+	report, err = manifest.Verify(context.Background(), tempDir, 0)
+	if err != nil {
+		t.Fatalf("Verify() with owner advisory error = %v", err)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Reason != "owner" {
+		t.Errorf("Warnings = %+v, want one owner warning", report.Warnings)
+	}
+	if report.VerifiedFiles != 1 {
+		t.Errorf("VerifiedFiles = %d, want 1", report.VerifiedFiles)
+	}
+}
+
+func TestVerifyDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+
+	for _, dir := range []string{"public", "old", "storage/logs"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "public/index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, []string{"storage/**"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if manifest.FileCount != 1 {
+		t.Errorf("FileCount = %d, want 1", manifest.FileCount)
+	}
+
+	if _, err := manifest.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// Excluded directories may change freely
+	if err := os.Mkdir(filepath.Join(tempDir, "storage/cache"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manifest.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Fatalf("Verify() should ignore excluded directories, got: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(tempDir, "old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "backdoor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(tempDir, "public"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+
+	for _, want := range []string{
+		"added: backdoor (dir)",
+		"deleted: old (dir)",
+		"metadata changed: public (mode 0755→0777)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q, got: %v", want, err)
+		}
+	}
+	if len(report.Changes) != 3 {
+		t.Errorf("expected 3 changes, got %+v", report.Changes)
+	}
+	if report.VerifiedFiles != 1 || report.TotalFiles != 1 {
+		t.Errorf("file counts = %d/%d, want 1/1", report.VerifiedFiles, report.TotalFiles)
+	}
+
+	// Manifests without directory entries only compare files
+	legacy := *manifest
+	legacy.Directories = nil
+	if _, err := legacy.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Errorf("legacy manifest should verify, got: %v", err)
+	}
+}
+
+func TestVerifySpecialFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "index.php"), []byte("<?php echo 'hello';"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if err := syscall.Mkfifo(filepath.Join(tempDir, "pipe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report, err := manifest.Verify(ctx, tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	added := report.ChangesOf(ChangeAdded)
+	if len(added) != 1 || added[0].Path != "pipe" || added[0].NewType != "fifo" {
+		t.Errorf("added = %+v, want pipe as fifo", added)
+	}
+	if !strings.Contains(err.Error(), "added: pipe (fifo)") {
+		t.Errorf("error should describe the fifo, got: %v", err)
+	}
+
+	// A file replaced with a FIFO is a type change
+	manifest, err = generator.Generate(ctx, tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "index.php")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(tempDir, "index.php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = manifest.Verify(ctx, tempDir, 0)
+	if err == nil || !strings.Contains(err.Error(), "type changed: index.php (file→fifo)") {
+		t.Errorf("error should describe the type change, got: %v", err)
+	}
+}
+
+func TestChangeDeviceDetail(t *testing.T) {
+	expected := hash.FileInfo{Path: "disk", Type: "block", DevMajor: 8, DevMinor: 0}
+	actual := hash.FileInfo{Path: "disk", Type: "block", DevMajor: 1, DevMinor: 1}
+
+	change, changed := compareEntry(expected, actual)
+	if !changed {
+		t.Fatal("device number change should be detected")
+	}
+	if got := change.String(); got != "modified: disk (device 8:0→1:1)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestVerifyHardLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"index.php", "config.php"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("<?php // "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(tempDir, "config.php"), filepath.Join(tempDir, "config.bak")); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if _, err := manifest.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// Linking a monitored file outside the tree leaves content untouched
+	if err := os.Link(filepath.Join(tempDir, "index.php"), filepath.Join(t.TempDir(), "index.php")); err != nil {
+		t.Fatal(err)
+	}
+	// Breaking a link group: config.bak becomes an independent copy
+	if err := os.Remove(filepath.Join(tempDir, "config.bak")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "config.bak"), []byte("<?php // config.php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+
+	for _, want := range []string{
+		"link changed: index.php (links 1→2)",
+		"link changed: config.bak (link group config.bak→none)",
+		"link changed: config.php (link group config.bak→none)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q, got: %v", want, err)
+		}
+	}
+	if len(report.ChangesOf(ChangeModified)) != 0 {
+		t.Errorf("content should be unchanged, got %+v", report.Changes)
+	}
+}
@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// Root is a named target directory of a manifest covering several
+// directories. The entries of a root are recorded under "Name/", and
+// include and exclude patterns are matched against these paths, so
+// "app/storage/**" only applies to the root named app.
+type Root struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // Directory the root was generated from
+}
+
+// rootNamePattern restricts root names to a single plain path segment
+var rootNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
+// ParseRoot parses a "NAME=PATH" target. ok is false when s is a plain
+// directory, so a path such as "/srv/a=b" is not mistaken for a root.
+func ParseRoot(s string) (root Root, ok bool) {
+	name, path, found := strings.Cut(s, "=")
+	if !found || !rootNamePattern.MatchString(name) || path == "" {
+		return Root{}, false
+	}
+	return Root{Name: name, Path: path}, true
+}
+
+// ValidateRoots checks that root names are valid and unique
+func ValidateRoots(roots []Root) error {
+	seen := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		if !rootNamePattern.MatchString(root.Name) {
+			return fmt.Errorf("invalid root name %q", root.Name)
+		}
+		if root.Path == "" {
+			return fmt.Errorf("root %s has no path", root.Name)
+		}
+		if seen[root.Name] {
+			return fmt.Errorf("duplicate root name %q", root.Name)
+		}
+		seen[root.Name] = true
+	}
+	return nil
+}
+
+// RootNames returns the names of the roots, or nil for a single-root manifest
+func (m *Manifest) RootNames() []string {
+	var names []string
+	for _, root := range m.Roots {
+		names = append(names, root.Name)
+	}
+	return names
+}
+
+// calculateRoots hashes every root and merges the entries under their names
+func calculateRoots(ctx context.Context, calculator *hash.Calculator, roots []Root, filter hash.Filter) (*hash.Result, error) {
+	merged := &hash.Result{}
+	for _, root := range roots {
+		rootFilter := filter
+		rootFilter.Root = root.Name
+
+		result, err := calculator.CalculateDirectoryWithFilter(ctx, root.Path, rootFilter)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %w", root.Name, err)
+		}
+		merged.Files = append(merged.Files, prefixEntries(root.Name, result.Files)...)
+		merged.Directories = append(merged.Directories, prefixEntries(root.Name, result.Directories)...)
+	}
+
+	sort.Slice(merged.Files, func(i, j int) bool { return merged.Files[i].Path < merged.Files[j].Path })
+	sort.Slice(merged.Directories, func(i, j int) bool { return merged.Directories[i].Path < merged.Directories[j].Path })
+	merged.FileCount = len(merged.Files)
+	return merged, nil
+}
+
+// prefixEntries records entries of a root under its name
+func prefixEntries(name string, entries []hash.FileInfo) []hash.FileInfo {
+	for i := range entries {
+		entries[i].Path = rootPath(name, entries[i].Path)
+		if entries[i].LinkGroup != "" {
+			entries[i].LinkGroup = rootPath(name, entries[i].LinkGroup)
+		}
+	}
+	return entries
+}
+
+// rootPath returns the manifest path of relPath below the root name
+func rootPath(name, relPath string) string {
+	if relPath == "." {
+		return name
+	}
+	return name + "/" + relPath
+}
+
+// verifyRoots returns the roots to verify, with the directories given in
+// overrides (keyed by root name) replacing the recorded ones
+func (m *Manifest) verifyRoots(overrides map[string]string) ([]Root, error) {
+	roots := make([]Root, len(m.Roots))
+	copy(roots, m.Roots)
+
+	known := make(map[string]bool, len(roots))
+	for i, root := range roots {
+		known[root.Name] = true
+		if path, ok := overrides[root.Name]; ok {
+			roots[i].Path = path
+		}
+	}
+	for name := range overrides {
+		if !known[name] {
+			return nil, fmt.Errorf("manifest has no root named %q (roots: %s)", name, strings.Join(m.RootNames(), ", "))
+		}
+	}
+	return roots, nil
+}
@@ -0,0 +1,113 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		arg    string
+		want   Root
+		wantOK bool
+	}{
+		{"app=/var/www/app", Root{Name: "app", Path: "/var/www/app"}, true},
+		{"nginx-sites=/etc/nginx/sites-enabled", Root{Name: "nginx-sites", Path: "/etc/nginx/sites-enabled"}, true},
+		{"/var/www/app", Root{}, false},
+		{"/srv/a=b", Root{}, false},
+		{"app=", Root{}, false},
+		{"../x=/tmp", Root{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseRoot(tt.arg)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("ParseRoot(%q) = %+v, %v, want %+v, %v", tt.arg, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if err := ValidateRoots([]Root{{Name: "app", Path: "/a"}, {Name: "app", Path: "/b"}}); err == nil {
+		t.Error("ValidateRoots() should reject duplicate names")
+	}
+}
+
+func TestGenerateRoots(t *testing.T) {
+	base := t.TempDir()
+	files := map[string]string{
+		"www/index.php":          "<?php // front",
+		"www/storage/cache.php":  "<?php // compiled",
+		"nginx/app.conf":         "server {}",
+		"nginx/storage/keep.txt": "not excluded in this root",
+	}
+	for name, content := range files {
+		path := filepath.Join(base, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	roots := []Root{
+		{Name: "app", Path: filepath.Join(base, "www")},
+		{Name: "nginx", Path: filepath.Join(base, "nginx")},
+	}
+	m, err := NewGenerator(0).GenerateRoots(context.Background(), roots, []string{"app/storage/**"})
+	if err != nil {
+		t.Fatalf("GenerateRoots() error = %v", err)
+	}
+
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	want := []string{"app/index.php", "nginx/app.conf", "nginx/storage/keep.txt"}
+	if len(paths) != len(want) {
+		t.Fatalf("Files = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("Files[%d] = %s, want %s", i, paths[i], want[i])
+		}
+	}
+
+	// One run checks every root and reports with root-prefixed paths
+	if err := os.WriteFile(filepath.Join(base, "nginx/app.conf"), []byte("server { root /tmp; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Verify(context.Background(), "ignored", 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if len(report.Changes) != 1 || report.Changes[0].Path != "nginx/app.conf" {
+		t.Errorf("Changes = %v, want nginx/app.conf modified", report.Changes)
+	}
+
+	// A root can be verified from another directory
+	moved := filepath.Join(t.TempDir(), "nginx")
+	if err := os.MkdirAll(filepath.Join(moved, "storage"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app.conf", "storage/keep.txt"} {
+		if err := os.WriteFile(filepath.Join(moved, name), []byte(files["nginx/"+name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.SetVerifyOptions(VerifyOptions{RootPaths: map[string]string{"nginx": moved}})
+	if _, err := m.Verify(context.Background(), "ignored", 0); err != nil {
+		t.Errorf("Verify() with moved root error = %v", err)
+	}
+
+	m.SetVerifyOptions(VerifyOptions{RootPaths: map[string]string{"db": moved}})
+	if _, err := m.Verify(context.Background(), "ignored", 0); err == nil {
+		t.Error("Verify() should reject an unknown root")
+	}
+
+	if _, err := m.VerifyWithCache(context.Background(), "ignored", t.TempDir(), "test", "app", 0, 0.1, false); err == nil {
+		t.Error("VerifyWithCache() should reject a manifest with roots")
+	}
+}
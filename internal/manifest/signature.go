@@ -0,0 +1,313 @@
+package manifest
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// SignatureAlgorithm is the only signature scheme currently produced and accepted.
+// Ed25519ph signs a SHA-512 digest, so the canonical form can be hashed as a stream.
+const SignatureAlgorithm = "ed25519ph"
+
+var (
+	// ErrUnsigned is returned when a signature is required but the manifest has none
+	ErrUnsigned = errors.New("manifest is not signed")
+	// ErrInvalidSignature is returned when no trusted key validates the signature
+	ErrInvalidSignature = errors.New("manifest signature is invalid")
+)
+
+// Signature holds an embedded signature over the canonical manifest serialization
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	Value     string `json:"value"`
+}
+
+// KeyID returns a short identifier for a public key (first 8 bytes of its SHA-256)
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign computes the signature of the manifest and embeds it
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	digest, err := m.canonicalDigest()
+	if err != nil {
+		return err
+	}
+
+	sig, err := key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+
+	m.Signature = &Signature{
+		Algorithm: SignatureAlgorithm,
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Value:     base64.StdEncoding.EncodeToString(sig),
+	}
+	return nil
+}
+
+// VerifySignature checks the embedded signature against the trusted keys.
+// It succeeds if any of the keys validates the signature.
+func (m *Manifest) VerifySignature(trusted ...ed25519.PublicKey) error {
+	return verifySignature(m.Signature, m.canonicalDigest, trusted)
+}
+
+// verifySignature checks a signature against the trusted keys, computing the
+// canonical digest only once the signature itself is well-formed
+func verifySignature(signature *Signature, canonicalDigest func() ([]byte, error), trusted []ed25519.PublicKey) error {
+	if signature == nil {
+		return ErrUnsigned
+	}
+	if signature.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, signature.Algorithm)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature.Value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	digest, err := canonicalDigest()
+	if err != nil {
+		return err
+	}
+
+	opts := &ed25519.Options{Hash: crypto.SHA512}
+	for _, pub := range trusted {
+		if ed25519.VerifyWithOptions(pub, digest, sig, opts) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w (key id %s)", ErrInvalidSignature, signature.KeyID)
+}
+
+// canonicalDigest returns the SHA-512 digest of the canonical serialization
+func (m *Manifest) canonicalDigest() ([]byte, error) {
+	hasher := sha512.New()
+	if err := writeCanonical(hasher, m); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// writeCanonical writes the serialization covered by the signature.
+// The first line is the compact JSON of the manifest without its entries and
+// signature, followed by one compact JSON line per file entry. The on-disk
+// formatting (indentation, key spacing) therefore never affects the signature.
+func writeCanonical(w io.Writer, m *Manifest) error {
+	return writeCanonicalEntries(w, m, &sliceSource{entries: m.Directories}, &sliceSource{entries: m.Files})
+}
+
+// writeCanonicalEntries writes the canonical serialization of the header of
+// m with the entries read from the sources. The directories are part of the
+// header line; they are written one at a time as json.Marshal would write them.
+func writeCanonicalEntries(w io.Writer, m *Manifest, directories, files entrySource) error {
+	bw := bufio.NewWriter(w)
+
+	header := *m
+	header.Signature = nil
+	header.Files = nil
+	header.Directories = nil
+
+	data, err := json.Marshal(&header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest header: %w", err)
+	}
+
+	n := 0
+	for ; ; n++ {
+		d, ok, err := directories.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if n == 0 {
+			// Reopen the header object, which ends with "files"
+			bw.Write(data[:len(data)-1])
+			bw.WriteString(`,"directories":[`)
+		} else {
+			bw.WriteByte(',')
+		}
+		if err := writeEntry(bw, d); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		bw.WriteString("]}")
+	} else {
+		bw.Write(data)
+	}
+	bw.WriteByte('\n')
+
+	for {
+		f, ok, err := files.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := writeEntry(bw, f); err != nil {
+			return err
+		}
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
+
+// writeEntry writes the compact JSON of an entry
+func writeEntry(w *bufio.Writer, f hash.FileInfo) error {
+	data, err := json.Marshal(&f)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry %s: %w", f.Path, err)
+	}
+	w.Write(data)
+	return nil
+}
+
+// GenerateKeyPair creates a new Ed25519 key pair for manifest signing
+func GenerateKeyPair() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return pub, priv, nil
+}
+
+// SaveKeyPair writes both keys of a pair. Nothing is written when either file
+// already exists, and the private key is removed again when the public key
+// cannot be written, so no private key is left without its public key.
+func SaveKeyPair(pub ed25519.PublicKey, priv ed25519.PrivateKey, privateFile, publicFile string) error {
+	if privateFile == publicFile {
+		return fmt.Errorf("private and public key files must differ: %s", privateFile)
+	}
+	for _, filename := range []string{privateFile, publicFile} {
+		if _, err := os.Lstat(filename); err == nil {
+			return fmt.Errorf("failed to create key file: %s already exists", filename)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to check key file: %w", err)
+		}
+	}
+
+	if err := SavePrivateKey(priv, privateFile); err != nil {
+		return err
+	}
+	if err := SavePublicKey(pub, publicFile); err != nil {
+		os.Remove(privateFile)
+		return err
+	}
+	return nil
+}
+
+// SavePrivateKey writes a PKCS#8 PEM encoded private key with 0600 permissions.
+// An existing file is never overwritten.
+func SavePrivateKey(key ed25519.PrivateKey, filename string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return writeNewPEM(filename, &pem.Block{Type: "PRIVATE KEY", Bytes: der}, 0600)
+}
+
+// SavePublicKey writes a PKIX PEM encoded public key.
+// An existing file is never overwritten.
+func SavePublicKey(key ed25519.PublicKey, filename string) error {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return writeNewPEM(filename, &pem.Block{Type: "PUBLIC KEY", Bytes: der}, 0644)
+}
+
+func writeNewPEM(filename string, block *pem.Block, perm os.FileMode) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+
+	if err := pem.Encode(f, block); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(filename)
+		return fmt.Errorf("failed to close key file: %w", err)
+	}
+	return nil
+}
+
+// LoadPrivateKey reads a PEM encoded Ed25519 private key
+func LoadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(filename, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an Ed25519 key", filename)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey reads a PEM encoded Ed25519 public key
+func LoadPublicKey(filename string) (ed25519.PublicKey, error) {
+	der, err := readPEM(filename, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an Ed25519 key", filename)
+	}
+	return pub, nil
+}
+
+func readPEM(filename, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM %s block", filename, blockType)
+	}
+	return block.Bytes, nil
+}
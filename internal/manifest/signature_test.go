@@ -0,0 +1,176 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerifySignature(t *testing.T) {
+	tempDir := createTestDirectory(t)
+
+	generator := NewGenerator(0)
+	manifest, err := generator.Generate(context.Background(), tempDir, []string{"*.log"})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	otherPub, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	t.Run("unsigned manifest", func(t *testing.T) {
+		err := manifest.VerifySignature(pub)
+		if !errors.Is(err, ErrUnsigned) {
+			t.Errorf("VerifySignature() error = %v, want ErrUnsigned", err)
+		}
+	})
+
+	if err := manifest.Sign(priv); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	t.Run("valid signature", func(t *testing.T) {
+		if err := manifest.VerifySignature(pub); err != nil {
+			t.Errorf("VerifySignature() error = %v", err)
+		}
+		if manifest.Signature.KeyID != KeyID(pub) {
+			t.Errorf("KeyID = %s, want %s", manifest.Signature.KeyID, KeyID(pub))
+		}
+	})
+
+	t.Run("any trusted key is accepted", func(t *testing.T) {
+		if err := manifest.VerifySignature(otherPub, pub); err != nil {
+			t.Errorf("VerifySignature() error = %v", err)
+		}
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		err := manifest.VerifySignature(otherPub)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("VerifySignature() error = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("signature survives save and load", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := SaveToWriter(manifest, &buf); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadFromReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.VerifySignature(pub); err != nil {
+			t.Errorf("VerifySignature() after round trip error = %v", err)
+		}
+	})
+
+	tamperTests := []struct {
+		name   string
+		tamper func(m *Manifest)
+	}{
+		{
+			name:   "modified hash",
+			tamper: func(m *Manifest) { m.Files[0].Hash = "0000" },
+		},
+		{
+			name:   "removed entry",
+			tamper: func(m *Manifest) { m.Files = m.Files[1:] },
+		},
+		{
+			name:   "added exclude",
+			tamper: func(m *Manifest) { m.Excludes = append(m.Excludes, "**") },
+		},
+		{
+			name:   "changed timestamp",
+			tamper: func(m *Manifest) { m.GeneratedAt = "2000-01-01T00:00:00Z" },
+		},
+	}
+
+	for _, tt := range tamperTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *manifest
+			tampered.Files = append(tampered.Files[:0:0], manifest.Files...)
+			tampered.Excludes = append(tampered.Excludes[:0:0], manifest.Excludes...)
+			tt.tamper(&tampered)
+
+			err := tampered.VerifySignature(pub)
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("VerifySignature() error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "kekkai.key")
+	pubPath := filepath.Join(dir, "kekkai.pub")
+
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SavePrivateKey(priv, privPath); err != nil {
+		t.Fatalf("SavePrivateKey() error = %v", err)
+	}
+	if err := SavePublicKey(pub, pubPath); err != nil {
+		t.Fatalf("SavePublicKey() error = %v", err)
+	}
+
+	info, err := os.Stat(privPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("private key permissions = %o, want 600", info.Mode().Perm())
+	}
+
+	// Existing files are never overwritten
+	if err := SavePrivateKey(priv, privPath); err == nil {
+		t.Error("SavePrivateKey() should refuse to overwrite an existing file")
+	}
+
+	// A pair is written completely or not at all
+	otherPriv := filepath.Join(dir, "other.key")
+	if err := SaveKeyPair(pub, priv, otherPriv, pubPath); err == nil {
+		t.Error("SaveKeyPair() should refuse an existing public key")
+	}
+	if err := SaveKeyPair(pub, priv, otherPriv, filepath.Join(dir, "missing", "other.pub")); err == nil {
+		t.Error("SaveKeyPair() should fail when the public key cannot be written")
+	}
+	if _, err := os.Stat(otherPriv); !os.IsNotExist(err) {
+		t.Errorf("SaveKeyPair() left a private key without its public key: %v", err)
+	}
+
+	loadedPriv, err := LoadPrivateKey(privPath)
+	if err != nil {
+		t.Fatalf("LoadPrivateKey() error = %v", err)
+	}
+	loadedPub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("LoadPublicKey() error = %v", err)
+	}
+
+	if !loadedPriv.Equal(priv) {
+		t.Error("loaded private key does not match")
+	}
+	if !loadedPub.Equal(pub) {
+		t.Error("loaded public key does not match")
+	}
+
+	// A public key is not accepted where a private key is expected
+	if _, err := LoadPrivateKey(pubPath); err == nil {
+		t.Error("LoadPrivateKey() should fail for a public key file")
+	}
+}
@@ -0,0 +1,592 @@
+package manifest
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+)
+
+// ManifestFile is a manifest file, in either format and compressed or not, opened for streaming.
+// Only the header, every field except the entries, is held in memory; the
+// files and directories are decoded one at a time as they are used.
+type ManifestFile struct {
+	header      *Manifest
+	file        *os.File
+	format      Format
+	files       int64 // Offset of the files array, or -1 when the manifest has none
+	directories int64 // Offset of the directories array, or -1
+}
+
+// OpenManifestFile opens a manifest file for streaming
+func OpenManifestFile(filename string) (*ManifestFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file: %w", err)
+	}
+
+	// Entries are read from offsets, so a compressed manifest is unpacked first
+	decompressed, err := decompressFile(file)
+	if decompressed != file {
+		file.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newManifestFile(decompressed)
+}
+
+// SnapshotManifestFile is OpenManifestFile reading a private copy of the file.
+// Checking the signature and streaming the entries read the manifest twice;
+// the copy keeps both on the same bytes even if the file is rewritten in
+// between.
+func SnapshotManifestFile(filename string) (*ManifestFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file: %w", err)
+	}
+	defer file.Close()
+
+	r, err := decompressReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifest: %w", err)
+	}
+	defer r.Close()
+
+	snapshot, err := privateCopy(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy manifest file: %w", err)
+	}
+	return newManifestFile(snapshot)
+}
+
+// newManifestFile scans an uncompressed manifest file, closing it on failure
+func newManifestFile(file *os.File) (*ManifestFile, error) {
+	f := &ManifestFile{file: file, files: -1, directories: -1}
+	if err := f.scan(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return f, nil
+}
+
+// Close closes the manifest file
+func (f *ManifestFile) Close() error {
+	return f.file.Close()
+}
+
+// Header returns the manifest without its entries, for the recorded settings
+// and verify options. Verify the tree with the methods of ManifestFile.
+func (f *ManifestFile) Header() *Manifest {
+	return f.header
+}
+
+// Format returns the format of the manifest file
+func (f *ManifestFile) Format() Format {
+	return f.format
+}
+
+// Files returns the file entries in the order they are stored
+func (f *ManifestFile) Files() iter.Seq2[hash.FileInfo, error] {
+	return f.iterate(f.files, false)
+}
+
+// Directories returns the directory entries in the order they are stored
+func (f *ManifestFile) Directories() iter.Seq2[hash.FileInfo, error] {
+	return f.iterate(f.directories, true)
+}
+
+// iterate yields the entries read from offset, stopping after the first error
+func (f *ManifestFile) iterate(offset int64, dirs bool) iter.Seq2[hash.FileInfo, error] {
+	return func(yield func(hash.FileInfo, error) bool) {
+		src, err := f.entries(offset, dirs)
+		if err != nil {
+			yield(hash.FileInfo{}, err)
+			return
+		}
+		for {
+			entry, ok, err := src.next()
+			if err != nil {
+				yield(hash.FileInfo{}, err)
+				return
+			}
+			if !ok || !yield(entry, nil) {
+				return
+			}
+		}
+	}
+}
+
+// scan decodes the header and records where the entries start
+func (f *ManifestFile) scan() error {
+	br := bufio.NewReader(f.file)
+	f.format = detectFormat(br)
+	dec := json.NewDecoder(br)
+
+	if f.format == FormatNDJSON {
+		header, err := decodeNDJSONHeader(dec)
+		if err != nil {
+			return err
+		}
+		header.Files = nil
+		header.Directories = nil
+		f.header = header
+
+		// Both kinds of entries follow the header line
+		f.files = dec.InputOffset()
+		f.directories = f.files
+		return nil
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("manifest is not a JSON object")
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+
+		// encoding/json matches field names case-insensitively
+		switch {
+		case strings.EqualFold(key, "files"):
+			if f.files, err = skipEntries(dec); err != nil {
+				return err
+			}
+		case strings.EqualFold(key, "directories"):
+			if f.directories, err = skipEntries(dec); err != nil {
+				return err
+			}
+		default:
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			fields[key] = raw
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	var header Manifest
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	f.header = &header
+	return nil
+}
+
+// skipEntries skips an array of entries and returns the offset of its "[",
+// or -1 for null
+func skipEntries(dec *json.Decoder) (int64, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		return -1, nil
+	}
+	if tok != json.Delim('[') {
+		return 0, fmt.Errorf("manifest entries are not an array")
+	}
+
+	offset := dec.InputOffset() - 1
+	for dec.More() {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// entries returns a source decoding the directories or files at offset: the
+// array of a JSON manifest, or the entry lines of an NDJSON manifest
+func (f *ManifestFile) entries(offset int64, dirs bool) (entrySource, error) {
+	if offset < 0 {
+		return &sliceSource{}, nil
+	}
+
+	dec := json.NewDecoder(io.NewSectionReader(f.file, offset, math.MaxInt64-offset))
+	if f.format == FormatNDJSON {
+		return &entryReader{dec: dec, lines: true, dirs: dirs}, nil
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &entryReader{dec: dec}, nil
+}
+
+// VerifySignature checks the embedded signature against the trusted keys,
+// reading the entries from the file. See Manifest.VerifySignature.
+func (f *ManifestFile) VerifySignature(trusted ...ed25519.PublicKey) error {
+	return verifySignature(f.header.Signature, f.canonicalDigest, trusted)
+}
+
+// canonicalDigest returns the SHA-512 digest of the canonical serialization
+func (f *ManifestFile) canonicalDigest() ([]byte, error) {
+	directories, err := f.entries(f.directories, true)
+	if err != nil {
+		return nil, err
+	}
+	files, err := f.entries(f.files, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha512.New()
+	if err := writeCanonicalEntries(hasher, f.header, directories, files); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+// Verify checks the integrity of files like Manifest.Verify, walking the tree
+// in path order and comparing it with the entries as they are read, so memory
+// use does not grow with the number of files. The entries must be sorted by
+// path, as generate writes them.
+func (f *ManifestFile) Verify(ctx context.Context, targetDir string, numWorkers int) (*VerificationReport, error) {
+	calculator := hash.NewCalculator(numWorkers)
+	return f.verifyWithCalculator(ctx, targetDir, calculator)
+}
+
+// VerifyWithRateLimit is Verify with rate limiting
+func (f *ManifestFile) VerifyWithRateLimit(ctx context.Context, targetDir string, numWorkers int, bytesPerSec int64) (*VerificationReport, error) {
+	calculator := hash.NewCalculatorWithRateLimit(numWorkers, bytesPerSec)
+	return f.verifyWithCalculator(ctx, targetDir, calculator)
+}
+
+func (f *ManifestFile) verifyWithCalculator(ctx context.Context, targetDir string, calculator *hash.Calculator) (*VerificationReport, error) {
+	m := f.header
+	if err := m.setupCalculator(calculator); err != nil {
+		return nil, err
+	}
+
+	roots := []hash.StreamRoot{{Dir: targetDir}}
+	if len(m.Roots) > 0 {
+		verifyRoots, err := m.verifyRoots(m.verifyOptions.RootPaths)
+		if err != nil {
+			return nil, err
+		}
+		roots = roots[:0]
+		for _, root := range verifyRoots {
+			roots = append(roots, hash.StreamRoot{Name: root.Name, Dir: root.Path})
+		}
+	}
+
+	opts := m.verifyOptions
+	opts.compareXattrs = len(m.XattrNamespaces) > 0
+	opts.levels = m.Levels
+
+	join, err := f.newMergeJoin(opts)
+	if err != nil {
+		return nil, err
+	}
+	join.appendOnly = m.AppendOnly
+	join.walkedLinks = true
+	if m.Merkle != nil {
+		if join.tree, err = m.newMerkleBuilder(m.Merkle); err != nil {
+			return nil, err
+		}
+	}
+	if err := calculator.Stream(ctx, roots, m.filter(), join.add); err != nil {
+		if join.err != nil {
+			return nil, join.err
+		}
+		return nil, fmt.Errorf("failed to calculate current state: %w", err)
+	}
+
+	report, err := join.finish()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.AppendOnly) > 0 {
+		if err := m.checkAppendOnly(ctx, targetDir, opts.AppendState, report); err != nil {
+			return nil, err
+		}
+	}
+	report.applyChangeRules(m.ChangeRules)
+	if join.tree != nil && !report.OK() {
+		report.setDifferingSubtree(join.tree.finish().confined)
+	}
+	return report, report.Err()
+}
+
+// entrySource yields manifest entries one at a time
+type entrySource interface {
+	next() (hash.FileInfo, bool, error)
+}
+
+// sliceSource yields the entries of a slice
+type sliceSource struct {
+	entries []hash.FileInfo
+}
+
+func (s *sliceSource) next() (hash.FileInfo, bool, error) {
+	if len(s.entries) == 0 {
+		return hash.FileInfo{}, false, nil
+	}
+	f := s.entries[0]
+	s.entries = s.entries[1:]
+	return f, true, nil
+}
+
+// entryReader yields the entries of a JSON array being decoded, or the
+// entries of one kind from the lines of an NDJSON manifest
+type entryReader struct {
+	dec   *json.Decoder
+	lines bool // Entries are lines up to the end of the file
+	dirs  bool // Kind of the entries yielded from lines
+}
+
+func (r *entryReader) next() (hash.FileInfo, bool, error) {
+	for {
+		if !r.lines && !r.dec.More() {
+			return hash.FileInfo{}, false, nil
+		}
+
+		var f hash.FileInfo
+		if err := r.dec.Decode(&f); err != nil {
+			if r.lines && errors.Is(err, io.EOF) {
+				return hash.FileInfo{}, false, nil
+			}
+			return hash.FileInfo{}, false, fmt.Errorf("failed to decode manifest entry: %w", err)
+		}
+		if r.lines && f.IsDir != r.dirs {
+			continue
+		}
+		return f, true, nil
+	}
+}
+
+// sortedEntries reads the entries of a source ahead by one and checks their order
+type sortedEntries struct {
+	src   entrySource
+	name  string
+	head  *hash.FileInfo
+	last  string
+	count int
+}
+
+// peek returns the next entry without consuming it, or nil at the end
+func (s *sortedEntries) peek() (*hash.FileInfo, error) {
+	if s.head != nil {
+		return s.head, nil
+	}
+
+	f, ok, err := s.src.next()
+	if err != nil || !ok {
+		return nil, err
+	}
+	if s.count > 0 && f.Path <= s.last {
+		return nil, fmt.Errorf("manifest %s are not sorted by path (%q after %q); regenerate the manifest", s.name, f.Path, s.last)
+	}
+	s.head = &f
+	return s.head, nil
+}
+
+// pop consumes the entry returned by peek
+func (s *sortedEntries) pop() hash.FileInfo {
+	f := *s.head
+	s.head = nil
+	s.last = f.Path
+	s.count++
+	return f
+}
+
+// mergeJoin compares the entries walked in path order with the manifest
+// entries, which are in the same order, like compareWith does for slices
+type mergeJoin struct {
+	opts        VerifyOptions
+	appendOnly  []hash.AppendRule
+	files       *sortedEntries
+	directories *sortedEntries // Nil when the manifest records no directories
+	report      *VerificationReport
+	dirReport   *VerificationReport // Directory changes, kept only if the walk found directories
+	walkedDirs  bool
+	walkedLinks bool // The first member of a walked hard-link group carries its own path as group
+	pending     map[string]pendingLink
+	tree        *merkleBuilder // Hash tree of the walked entries, when the manifest has one
+	err         error          // Error reading the manifest
+}
+
+// pendingLink is the first member of a hard-link group, compared once it is
+// known whether other members of the group were walked. A group with links
+// outside the tree stays pending until the walk ends; hash.Stream bounds their
+// number.
+type pendingLink struct {
+	expected hash.FileInfo
+	actual   hash.FileInfo
+}
+
+func (f *ManifestFile) newMergeJoin(opts VerifyOptions) (*mergeJoin, error) {
+	files, err := f.entries(f.files, false)
+	if err != nil {
+		return nil, err
+	}
+	directories, err := f.entries(f.directories, true)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &mergeJoin{
+		opts:        opts,
+		files:       &sortedEntries{src: files, name: "files"},
+		directories: &sortedEntries{src: directories, name: "directories"},
+		report:      &VerificationReport{},
+		dirReport:   &VerificationReport{},
+		pending:     make(map[string]pendingLink),
+	}
+
+	// Manifests from older versions have no directory entries
+	if first, err := j.directories.peek(); err != nil {
+		return nil, err
+	} else if first == nil {
+		j.directories = nil
+	}
+	return j, nil
+}
+
+// add compares an entry walked from disk
+func (j *mergeJoin) add(actual hash.FileInfo) error {
+	var err error
+	switch {
+	case actual.IsDir:
+		if j.directories == nil {
+			return nil
+		}
+		j.walkedDirs = true
+		if j.tree != nil {
+			j.tree.add(actual)
+		}
+		err = j.merge(j.directories, j.dirReport, actual)
+	default:
+		if _, ok := hash.MatchAppendRule(j.appendOnly, actual.Path); ok {
+			return nil
+		}
+		if j.walkedLinks {
+			j.resolveLink(actual)
+		}
+		if j.tree != nil {
+			j.tree.add(actual)
+		}
+		err = j.merge(j.files, j.report, actual)
+	}
+
+	if err != nil {
+		j.err = err
+	}
+	return err
+}
+
+// merge reports the manifest entries sorting before actual as deleted, then
+// compares actual with its manifest entry or reports it as added
+func (j *mergeJoin) merge(entries *sortedEntries, r *VerificationReport, actual hash.FileInfo) error {
+	for {
+		next, err := entries.peek()
+		if err != nil {
+			return err
+		}
+		if next == nil || next.Path > actual.Path {
+			r.Changes = append(r.Changes, addedChange(actual))
+			return nil
+		}
+
+		expected := entries.pop()
+		if expected.Path < actual.Path {
+			r.Changes = append(r.Changes, deletedChange(expected))
+			continue
+		}
+
+		j.compare(r, expected, actual)
+		return nil
+	}
+}
+
+// compare compares an entry with its current state. The link group of the
+// first member of a hard-link group is its own path only if another member
+// follows, so its comparison waits for the next member or the end of the walk.
+func (j *mergeJoin) compare(r *VerificationReport, expected, actual hash.FileInfo) {
+	if j.walkedLinks && actual.LinkGroup != "" && actual.LinkGroup == actual.Path {
+		j.pending[actual.Path] = pendingLink{expected: expected, actual: actual}
+		return
+	}
+	j.compareNow(r, expected, actual)
+}
+
+// compareNow compares an entry with its current state and counts it when unchanged
+func (j *mergeJoin) compareNow(r *VerificationReport, expected, actual hash.FileInfo) {
+	if r.compareExisting(expected, actual, j.opts) {
+		r.VerifiedFiles++
+	}
+}
+
+// resolveLink compares the first member of the hard-link group of a later member
+func (j *mergeJoin) resolveLink(member hash.FileInfo) {
+	if member.LinkGroup == "" || member.LinkGroup == member.Path {
+		return
+	}
+	if first, ok := j.pending[member.LinkGroup]; ok {
+		delete(j.pending, member.LinkGroup)
+		j.compareNow(j.report, first.expected, first.actual)
+	}
+}
+
+// finish reports the remaining manifest entries as deleted and returns the report
+func (j *mergeJoin) finish() (*VerificationReport, error) {
+	for _, first := range j.pending {
+		// No other member of the group was walked
+		first.actual.LinkGroup = ""
+		j.compareNow(j.report, first.expected, first.actual)
+	}
+
+	if err := drain(j.files, j.report); err != nil {
+		return nil, err
+	}
+	j.report.TotalFiles = j.files.count
+
+	if j.directories != nil && j.walkedDirs {
+		if err := drain(j.directories, j.dirReport); err != nil {
+			return nil, err
+		}
+		j.report.Changes = append(j.report.Changes, j.dirReport.Changes...)
+		j.report.Warnings = append(j.report.Warnings, j.dirReport.Warnings...)
+	}
+
+	j.report.sortChanges()
+	return j.report, nil
+}
+
+// drain reports the entries left in the manifest as deleted
+func drain(entries *sortedEntries, r *VerificationReport) error {
+	for {
+		next, err := entries.peek()
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		r.Changes = append(r.Changes, deletedChange(entries.pop()))
+	}
+}
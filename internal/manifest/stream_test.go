@@ -0,0 +1,244 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamVerifyMatchesVerify(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		levels []LevelRule
+		change func(t *testing.T, dir string)
+	}{
+		{"unchanged", nil, func(t *testing.T, dir string) {}},
+		{"modified and added", nil, func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "a/b.txt"), "tampered")
+			writeTestFile(t, filepath.Join(dir, "a/new.php"), "<?php")
+			writeTestFile(t, filepath.Join(dir, "0.txt"), "first")
+		}},
+		{"deleted", nil, func(t *testing.T, dir string) {
+			if err := os.RemoveAll(filepath.Join(dir, "a/c")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(filepath.Join(dir, "z.txt")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"type and mode", nil, func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Mkdir(filepath.Join(dir, "a.txt"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filepath.Join(dir, "a-b"), 0777); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"hard links", nil, func(t *testing.T, dir string) {
+			// A new link to a single file, and a removed member of a group
+			if err := os.Link(filepath.Join(dir, "a.txt"), filepath.Join(dir, "a/a-link")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(filepath.Join(dir, "a/z-link")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"links outside the tree", nil, func(t *testing.T, dir string) {
+			outside := t.TempDir()
+			for _, name := range []string{"a/b.txt", "a.txt", "z.txt"} {
+				if err := os.Link(filepath.Join(dir, name), filepath.Join(outside, filepath.Base(name))); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}},
+		{"levels", []LevelRule{{Path: "a/**", Level: LevelExists}}, func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "a/b.txt"), "tampered")
+			writeTestFile(t, filepath.Join(dir, "z.txt"), "tampered")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"a/b.txt", "a/c/d.txt", "a.txt", "a-b/e.txt", "-x/f.txt", "z.txt"} {
+				writeTestFile(t, filepath.Join(dir, name), name)
+			}
+			if err := os.Link(filepath.Join(dir, "z.txt"), filepath.Join(dir, "a/z-link")); err != nil {
+				t.Fatal(err)
+			}
+
+			generator := NewGenerator(2)
+			generator.SetLevels(tt.levels)
+			m, err := generator.Generate(ctx, dir, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+			if err := SaveToFile(m, manifestPath); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(t, dir)
+
+			want, wantErr := m.Verify(ctx, dir, 2)
+			if want == nil {
+				t.Fatalf("Verify() error = %v", wantErr)
+			}
+
+			f, err := OpenManifestFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := f.Verify(ctx, dir, 2)
+			if got == nil {
+				t.Fatalf("stream Verify() error = %v", err)
+			}
+			if (err == nil) != (wantErr == nil) {
+				t.Errorf("stream Verify() error = %v, want %v", err, wantErr)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("stream Verify() report = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestStreamVerifyRoots(t *testing.T) {
+	ctx := context.Background()
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(base, "www/index.php"), "<?php")
+	writeTestFile(t, filepath.Join(base, "conf/site.conf"), "server {}")
+
+	roots := []Root{{Name: "www", Path: filepath.Join(base, "www")}, {Name: "conf", Path: filepath.Join(base, "conf")}}
+	m, err := NewGenerator(2).GenerateRoots(ctx, roots, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(base, "manifest.json")
+	if err := SaveToFile(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(base, "conf/site.conf"), "server { root /tmp; }")
+
+	f, err := OpenManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	report, err := f.Verify(ctx, "", 2)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("stream Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	if report.TotalFiles != 2 || len(report.Changes) != 1 || report.Changes[0].Path != "conf/site.conf" {
+		t.Errorf("stream Verify() = %+v, want one change in conf/site.conf", report)
+	}
+}
+
+func TestStreamVerifySignature(t *testing.T) {
+	dir := createTestDirectory(t)
+	m, err := NewGenerator(2).Generate(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := SaveToFile(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.VerifySignature(pub); err != nil {
+		t.Errorf("VerifySignature() error = %v", err)
+	}
+	f.Close()
+
+	snapshot, err := SnapshotManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	// Tampering with an entry invalidates the signature
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), m.Files[0].Hash, strings.Repeat("0", 64), 1)
+	if err := os.WriteFile(manifestPath, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A snapshot keeps reading the bytes taken before the file was rewritten
+	if err := snapshot.VerifySignature(pub); err != nil {
+		t.Errorf("snapshot VerifySignature() error = %v", err)
+	}
+	if _, err := snapshot.Verify(context.Background(), dir, 2); err != nil {
+		t.Errorf("snapshot Verify() error = %v", err)
+	}
+
+	f, err = OpenManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.VerifySignature(pub); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature() error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestStreamVerifyUnsorted(t *testing.T) {
+	dir := createTestDirectory(t)
+	m, err := NewGenerator(2).Generate(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Files[0], m.Files[1] = m.Files[1], m.Files[0]
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := SaveToFile(m, manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OpenManifestFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = f.Verify(context.Background(), dir, 2)
+	if err == nil || !strings.Contains(err.Error(), "not sorted") {
+		t.Errorf("stream Verify() error = %v, want an unsorted manifest error", err)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
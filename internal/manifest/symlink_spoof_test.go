@@ -34,7 +34,7 @@ func TestSymlinkSpoofingPrevention(t *testing.T) {
 	}
 
 	// Initial verification should pass
-	err = manifest.Verify(context.Background(), tempDir, 0)
+	_, err = manifest.Verify(context.Background(), tempDir, 0)
 	if err != nil {
 		t.Errorf("Initial verify should pass: %v", err)
 	}
@@ -53,10 +53,10 @@ func TestSymlinkSpoofingPrevention(t *testing.T) {
 		}
 
 		// Verification should fail due to type change
-		err := manifest.Verify(context.Background(), tempDir, 0)
+		_, err := manifest.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail when symlink is replaced with regular file")
-		} else if !strings.Contains(err.Error(), "modified: link (type symlink→file)") {
+		} else if !strings.Contains(err.Error(), "type changed: link (symlink→file)") {
 			t.Errorf("Error should mention type change, got: %v", err)
 		}
 
@@ -92,10 +92,10 @@ func TestSymlinkSpoofingPrevention(t *testing.T) {
 		}
 
 		// Verification should fail due to type change
-		err = manifest2.Verify(context.Background(), tempDir, 0)
+		_, err = manifest2.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail when regular file is replaced with symlink")
-		} else if !strings.Contains(err.Error(), "modified: regular.txt (type file→symlink)") {
+		} else if !strings.Contains(err.Error(), "type changed: regular.txt (file→symlink)") {
 			t.Errorf("Error should mention type change, got: %v", err)
 		}
 
@@ -154,7 +154,7 @@ func TestSymlinkSpoofingPrevention(t *testing.T) {
 		}
 
 		// Verification should fail
-		err = manifest3.Verify(context.Background(), tempDir, 0)
+		_, err = manifest3.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail when file content and size change")
 		} else if !strings.Contains(err.Error(), "modified") {
@@ -195,7 +195,7 @@ func TestSymlinkSpoofingPrevention(t *testing.T) {
 
 		// Verification should fail due to size difference
 		// (Now we check size for both symlinks and regular files for consistency)
-		err = manifest4.Verify(context.Background(), tempDir, 0)
+		_, err = manifest4.Verify(context.Background(), tempDir, 0)
 		if err == nil {
 			t.Error("Verify() should fail when size doesn't match")
 		} else if !strings.Contains(err.Error(), "modified: symlink_test (size") {
@@ -276,7 +276,7 @@ func TestManifestVerifyWithTypeAndSize(t *testing.T) {
 				os.Remove(link1)
 				os.WriteFile(link1, []byte("spoofed"), 0644)
 			},
-			expectError: "modified: link1 (type symlink→file)",
+			expectError: "type changed: link1 (symlink→file)",
 			cleanup: func() {
 				os.Remove(link1)
 				os.Symlink("file1.txt", link1)
@@ -288,7 +288,7 @@ func TestManifestVerifyWithTypeAndSize(t *testing.T) {
 				os.Remove(file2)
 				os.Symlink("file1.txt", file2)
 			},
-			expectError: "modified: file2.txt (type file→symlink)",
+			expectError: "type changed: file2.txt (file→symlink)",
 			cleanup: func() {
 				os.Remove(file2)
 				os.WriteFile(file2, []byte("content2"), 0644)
@@ -356,7 +356,7 @@ func TestManifestVerifyWithTypeAndSize(t *testing.T) {
 			tt.setup()
 			defer tt.cleanup()
 
-			err := testManifest.Verify(context.Background(), tempDir, 0)
+			_, err := testManifest.Verify(context.Background(), tempDir, 0)
 			if tt.expectError != "" {
 				if err == nil {
 					t.Errorf("Expected error containing '%s', got nil", tt.expectError)
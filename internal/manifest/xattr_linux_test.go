@@ -0,0 +1,62 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestVerifyXattrs(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "php")
+	if err := os.WriteFile(path, []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	generator := NewGenerator(0)
+	generator.SetXattrNamespaces([]string{"user"})
+	manifest, err := generator.Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !reflect.DeepEqual(manifest.XattrNamespaces, []string{"user"}) {
+		t.Errorf("XattrNamespaces = %v", manifest.XattrNamespaces)
+	}
+
+	// Granting an attribute changes neither content nor mode
+	if err := syscall.Setxattr(path, "user.capability", []byte("cap_setuid+ep"), 0); err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			t.Skip("filesystem does not support user xattrs")
+		}
+		t.Fatal(err)
+	}
+
+	report, err := manifest.Verify(context.Background(), tempDir, 0)
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Fatalf("Verify() error = %v, want ErrIntegrityCheckFailed", err)
+	}
+	changes := report.ChangesOf(ChangeXattr)
+	if len(changes) != 1 || changes[0].Path != "php" || changes[0].OldXattr != "" || changes[0].NewXattr == "" {
+		t.Errorf("xattr changes = %+v", report.Changes)
+	}
+	if !strings.Contains(err.Error(), "xattr changed: php (xattrs none→") {
+		t.Errorf("error should describe the xattr change, got: %v", err)
+	}
+
+	// Manifests generated without xattrs ignore them
+	plain, err := NewGenerator(0).Generate(context.Background(), tempDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Removexattr(path, "user.capability"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Verify(context.Background(), tempDir, 0); err != nil {
+		t.Errorf("Verify() without xattrs error = %v", err)
+	}
+}
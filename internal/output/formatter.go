@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+	"github.com/catatsuy/kekkai/internal/manifest"
 )
 
 // VerificationResult represents the result of a verification
@@ -14,15 +18,55 @@ type VerificationResult struct {
 	Message   string               `json:"message,omitempty"`
 	Error     string               `json:"error,omitempty"`
 	Details   *VerificationDetails `json:"details,omitempty"`
+	Findings  []hash.Finding       `json:"findings,omitempty"` // Suspicious entries in excluded paths; reported apart from integrity failures
 }
 
 // VerificationDetails contains detailed verification information
 type VerificationDetails struct {
-	TotalFiles    int      `json:"total_files"`
-	VerifiedFiles int      `json:"verified_files"`
-	ModifiedFiles []string `json:"modified_files,omitempty"`
-	DeletedFiles  []string `json:"deleted_files,omitempty"`
-	AddedFiles    []string `json:"added_files,omitempty"`
+	TotalFiles    int               `json:"total_files"`
+	VerifiedFiles int               `json:"verified_files"`
+	ModifiedFiles []string          `json:"modified_files,omitempty"`
+	DeletedFiles  []string          `json:"deleted_files,omitempty"`
+	AddedFiles    []string          `json:"added_files,omitempty"`
+	Changes       []manifest.Change `json:"changes,omitempty"`
+	Warnings      []manifest.Change `json:"warnings,omitempty"`
+	// DifferingSubtree is the deepest directory holding every change
+	DifferingSubtree string `json:"differing_subtree,omitempty"`
+}
+
+// NewVerificationDetails builds verification details from a verification report.
+// Type changes are listed under modified files.
+func NewVerificationDetails(report *manifest.VerificationReport) *VerificationDetails {
+	if report == nil {
+		return nil
+	}
+
+	details := &VerificationDetails{
+		TotalFiles:    report.TotalFiles,
+		VerifiedFiles: report.VerifiedFiles,
+		Changes:       report.Changes,
+		Warnings:      report.Warnings,
+
+		DifferingSubtree: report.DifferingSubtree,
+	}
+
+	modified := make(map[string]bool)
+	for _, change := range report.Changes {
+		switch change.Kind {
+		case manifest.ChangeDeleted:
+			details.DeletedFiles = append(details.DeletedFiles, change.Path)
+		case manifest.ChangeAdded:
+			details.AddedFiles = append(details.AddedFiles, change.Path)
+		default:
+			// An entry can have both a content and a metadata change
+			if !modified[change.Path] {
+				modified[change.Path] = true
+				details.ModifiedFiles = append(details.ModifiedFiles, change.Path)
+			}
+		}
+	}
+
+	return details
 }
 
 // Formatter handles output formatting
@@ -58,10 +102,18 @@ func (f *Formatter) formatJSON(result *VerificationResult) error {
 
 // formatText outputs in human-readable text format
 func (f *Formatter) formatText(result *VerificationResult) error {
+	err := f.formatIntegrityText(result)
+	f.formatFindings(result.Findings)
+	return err
+}
+
+// formatIntegrityText outputs the integrity check part of a verification result
+func (f *Formatter) formatIntegrityText(result *VerificationResult) error {
 	if result.Success {
 		_, err := fmt.Fprintln(f.writer, "✓ Integrity check passed")
 		if result.Details != nil {
 			fmt.Fprintf(f.writer, "  Verified %d files\n", result.Details.VerifiedFiles)
+			f.formatChangeList("Warnings", result.Details.Warnings)
 		}
 		return err
 	}
@@ -72,29 +124,101 @@ func (f *Formatter) formatText(result *VerificationResult) error {
 	}
 
 	if result.Details != nil {
-		if len(result.Details.ModifiedFiles) > 0 {
-			fmt.Fprintf(f.writer, "\n  Modified files (%d):\n", len(result.Details.ModifiedFiles))
-			for _, file := range result.Details.ModifiedFiles {
-				fmt.Fprintf(f.writer, "    - %s\n", file)
-			}
+		if result.Details.DifferingSubtree != "" {
+			fmt.Fprintf(f.writer, "  Differences confined to: %s/\n", displayPath(result.Details.DifferingSubtree))
 		}
+		if len(result.Details.Changes) > 0 {
+			f.formatChanges(result.Details.Changes)
+			f.formatChangeList("Warnings", result.Details.Warnings)
+		} else {
+			f.formatFileList("Modified files", result.Details.ModifiedFiles)
+			f.formatFileList("Deleted files", result.Details.DeletedFiles)
+			f.formatFileList("Added files", result.Details.AddedFiles)
+		}
+	}
 
-		if len(result.Details.DeletedFiles) > 0 {
-			fmt.Fprintf(f.writer, "\n  Deleted files (%d):\n", len(result.Details.DeletedFiles))
-			for _, file := range result.Details.DeletedFiles {
-				fmt.Fprintf(f.writer, "    - %s\n", file)
+	return err
+}
+
+// formatFindings lists suspicious entries found in excluded paths
+func (f *Formatter) formatFindings(findings []hash.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+
+	fmt.Fprintf(f.writer, "\n✗ Suspicious files in excluded paths (%d):\n", len(findings))
+	for _, finding := range findings {
+		fmt.Fprintf(f.writer, "    - %s (%s; excluded by %q)\n", displayPath(finding.Path), strings.Join(finding.Reasons, ", "), finding.ExcludedBy)
+	}
+}
+
+// changeGroups defines the order and headings used when listing changes in text format
+var changeGroups = []struct {
+	kind  manifest.ChangeKind
+	title string
+}{
+	{manifest.ChangeModified, "Modified files"},
+	{manifest.ChangeTypeChanged, "Type changed"},
+	{manifest.ChangeMetadata, "Metadata changed"},
+	{manifest.ChangeXattr, "Extended attributes changed"},
+	{manifest.ChangeLink, "Hard links changed"},
+	{manifest.ChangeAppend, "Append-only files violated"},
+	{manifest.ChangeDeleted, "Deleted files"},
+	{manifest.ChangeAdded, "Added files"},
+}
+
+// formatChanges lists changes grouped by kind with per-entry details
+func (f *Formatter) formatChanges(changes []manifest.Change) {
+	for _, group := range changeGroups {
+		var entries []manifest.Change
+		for _, change := range changes {
+			if change.Kind == group.kind {
+				entries = append(entries, change)
 			}
 		}
+		f.formatChangeList(group.title, entries)
+	}
+}
 
-		if len(result.Details.AddedFiles) > 0 {
-			fmt.Fprintf(f.writer, "\n  Added files (%d):\n", len(result.Details.AddedFiles))
-			for _, file := range result.Details.AddedFiles {
-				fmt.Fprintf(f.writer, "    - %s\n", file)
-			}
+// formatChangeList lists changes under a heading
+func (f *Formatter) formatChangeList(title string, changes []manifest.Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(f.writer, "\n  %s (%d):\n", title, len(changes))
+	for _, change := range changes {
+		line := displayPath(change.Path)
+		if detail := change.Detail(); detail != "" {
+			line += fmt.Sprintf(" (%s)", detail)
+		}
+		if rule := change.RuleDetail(); rule != "" {
+			line += fmt.Sprintf(" [%s]", rule)
 		}
+		fmt.Fprintf(f.writer, "    - %s\n", line)
 	}
+}
 
-	return err
+// displayPath quotes paths containing control or non-printable characters
+// so a crafted file name cannot forge extra report lines
+func displayPath(path string) string {
+	quoted := strconv.Quote(path)
+	if quoted[1:len(quoted)-1] != path {
+		return quoted
+	}
+	return path
+}
+
+// formatFileList lists plain file paths under a heading
+func (f *Formatter) formatFileList(title string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+
+	fmt.Fprintf(f.writer, "\n  %s (%d):\n", title, len(files))
+	for _, file := range files {
+		fmt.Fprintf(f.writer, "    - %s\n", displayPath(file))
+	}
 }
 
 // GenerationResult represents the result of manifest generation
@@ -136,36 +260,311 @@ func (f *Formatter) FormatGeneration(result *GenerationResult, format string) er
 	}
 }
 
-// ParseVerificationError parses an error from verification and extracts details
-func ParseVerificationError(err error) *VerificationDetails {
-	if err == nil {
+// DiffResult represents the result of comparing two manifests
+type DiffResult struct {
+	Success   bool                 `json:"success"`
+	Timestamp string               `json:"timestamp"`
+	Old       string               `json:"old"`
+	New       string               `json:"new"`
+	Identical bool                 `json:"identical"`
+	Error     string               `json:"error,omitempty"`
+	Details   *manifest.DiffReport `json:"details,omitempty"`
+}
+
+// FormatDiff formats the result of comparing two manifests
+func (f *Formatter) FormatDiff(result *DiffResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		if !result.Success {
+			fmt.Fprintln(f.writer, "✗ Failed to compare manifests")
+			if result.Error != "" {
+				fmt.Fprintf(f.writer, "  Error: %s\n", result.Error)
+			}
+			return nil
+		}
+
+		if result.Identical {
+			fmt.Fprintln(f.writer, "✓ Manifests are identical")
+		} else {
+			fmt.Fprintln(f.writer, "Δ Manifests differ")
+		}
+		if d := result.Details; d != nil {
+			fmt.Fprintf(f.writer, "  Old: %s (%d files, generated %s)\n", displayPath(result.Old), d.OldFiles, d.OldGeneratedAt)
+			fmt.Fprintf(f.writer, "  New: %s (%d files, generated %s)\n", displayPath(result.New), d.NewFiles, d.NewGeneratedAt)
+			f.formatPatternChanges(d.PatternChanges)
+			f.formatChanges(d.Changes)
+		}
 		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
 	}
+}
 
-	// Parse error message to extract file changes
-	details := &VerificationDetails{
-		ModifiedFiles: []string{},
-		DeletedFiles:  []string{},
-		AddedFiles:    []string{},
+// formatPatternChanges lists include and exclude patterns that differ between manifests
+func (f *Formatter) formatPatternChanges(changes []manifest.PatternChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(f.writer, "\n  Patterns changed (%d):\n", len(changes))
+	for _, change := range changes {
+		for _, p := range change.Removed {
+			fmt.Fprintf(f.writer, "    - %s: %s\n", change.Field, strconv.Quote(p))
+		}
+		for _, p := range change.Added {
+			fmt.Fprintf(f.writer, "    + %s: %s\n", change.Field, strconv.Quote(p))
+		}
+	}
+}
+
+// InspectResult represents the answers to queries about a manifest.
+// Sections that were not requested are nil.
+type InspectResult struct {
+	Success   bool                      `json:"success"`
+	Timestamp string                    `json:"timestamp"`
+	Source    string                    `json:"source,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+	Summary   *manifest.Summary         `json:"summary,omitempty"`
+	Patterns  *manifest.Patterns        `json:"patterns,omitempty"`
+	Lookups   []manifest.PathLookup     `json:"lookups,omitempty"`
+	Prefix    string                    `json:"prefix,omitempty"`
+	Entries   []hash.FileInfo           `json:"entries,omitempty"`
+	Totals    []manifest.DirectoryTotal `json:"totals,omitempty"`
+}
+
+// FormatInspect formats the result of inspecting a manifest
+func (f *Formatter) FormatInspect(result *InspectResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		if !result.Success {
+			fmt.Fprintln(f.writer, "✗ Failed to inspect manifest")
+			if result.Error != "" {
+				fmt.Fprintf(f.writer, "  Error: %s\n", result.Error)
+			}
+			return nil
+		}
+
+		fmt.Fprintf(f.writer, "Manifest: %s\n", displayPath(result.Source))
+		if s := result.Summary; s != nil {
+			fmt.Fprintf(f.writer, "  Version: %s\n", s.Version)
+			fmt.Fprintf(f.writer, "  Generated: %s\n", s.GeneratedAt)
+			fmt.Fprintf(f.writer, "  Hash Algorithm: %s\n", s.HashAlgorithm)
+			fmt.Fprintf(f.writer, "  File Count: %d\n", s.FileCount)
+			fmt.Fprintf(f.writer, "  Directory Count: %d\n", s.DirectoryCount)
+			fmt.Fprintf(f.writer, "  Total Size: %d bytes\n", s.TotalSize)
+			if s.SignedBy != "" {
+				fmt.Fprintf(f.writer, "  Signed By: %s\n", s.SignedBy)
+			}
+			if len(s.XattrNamespaces) > 0 {
+				fmt.Fprintf(f.writer, "  Xattr Namespaces: %s\n", strings.Join(s.XattrNamespaces, ", "))
+			}
+			if len(s.Roots) > 0 {
+				roots := make([]string, 0, len(s.Roots))
+				for _, root := range s.Roots {
+					roots = append(roots, root.Name+"="+root.Path)
+				}
+				fmt.Fprintf(f.writer, "  Roots: %s\n", strings.Join(roots, ", "))
+			}
+		}
+		if p := result.Patterns; p != nil {
+			f.formatPatternList("Includes", p.Includes)
+			f.formatPatternList("Excludes", p.Excludes)
+			f.formatPatternList("Exclude rules", p.ExcludeRules)
+		}
+		for _, lookup := range result.Lookups {
+			f.formatLookup(lookup)
+		}
+		if result.Entries != nil || result.Prefix != "" {
+			fmt.Fprintf(f.writer, "\n  Entries under %s (%d):\n", displayPath(result.Prefix), len(result.Entries))
+			for _, e := range result.Entries {
+				fmt.Fprintf(f.writer, "    %-7s %-5s %10d  %s\n", manifest.EntryType(e), e.Mode, e.Size, displayPath(e.Path))
+			}
+		}
+		if result.Totals != nil {
+			fmt.Fprintf(f.writer, "\n  Totals by top-level directory (%d):\n", len(result.Totals))
+			for _, t := range result.Totals {
+				fmt.Fprintf(f.writer, "    %-24s %8d files %14d bytes\n", displayPath(t.Name), t.Files, t.Size)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// formatPatternList lists patterns under a heading, or "none"
+func (f *Formatter) formatPatternList(title string, patterns []string) {
+	fmt.Fprintf(f.writer, "\n  %s (%d):\n", title, len(patterns))
+	if len(patterns) == 0 {
+		fmt.Fprintln(f.writer, "    none")
+	}
+	for _, p := range patterns {
+		fmt.Fprintf(f.writer, "    - %s\n", strconv.Quote(p))
+	}
+}
+
+// formatLookup describes a single path looked up in a manifest
+func (f *Formatter) formatLookup(lookup manifest.PathLookup) {
+	fmt.Fprintf(f.writer, "\n  Path: %s\n", displayPath(lookup.Path))
+	if !lookup.Found {
+		fmt.Fprintf(f.writer, "    Not recorded: %s\n", lookup.Reason)
+		return
 	}
 
-	// Parse error message to extract file changes
-	errStr := err.Error()
-	lines := strings.SplitSeq(errStr, "\n")
+	e := lookup.Entry
+	fmt.Fprintf(f.writer, "    Type: %s\n", manifest.EntryType(*e))
+	if e.Hash != "" {
+		fmt.Fprintf(f.writer, "    Hash: %s\n", e.Hash)
+	}
+	if !e.IsDir {
+		fmt.Fprintf(f.writer, "    Size: %d\n", e.Size)
+	}
+	if e.LinkTarget != "" {
+		fmt.Fprintf(f.writer, "    Target: %s\n", displayPath(e.LinkTarget))
+	}
+	if e.Mode != "" {
+		fmt.Fprintf(f.writer, "    Mode: %s\n", e.Mode)
+	}
+	if e.UID != nil && e.GID != nil {
+		fmt.Fprintf(f.writer, "    Owner: %d:%d\n", *e.UID, *e.GID)
+	}
+	if e.LinkGroup != "" {
+		fmt.Fprintf(f.writer, "    Link Group: %s (%d links)\n", e.LinkGroup, e.Nlink)
+	}
+	if e.XattrDigest != "" {
+		fmt.Fprintf(f.writer, "    Xattr Digest: %s\n", e.XattrDigest)
+	}
+}
 
-	for line := range lines {
-		line = strings.TrimSpace(line)
-		if after, ok := strings.CutPrefix(line, "modified:"); ok {
-			file := strings.TrimSpace(after)
-			details.ModifiedFiles = append(details.ModifiedFiles, file)
-		} else if after, ok := strings.CutPrefix(line, "deleted:"); ok {
-			file := strings.TrimSpace(after)
-			details.DeletedFiles = append(details.DeletedFiles, file)
-		} else if after, ok := strings.CutPrefix(line, "added:"); ok {
-			file := strings.TrimSpace(after)
-			details.AddedFiles = append(details.AddedFiles, file)
+// ExplainResult represents why paths are or are not recorded in a manifest
+type ExplainResult struct {
+	Success      bool               `json:"success"`
+	Timestamp    string             `json:"timestamp"`
+	Error        string             `json:"error,omitempty"`
+	Explanations []hash.Explanation `json:"explanations,omitempty"`
+}
+
+// FormatExplain formats the explanation of each path
+func (f *Formatter) FormatExplain(result *ExplainResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		if !result.Success {
+			fmt.Fprintln(f.writer, "✗ Failed to explain paths")
+			if result.Error != "" {
+				fmt.Fprintf(f.writer, "  Error: %s\n", result.Error)
+			}
+			return nil
 		}
+
+		for _, e := range result.Explanations {
+			status := "✓ included"
+			if !e.Included {
+				status = "✗ excluded"
+			}
+			name := displayPath(e.Path)
+			if e.IsDir && e.Path != "." {
+				name += "/"
+			}
+			fmt.Fprintf(f.writer, "%s: %s\n", status, name)
+			fmt.Fprintf(f.writer, "  %s\n", e.Reason)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
 	}
+}
 
-	return details
+// RootResult represents the Merkle root of a manifest
+type RootResult struct {
+	Success       bool           `json:"success"`
+	Timestamp     string         `json:"timestamp"`
+	Error         string         `json:"error,omitempty"`
+	Source        string         `json:"source,omitempty"`
+	Root          string         `json:"root,omitempty"`
+	HashAlgorithm hash.Algorithm `json:"hash_algorithm,omitempty"`
+	Recorded      bool           `json:"recorded"` // Whether the manifest records the root, or it was computed from the entries
+}
+
+// FormatRoot formats the Merkle root. The text format is the bare root, for
+// use in scripts and deploy logs.
+func (f *Formatter) FormatRoot(result *RootResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		if !result.Success {
+			fmt.Fprintln(f.writer, "✗ Failed to compute the Merkle root")
+			if result.Error != "" {
+				fmt.Fprintf(f.writer, "  Error: %s\n", result.Error)
+			}
+			return nil
+		}
+		fmt.Fprintln(f.writer, result.Root)
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// AuditResult represents the result of a generate dry run
+type AuditResult struct {
+	Success   bool        `json:"success"`
+	Timestamp string      `json:"timestamp"`
+	Target    string      `json:"target"`
+	Audit     *hash.Audit `json:"audit"`
+	Warnings  []string    `json:"warnings,omitempty"`
+}
+
+// FormatAudit formats the exclusion audit of a generate dry run
+func (f *Formatter) FormatAudit(result *AuditResult, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(f.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case "text":
+		a := result.Audit
+		fmt.Fprintln(f.writer, "✓ Dry run completed (no manifest written)")
+		fmt.Fprintf(f.writer, "  Target: %s\n", displayPath(result.Target))
+		fmt.Fprintf(f.writer, "  Total: %d files, %d bytes\n", a.TotalFiles, a.TotalBytes)
+		fmt.Fprintf(f.writer, "  Recorded: %d files, %d bytes\n", a.IncludedFiles, a.IncludedBytes)
+		if a.NotIncludedFiles > 0 {
+			fmt.Fprintf(f.writer, "  Outside include patterns: %d files, %d bytes\n", a.NotIncludedFiles, a.NotIncludedBytes)
+		}
+
+		if len(a.Patterns) > 0 {
+			fmt.Fprintf(f.writer, "\n  Excluded by pattern (%d):\n", len(a.Patterns))
+			for _, pa := range a.Patterns {
+				fmt.Fprintf(f.writer, "    - %s %s: %d files, %d bytes", pa.Kind, strconv.Quote(pa.Pattern), pa.Files, pa.Bytes)
+				if pa.Executables > 0 {
+					fmt.Fprintf(f.writer, " (%d executable)", pa.Executables)
+				}
+				fmt.Fprintln(f.writer)
+			}
+		}
+
+		if len(result.Warnings) > 0 {
+			fmt.Fprintf(f.writer, "\n  Warnings (%d):\n", len(result.Warnings))
+			for _, w := range result.Warnings {
+				fmt.Fprintf(f.writer, "    - %s\n", w)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
 }
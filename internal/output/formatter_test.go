@@ -3,10 +3,13 @@ package output
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+	"github.com/catatsuy/kekkai/internal/manifest"
 )
 
 func TestFormatVerificationResult(t *testing.T) {
@@ -240,67 +243,216 @@ func TestJSONMarshaling(t *testing.T) {
 	})
 }
 
-func TestParseVerificationError(t *testing.T) {
-	tests := []struct {
-		name           string
-		errorMsg       string
-		expectModified int
-		expectDeleted  int
-		expectAdded    int
-	}{
-		{
-			name: "parse modified files",
-			errorMsg: `integrity check failed:
-modified: file1.txt
-modified: file2.txt
-deleted: file3.txt
-added: file4.txt`,
-			expectModified: 2,
-			expectDeleted:  1,
-			expectAdded:    1,
+func TestNewVerificationDetails(t *testing.T) {
+	if details := NewVerificationDetails(nil); details != nil {
+		t.Errorf("NewVerificationDetails(nil) = %v, want nil", details)
+	}
+
+	oldSize, newSize := int64(10), int64(12)
+	report := &manifest.VerificationReport{
+		TotalFiles:    5,
+		VerifiedFiles: 2,
+		Changes: []manifest.Change{
+			{Path: "app.php", Kind: manifest.ChangeModified, Reason: "hash", OldHash: "aaa", NewHash: "bbb", OldSize: &oldSize, NewSize: &newSize},
+			{Path: "link", Kind: manifest.ChangeTypeChanged, OldType: "symlink", NewType: "file"},
+			{Path: "gone.php", Kind: manifest.ChangeDeleted, OldType: "file"},
+			{Path: "shell.php", Kind: manifest.ChangeAdded, NewType: "file"},
 		},
-		{
-			name:           "empty error",
-			errorMsg:       "",
-			expectModified: 0,
-			expectDeleted:  0,
-			expectAdded:    0,
+	}
+
+	details := NewVerificationDetails(report)
+
+	if details.TotalFiles != 5 || details.VerifiedFiles != 2 {
+		t.Errorf("counts = %d/%d, want 5/2", details.TotalFiles, details.VerifiedFiles)
+	}
+	if !reflect.DeepEqual(details.ModifiedFiles, []string{"app.php", "link"}) {
+		t.Errorf("ModifiedFiles = %v", details.ModifiedFiles)
+	}
+	if !reflect.DeepEqual(details.DeletedFiles, []string{"gone.php"}) {
+		t.Errorf("DeletedFiles = %v", details.DeletedFiles)
+	}
+	if !reflect.DeepEqual(details.AddedFiles, []string{"shell.php"}) {
+		t.Errorf("AddedFiles = %v", details.AddedFiles)
+	}
+	if len(details.Changes) != 4 {
+		t.Errorf("Changes length = %d, want 4", len(details.Changes))
+	}
+}
+
+func TestFormatChanges(t *testing.T) {
+	report := &manifest.VerificationReport{
+		TotalFiles: 3,
+		Changes: []manifest.Change{
+			{Path: "link", Kind: manifest.ChangeTypeChanged, OldType: "symlink", NewType: "file"},
+			{Path: "evil\nmodified: index.php", Kind: manifest.ChangeAdded, NewType: "file"},
+			{Path: "config", Kind: manifest.ChangeModified, Reason: "target", OldLinkTarget: "/etc/app", NewLinkTarget: "/tmp/fake"},
+			{Path: "config", Kind: manifest.ChangeMetadata, Reason: "mode", OldMode: "0644", NewMode: "0666"},
 		},
-		{
-			name: "only modified files",
-			errorMsg: `modified: app.php
-modified: config.php`,
-			expectModified: 2,
-			expectDeleted:  0,
-			expectAdded:    0,
+		Warnings: []manifest.Change{
+			{Path: "index.php", Kind: manifest.ChangeMetadata, Reason: "owner", OldOwner: "0:0", NewOwner: "33:33"},
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			details := ParseVerificationError(fmt.Errorf("%s", tt.errorMsg))
+	result := &VerificationResult{
+		Success: false,
+		Error:   "integrity check failed",
+		Details: NewVerificationDetails(report),
+	}
 
-			if details == nil {
-				if tt.expectModified > 0 || tt.expectDeleted > 0 || tt.expectAdded > 0 {
-					t.Fatal("Expected details but got nil")
-				}
-				return
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := NewFormatter(&buf).Format(result, "text"); err != nil {
+			t.Fatal(err)
+		}
+		output := buf.String()
+
+		for _, want := range []string{
+			"Type changed (1):",
+			"- link (symlink→file)",
+			"Modified files (1):",
+			"- config (target /etc/app→/tmp/fake)",
+			"Added files (1):",
+			`- "evil\nmodified: index.php" (file)`,
+			"Metadata changed (1):",
+			"- config (mode 0644→0666)",
+			"Warnings (1):",
+			"- index.php (owner 0:0→33:33)",
+		} {
+			if !strings.Contains(output, want) {
+				t.Errorf("Output should contain %q, got: %s", want, output)
 			}
+		}
 
-			if len(details.ModifiedFiles) != tt.expectModified {
-				t.Errorf("ModifiedFiles count = %d, want %d",
-					len(details.ModifiedFiles), tt.expectModified)
-			}
+		// A crafted path must not produce a line of its own
+		if strings.Contains(output, "\nmodified: index.php") {
+			t.Errorf("Path with newline was not escaped: %s", output)
+		}
+	})
 
-			if len(details.DeletedFiles) != tt.expectDeleted {
-				t.Errorf("DeletedFiles count = %d, want %d",
-					len(details.DeletedFiles), tt.expectDeleted)
-			}
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := NewFormatter(&buf).Format(result, "json"); err != nil {
+			t.Fatal(err)
+		}
 
-			if len(details.AddedFiles) != tt.expectAdded {
-				t.Errorf("AddedFiles count = %d, want %d",
-					len(details.AddedFiles), tt.expectAdded)
-			}
-		})
+		var decoded VerificationResult
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded.Details.Changes) != 4 {
+			t.Fatalf("Changes length = %d, want 4", len(decoded.Details.Changes))
+		}
+		if len(decoded.Details.Warnings) != 1 {
+			t.Errorf("Warnings length = %d, want 1", len(decoded.Details.Warnings))
+		}
+		if !reflect.DeepEqual(decoded.Details.ModifiedFiles, []string{"link", "config"}) {
+			t.Errorf("ModifiedFiles = %v, want each path once", decoded.Details.ModifiedFiles)
+		}
+		if decoded.Details.Changes[1].Path != "evil\nmodified: index.php" {
+			t.Errorf("Path = %q, want original path", decoded.Details.Changes[1].Path)
+		}
+		if decoded.Details.Changes[0].Kind != manifest.ChangeTypeChanged {
+			t.Errorf("Kind = %s, want %s", decoded.Details.Changes[0].Kind, manifest.ChangeTypeChanged)
+		}
+	})
+}
+
+func TestFormatDiff(t *testing.T) {
+	result := &DiffResult{
+		Success: true,
+		Old:     "old.json",
+		New:     "new.json",
+		Details: &manifest.DiffReport{
+			OldFiles: 2,
+			NewFiles: 2,
+			Changes: []manifest.Change{
+				{Path: "index.php", Kind: manifest.ChangeModified, Reason: "hash"},
+				{Path: "shell.php", Kind: manifest.ChangeAdded, NewType: "file"},
+			},
+			PatternChanges: []manifest.PatternChange{
+				{Field: "excludes", Added: []string{"uploads/**"}, Removed: []string{"*.log"}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := NewFormatter(&buf).FormatDiff(result, "text"); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"Δ Manifests differ",
+		"Old: old.json (2 files",
+		"Patterns changed (1):",
+		`- excludes: "*.log"`,
+		`+ excludes: "uploads/**"`,
+		"Modified files (1):",
+		"- index.php (hash)",
+		"Added files (1):",
+		"- shell.php (file)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should contain %q, got: %s", want, output)
+		}
+	}
+
+	buf.Reset()
+	identical := &DiffResult{Success: true, Identical: true, Details: &manifest.DiffReport{}}
+	if err := NewFormatter(&buf).FormatDiff(identical, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "✓ Manifests are identical") {
+		t.Errorf("Output should report identical manifests, got: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := NewFormatter(&buf).FormatDiff(result, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded DiffResult
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Details.PatternChanges, result.Details.PatternChanges) {
+		t.Errorf("PatternChanges = %+v, want %+v", decoded.Details.PatternChanges, result.Details.PatternChanges)
+	}
+}
+
+func TestFormatInspect(t *testing.T) {
+	uid, gid := uint32(0), uint32(33)
+	result := &InspectResult{
+		Success:  true,
+		Source:   "manifest.json",
+		Summary:  &manifest.Summary{Version: "1.0", FileCount: 2, TotalSize: 42, SignedBy: "0123abcd"},
+		Patterns: &manifest.Patterns{Excludes: []string{"*.log"}},
+		Lookups: []manifest.PathLookup{
+			{Path: "index.php", Found: true, Entry: &hash.FileInfo{Path: "index.php", Hash: "abc", Size: 42, Mode: "0644", UID: &uid, GID: &gid}},
+			{Path: "debug.log", Reason: `excluded by "*.log"`, ExcludedBy: "*.log"},
+		},
+		Prefix:  "public",
+		Entries: []hash.FileInfo{{Path: "public", IsDir: true, Mode: "0755"}},
+		Totals:  []manifest.DirectoryTotal{{Name: "public", Files: 1, Size: 42}},
+	}
+
+	var buf bytes.Buffer
+	if err := NewFormatter(&buf).FormatInspect(result, "text"); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	for _, want := range []string{
+		"Manifest: manifest.json",
+		"File Count: 2",
+		"Signed By: 0123abcd",
+		"Includes (0):",
+		`- "*.log"`,
+		"Path: index.php",
+		"Owner: 0:33",
+		`Not recorded: excluded by "*.log"`,
+		"Entries under public (1):",
+		"Totals by top-level directory (1):",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should contain %q, got: %s", want, output)
+		}
 	}
 }
@@ -0,0 +1,202 @@
+// Package policy enforces guardrails on the exclude patterns used to generate
+// a manifest, so a careless pattern cannot silently stop monitoring code.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/catatsuy/kekkai/internal/glob"
+	"github.com/catatsuy/kekkai/internal/hash"
+	"github.com/catatsuy/kekkai/internal/manifest"
+)
+
+// Policy describes what generate is allowed to exclude
+type Policy struct {
+	// MaxExcludedFraction is the largest share of files (0.0-1.0) that may be
+	// left out of the manifest, whether excluded or outside the include
+	// patterns. Zero means no limit.
+	MaxExcludedFraction float64 `json:"max_excluded_fraction,omitempty"`
+
+	// ForbiddenPatterns are paths that exclude patterns and exclude file rules
+	// may not leave out, compared by what they match: with "**" forbidden,
+	// "*" is rejected too. A pattern without '/' or "**" also covers its
+	// matches inside any directory, so "*.php" rejects "dir/*.php", while
+	// excluding a whole directory such as "storage/**" stays allowed.
+	ForbiddenPatterns []string `json:"forbidden_patterns,omitempty"`
+
+	// RequiredPaths must be recorded in the manifest
+	RequiredPaths []string `json:"required_paths,omitempty"`
+}
+
+// ViolationError lists every violation of a policy
+type ViolationError struct {
+	Violations []string
+}
+
+func (e *ViolationError) Error() string {
+	return "exclude policy violated:\n  - " + strings.Join(e.Violations, "\n  - ")
+}
+
+// LoadFromFile loads a policy from a JSON file
+func LoadFromFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", filename, err)
+	}
+
+	return &p, nil
+}
+
+// Validate checks that the policy itself is well formed
+func (p *Policy) Validate() error {
+	if p.MaxExcludedFraction < 0 || p.MaxExcludedFraction > 1 {
+		return fmt.Errorf("max excluded fraction must be between 0.0 and 1.0, got %g", p.MaxExcludedFraction)
+	}
+	for _, pattern := range p.ForbiddenPatterns {
+		if err := glob.Validate(pattern); err != nil {
+			return fmt.Errorf("invalid forbidden pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the policy checks nothing
+func (p *Policy) Empty() bool {
+	return p.MaxExcludedFraction == 0 && len(p.ForbiddenPatterns) == 0 && len(p.RequiredPaths) == 0
+}
+
+// CheckFilter checks the patterns before anything is hashed
+func (p *Policy) CheckFilter(filter hash.Filter) error {
+	var violations []string
+
+	for _, pattern := range filter.Excludes {
+		if f := p.forbiddenBy(pattern, false); f != "" {
+			violations = append(violations, forbiddenViolation("exclude pattern", pattern, f))
+		}
+	}
+	for _, rule := range filter.Rules {
+		if rule.Negate {
+			continue
+		}
+		if f := p.forbiddenBy(rule.Pattern, rule.DirOnly); f != "" {
+			violations = append(violations, forbiddenViolation("exclude file rule", rule.String(), f))
+		}
+	}
+
+	return violationError(violations)
+}
+
+// CheckResult checks the generated manifest and, when a maximum excluded
+// fraction is set, the audit of the tree it was generated from
+func (p *Policy) CheckResult(m *manifest.Manifest, audit *hash.Audit) error {
+	var violations []string
+
+	if p.MaxExcludedFraction > 0 && audit != nil && audit.TotalFiles > 0 {
+		excluded := audit.TotalFiles - audit.IncludedFiles
+		if fraction := float64(excluded) / float64(audit.TotalFiles); fraction > p.MaxExcludedFraction {
+			violations = append(violations, fmt.Sprintf("%d of %d files (%.1f%%) are not recorded, more than the allowed %.1f%%",
+				excluded, audit.TotalFiles, 100*fraction, 100*p.MaxExcludedFraction))
+		}
+	}
+
+	for _, path := range p.RequiredPaths {
+		lookup := m.Lookup(path)
+		switch {
+		case lookup.Found:
+		case lookup.ExcludedBy != "":
+			violations = append(violations, fmt.Sprintf("required path %s is excluded by %q", lookup.Path, lookup.ExcludedBy))
+		default:
+			violations = append(violations, fmt.Sprintf("required path %s is not recorded: %s", lookup.Path, lookup.Reason))
+		}
+	}
+
+	return violationError(violations)
+}
+
+// filler stands for any name in the probe paths. No real path contains it, so
+// only wildcards of an exclude pattern can match it.
+const filler = '\x00'
+
+// forbiddenBy returns the forbidden pattern whose paths an exclude pattern
+// leaves out, or "" when there is none. The forbidden paths are probed with
+// generic names, at the top of the target or, for a pattern without '/' or
+// "**", inside each directory the exclude pattern can name. Excluding
+// everything in such a directory is not caught, since that directory is what
+// the pattern is meant to exclude.
+func (p *Policy) forbiddenBy(pattern string, dirOnly bool) string {
+	for _, f := range p.ForbiddenPatterns {
+		probes := glob.Examples(f, filler)
+		if len(probes) == 0 {
+			continue
+		}
+
+		dirs := []string{"."}
+		if !strings.Contains(f, "/") && !strings.Contains(f, "**") {
+			dirs = append(dirs, exampleDirs(pattern)...)
+		}
+		for _, dir := range dirs {
+			if !slices.ContainsFunc(probes, func(probe string) bool {
+				return !excludes(pattern, dirOnly, path.Join(dir, probe))
+			}) && (dir == "." || !excludes(pattern, dirOnly, path.Join(dir, string(filler)))) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// exampleDirs returns the directories containing the examples of a pattern
+func exampleDirs(pattern string) []string {
+	var dirs []string
+	for _, example := range glob.Examples(pattern, filler) {
+		for dir := path.Dir(example); dir != "."; dir = path.Dir(dir) {
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// excludes reports whether an exclude pattern leaves out p, by matching it or
+// one of its parent directories. A directory-only rule matches only parents.
+func excludes(pattern string, dirOnly bool, p string) bool {
+	if !dirOnly && glob.Match(pattern, p) {
+		return true
+	}
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if glob.Match(pattern, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbiddenViolation describes an exclude pattern or rule that leaves out
+// paths of the forbidden pattern f
+func forbiddenViolation(kind, pattern, f string) string {
+	if pattern == f || pattern == "**/"+f {
+		return fmt.Sprintf("%s %q is forbidden", kind, pattern)
+	}
+	return fmt.Sprintf("%s %q is forbidden: it excludes paths matching %q", kind, pattern, f)
+}
+
+func violationError(violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ViolationError{Violations: violations}
+}
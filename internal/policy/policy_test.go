@@ -0,0 +1,166 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/catatsuy/kekkai/internal/hash"
+	"github.com/catatsuy/kekkai/internal/manifest"
+)
+
+func TestLoadFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "policy.json")
+	content := `{"max_excluded_fraction": 0.2, "forbidden_patterns": ["**", "*.php"], "required_paths": ["public/index.php"]}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile() error = %v", err)
+	}
+	want := &Policy{
+		MaxExcludedFraction: 0.2,
+		ForbiddenPatterns:   []string{"**", "*.php"},
+		RequiredPaths:       []string{"public/index.php"},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("LoadFromFile() = %+v, want %+v", p, want)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"max_excluded_fraction": 1.5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFromFile(invalid); err == nil {
+		t.Error("LoadFromFile() should reject a fraction above 1.0")
+	}
+	if _, err := LoadFromFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadFromFile() should fail for a missing file")
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	p := &Policy{ForbiddenPatterns: []string{"**", "*.php", "vendor/**"}}
+
+	if err := p.CheckFilter(hash.Filter{Excludes: []string{"storage/**", "*.log"}}); err != nil {
+		t.Errorf("CheckFilter() error = %v", err)
+	}
+
+	err := p.CheckFilter(hash.Filter{
+		Excludes: []string{"vendor/**", "**"},
+		Rules: []hash.Rule{
+			{Pattern: "**/*.php"},
+			{Pattern: "**/*.php", Negate: true}, // Re-including is fine
+		},
+	})
+	var violation *ViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("CheckFilter() error = %v, want ViolationError", err)
+	}
+	want := []string{
+		`exclude pattern "vendor/**" is forbidden`,
+		`exclude pattern "**" is forbidden`,
+		`exclude file rule "**/*.php" is forbidden`,
+	}
+	if !reflect.DeepEqual(violation.Violations, want) {
+		t.Errorf("Violations = %v, want %v", violation.Violations, want)
+	}
+	if !strings.HasPrefix(err.Error(), "exclude policy violated:\n  - ") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestCheckFilterByMeaning(t *testing.T) {
+	tests := []struct {
+		forbidden string
+		exclude   string
+		want      bool
+	}{
+		// Everything excluded, directly or through a parent
+		{"**", "*", true},
+		{"**", "**/*", true},
+		{"**", "{**}", true},
+		{"**", "storage/**", false},
+		{"**", "*.log", false},
+
+		// PHP files, at the top or in any directory
+		{"*.php", "app/**/*.php", true},
+		{"*.php", "*.ph[p]", true},
+		{"*.php", "dir/*.php", true},
+		{"*.php", "{*.php,*.inc}", true},
+		{"*.php", "*", true},
+		{"*.php", "storage/**", false},
+		{"*.php", "storage", false},
+		{"*.php", "*.log", false},
+		{"*.php", "config/app.php", false},
+
+		// A directory
+		{"vendor/**", "vendor", true},
+		{"vendor/**", "v*/**", true},
+		{"vendor/**", "vendor/composer/**", false},
+	}
+
+	for _, tt := range tests {
+		p := &Policy{ForbiddenPatterns: []string{tt.forbidden}}
+		err := p.CheckFilter(hash.Filter{Excludes: []string{tt.exclude}})
+		if got := err != nil; got != tt.want {
+			t.Errorf("forbidden %q, exclude %q: error = %v, want error %v", tt.forbidden, tt.exclude, err, tt.want)
+		}
+	}
+
+	// Exclude file rules are checked the same way, and directory-only rules
+	// leave out what is below the directory
+	p := &Policy{ForbiddenPatterns: []string{"*.php"}}
+	rules, err := hash.ParseRules(strings.NewReader("app/**/*.php\ncache/\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.CheckFilter(hash.Filter{Rules: rules})
+	var violation *ViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("CheckFilter() error = %v, want ViolationError", err)
+	}
+	want := []string{`exclude file rule "app/**/*.php" is forbidden: it excludes paths matching "*.php"`}
+	if !reflect.DeepEqual(violation.Violations, want) {
+		t.Errorf("Violations = %v, want %v", violation.Violations, want)
+	}
+
+	if err := (&Policy{ForbiddenPatterns: []string{"[a-"}}).Validate(); err == nil {
+		t.Error("Validate() should reject a malformed forbidden pattern")
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	m := &manifest.Manifest{
+		Excludes: []string{"public/*.php"},
+		Files:    []hash.FileInfo{{Path: "app/Kernel.php"}},
+	}
+
+	p := &Policy{MaxExcludedFraction: 0.5, RequiredPaths: []string{"app/Kernel.php", "public/index.php", "./config/app.php"}}
+	err := p.CheckResult(m, &hash.Audit{TotalFiles: 10, IncludedFiles: 4})
+
+	var violation *ViolationError
+	if !errors.As(err, &violation) {
+		t.Fatalf("CheckResult() error = %v, want ViolationError", err)
+	}
+	want := []string{
+		"6 of 10 files (60.0%) are not recorded, more than the allowed 50.0%",
+		`required path public/index.php is excluded by "public/*.php"`,
+		"required path config/app.php is not recorded: not present when the manifest was generated",
+	}
+	if !reflect.DeepEqual(violation.Violations, want) {
+		t.Errorf("Violations = %v, want %v", violation.Violations, want)
+	}
+
+	// Within the limit
+	p = &Policy{MaxExcludedFraction: 0.5, RequiredPaths: []string{"app/Kernel.php"}}
+	if err := p.CheckResult(m, &hash.Audit{TotalFiles: 10, IncludedFiles: 5}); err != nil {
+		t.Errorf("CheckResult() error = %v", err)
+	}
+}
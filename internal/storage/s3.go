@@ -3,8 +3,8 @@ package storage
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -42,19 +42,28 @@ func NewS3Storage(ctx context.Context, bucket string, region string) (*S3Storage
 }
 
 // upload uploads a manifest to S3 (internal use only)
-func (s *S3Storage) upload(ctx context.Context, key string, m *manifest.Manifest) error {
-	// Marshal manifest to JSON
-	data, err := json.MarshalIndent(m, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal manifest: %w", err)
+func (s *S3Storage) upload(ctx context.Context, key string, m *manifest.Manifest, enc manifest.Encoding) error {
+	// Encode manifest
+	var data bytes.Buffer
+	if err := manifest.SaveToWriterEncoded(m, &data, enc); err != nil {
+		return err
+	}
+	contentType := "application/json"
+	if enc.Format == manifest.FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	var contentEncoding *string
+	if ce := enc.Compression.ContentEncoding(); ce != "" {
+		contentEncoding = aws.String(ce)
 	}
 
 	// Upload to S3
-	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:               aws.String(s.bucket),
 		Key:                  aws.String(key),
-		Body:                 bytes.NewReader(data),
-		ContentType:          aws.String("application/json"),
+		Body:                 bytes.NewReader(data.Bytes()),
+		ContentType:          aws.String(contentType),
+		ContentEncoding:      contentEncoding,
 		ServerSideEncryption: types.ServerSideEncryptionAes256,
 		Metadata: map[string]string{
 			"generated-at": m.GeneratedAt,
@@ -81,25 +90,20 @@ func (s *S3Storage) download(ctx context.Context, key string) (*manifest.Manifes
 	}
 	defer result.Body.Close()
 
-	// Read and unmarshal
-	var m manifest.Manifest
-	decoder := json.NewDecoder(result.Body)
-	if err := decoder.Decode(&m); err != nil {
-		return nil, fmt.Errorf("failed to decode manifest: %w", err)
-	}
-
-	return &m, nil
+	// Read and decode any format; compression is detected from the content,
+	// which the SDK returns as stored
+	return manifest.LoadFromReader(result.Body)
 }
 
-// UploadWithVersioning uploads a manifest to a single fixed location
+// UploadWithVersioning uploads a manifest in the given encoding to a single fixed location
 // This is optimized for organizations that deploy frequently throughout the day
 // S3 bucket versioning should be enabled to maintain history
-func (s *S3Storage) UploadWithVersioning(ctx context.Context, basePath string, appName string, m *manifest.Manifest) (string, error) {
+func (s *S3Storage) UploadWithVersioning(ctx context.Context, basePath string, appName string, m *manifest.Manifest, enc manifest.Encoding) (string, error) {
 	// Use a fixed key path for single file storage
 	key := fmt.Sprintf("%s/%s/manifest.json", basePath, appName)
 
 	// Upload manifest
-	if err := s.upload(ctx, key, m); err != nil {
+	if err := s.upload(ctx, key, m, enc); err != nil {
 		return "", err
 	}
 
@@ -112,3 +116,21 @@ func (s *S3Storage) DownloadManifest(ctx context.Context, basePath string, appNa
 	key := fmt.Sprintf("%s/%s/manifest.json", basePath, appName)
 	return s.download(ctx, key)
 }
+
+// DownloadManifestTo copies the manifest for an app to w without decoding it
+func (s *S3Storage) DownloadManifestTo(ctx context.Context, basePath string, appName string, w io.Writer) error {
+	key := fmt.Sprintf("%s/%s/manifest.json", basePath, appName)
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	if _, err := io.Copy(w, result.Body); err != nil {
+		return fmt.Errorf("failed to download from S3: %w", err)
+	}
+	return nil
+}